@@ -0,0 +1,236 @@
+package balance
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/baely/txn/internal/balance/models"
+	"github.com/baely/txn/internal/common/errors"
+	commonHttp "github.com/baely/txn/internal/common/http"
+)
+
+// Archive query limits
+const (
+	defaultArchiveLimit = 100
+	maxArchiveLimit     = 1000
+)
+
+// TransactionArchive keeps every enriched transaction the service has seen,
+// so history can be replayed without fetching it from Up again
+type TransactionArchive interface {
+	UpsertTransaction(ctx context.Context, t models.Transaction) error
+	MarkTransactionDeleted(ctx context.Context, id string, deletedAt time.Time) error
+	GetArchivedTransaction(ctx context.Context, id string) (models.Transaction, error)
+	ListArchivedTransactions(ctx context.Context, query models.TransactionQuery) ([]models.Transaction, error)
+}
+
+// archiveEvent stores the transaction and account of an enriched event
+func (s *WebhookService) archiveEvent(ctx context.Context, event TransactionEvent) error {
+	t, err := archivedTransaction(event)
+	if err != nil {
+		return err
+	}
+	if err := s.archive.UpsertTransaction(ctx, t); err != nil {
+		return errors.Wrap(err, "failed to archive transaction %s", event.Transaction.Id)
+	}
+	return nil
+}
+
+// archivedTransaction converts an enriched event into an archive record
+func archivedTransaction(event TransactionEvent) (models.Transaction, error) {
+	account, err := json.Marshal(event.Account)
+	if err != nil {
+		return models.Transaction{}, errors.Wrap(err, "failed to marshal account")
+	}
+	transaction, err := json.Marshal(event.Transaction)
+	if err != nil {
+		return models.Transaction{}, errors.Wrap(err, "failed to marshal transaction")
+	}
+
+	attributes := event.Transaction.Attributes
+	relationships := event.Transaction.Relationships
+	t := models.Transaction{
+		ID:            event.Transaction.Id,
+		AccountID:     relationships.Account.Data.Id,
+		Status:        string(attributes.Status),
+		Description:   attributes.Description,
+		Amount:        attributes.Amount.ValueInBaseUnits,
+		CreatedAt:     attributes.CreatedAt,
+		SettledAt:     attributes.SettledAt,
+		LastEventType: string(event.Type),
+		Account:       account,
+		Transaction:   transaction,
+	}
+	if relationships.Category.Data != nil {
+		t.CategoryID = &relationships.Category.Data.Id
+	}
+	if relationships.ParentCategory.Data != nil {
+		t.ParentCategoryID = &relationships.ParentCategory.Data.Id
+	}
+	return t, nil
+}
+
+// handleListTransactions queries the transaction archive
+func (s *WebhookService) handleListTransactions(w http.ResponseWriter, r *http.Request) {
+	query, err := parseTransactionQuery(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	transactions, err := s.archive.ListArchivedTransactions(r.Context(), query)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, transactions)
+}
+
+// handleGetTransaction returns a single archived transaction
+func (s *WebhookService) handleGetTransaction(w http.ResponseWriter, r *http.Request) {
+	t, err := s.archive.GetArchivedTransaction(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, t)
+}
+
+// parseTransactionQuery reads archive filters from the query string
+func parseTransactionQuery(r *http.Request) (models.TransactionQuery, error) {
+	values := r.URL.Query()
+	query := models.TransactionQuery{
+		AccountID:  values.Get("account_id"),
+		CategoryID: values.Get("category"),
+		Search:     values.Get("q"),
+		Limit:      defaultArchiveLimit,
+	}
+
+	for name, t := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if v := values.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return query, errors.Wrap(errors.ErrInvalidInput, "invalid %s time", name)
+			}
+			*t = parsed
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxArchiveLimit {
+			return query, errors.Wrap(errors.ErrInvalidInput, "limit must be between 1 and %d", maxArchiveLimit)
+		}
+		query.Limit = n
+	}
+	if v := values.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return query, errors.Wrap(errors.ErrInvalidInput, "invalid offset")
+		}
+		query.Offset = n
+	}
+	if v := values.Get("include_deleted"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, errors.Wrap(errors.ErrInvalidInput, "invalid include_deleted")
+		}
+		query.IncludeDeleted = b
+	}
+
+	return query, nil
+}
+
+// memoryTransactionArchive is a TransactionArchive that keeps transactions in memory
+type memoryTransactionArchive struct {
+	mu           sync.Mutex
+	transactions map[string]models.Transaction
+}
+
+func newMemoryTransactionArchive() *memoryTransactionArchive {
+	return &memoryTransactionArchive{transactions: make(map[string]models.Transaction)}
+}
+
+func (m *memoryTransactionArchive) UpsertTransaction(ctx context.Context, t models.Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := m.transactions[t.ID]; ok {
+		t.FirstSeenAt = existing.FirstSeenAt
+		t.DeletedAt = existing.DeletedAt
+	} else {
+		t.FirstSeenAt = now
+	}
+	t.UpdatedAt = now
+	m.transactions[t.ID] = t
+	return nil
+}
+
+func (m *memoryTransactionArchive) MarkTransactionDeleted(ctx context.Context, id string, deletedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.transactions[id]
+	if !ok {
+		return nil
+	}
+	t.DeletedAt = &deletedAt
+	t.LastEventType = string(EventTypeDeleted)
+	t.UpdatedAt = time.Now()
+	m.transactions[id] = t
+	return nil
+}
+
+func (m *memoryTransactionArchive) GetArchivedTransaction(ctx context.Context, id string) (models.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.transactions[id]
+	if !ok {
+		return models.Transaction{}, errors.Wrap(errors.ErrNotFound, "transaction %s", id)
+	}
+	return t, nil
+}
+
+func (m *memoryTransactionArchive) ListArchivedTransactions(ctx context.Context, query models.TransactionQuery) ([]models.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	search := strings.ToLower(query.Search)
+	matched := make([]models.Transaction, 0)
+	for _, t := range m.transactions {
+		switch {
+		case !query.Since.IsZero() && t.CreatedAt.Before(query.Since),
+			!query.Until.IsZero() && !t.CreatedAt.Before(query.Until),
+			query.AccountID != "" && t.AccountID != query.AccountID,
+			query.CategoryID != "" && (t.CategoryID == nil || *t.CategoryID != query.CategoryID),
+			search != "" && !strings.Contains(strings.ToLower(t.Description), search),
+			!query.IncludeDeleted && t.DeletedAt != nil:
+			continue
+		}
+		matched = append(matched, t)
+	}
+
+	slices.SortFunc(matched, func(a, b models.Transaction) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	start := min(query.Offset, len(matched))
+	end := len(matched)
+	if query.Limit > 0 {
+		end = min(start+query.Limit, end)
+	}
+	return matched[start:end], nil
+}
@@ -0,0 +1,171 @@
+package balance
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+
+	"github.com/baely/txn/internal/common/errors"
+	commonHttp "github.com/baely/txn/internal/common/http"
+)
+
+// BackfillStatus describes the most recent backfill run
+type BackfillStatus struct {
+	Running    bool      `json:"running"`
+	Since      time.Time `json:"since"`
+	Until      time.Time `json:"until"`
+	Category   string    `json:"category,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Processed  int       `json:"processed"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// backfillState guards the status of the current backfill run
+type backfillState struct {
+	mu     sync.Mutex
+	status BackfillStatus
+}
+
+// Backfill replays historical Up transactions through every registered handler.
+// Transactions are dispatched oldest first so that, when events are serialized by
+// account, refunds follow the purchases they reverse.
+func (s *WebhookService) Backfill(ctx context.Context, opts ListTransactionsOptions) (int, error) {
+	var transactions []model.TransactionResource
+	for transaction, err := range s.upClient.ListTransactions(ctx, opts) {
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to list transactions")
+		}
+		transactions = append(transactions, transaction)
+	}
+	slices.Reverse(transactions)
+
+	s.logger.Info("Backfilling transactions", "count", len(transactions), "since", opts.Since, "until", opts.Until)
+
+	accounts := make(map[string]model.AccountResource)
+	var wg sync.WaitGroup
+	var processed atomic.Int32
+	for _, transaction := range transactions {
+		accountID := transaction.Relationships.Account.Data.Id
+		account, ok := accounts[accountID]
+		if !ok {
+			var err error
+			account, err = s.upClient.GetAccount(ctx, accountID)
+			if err != nil {
+				wg.Wait()
+				return int(processed.Load()), errors.Wrap(err, "failed to retrieve account %s", accountID)
+			}
+			accounts[accountID] = account
+		}
+
+		event := TransactionEvent{
+			Type:        EventTypeBackfill,
+			Account:     account,
+			Transaction: transaction,
+		}
+		if err := s.archiveEvent(ctx, event); err != nil {
+			wg.Wait()
+			return int(processed.Load()), err
+		}
+
+		// Recording the transaction as seen makes later webhooks settlement updates
+		wg.Add(1)
+		s.dispatch(ctx, event, func(err error) {
+			defer wg.Done()
+			if err == nil {
+				processed.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+
+	return int(processed.Load()), ctx.Err()
+}
+
+// handleBackfill starts a backfill in the background
+func (s *WebhookService) handleBackfill(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseBackfillOptions(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	s.backfill.mu.Lock()
+	if s.backfill.status.Running {
+		s.backfill.mu.Unlock()
+		commonHttp.HandleError(w, errors.Wrap(errors.ErrAlreadyExists, "backfill already running"))
+		return
+	}
+	s.backfill.status = BackfillStatus{
+		Running:   true,
+		Since:     opts.Since,
+		Until:     opts.Until,
+		Category:  opts.Category,
+		StartedAt: time.Now(),
+	}
+	status := s.backfill.status
+	s.backfill.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		processed, err := s.Backfill(s.ctx, opts)
+		if err != nil {
+			s.logger.Error("Backfill failed", "processed", processed, "error", err)
+		} else {
+			s.logger.Info("Backfill complete", "processed", processed)
+		}
+
+		s.backfill.mu.Lock()
+		defer s.backfill.mu.Unlock()
+		s.backfill.status.Running = false
+		s.backfill.status.FinishedAt = time.Now()
+		s.backfill.status.Processed = processed
+		if err != nil {
+			s.backfill.status.Error = err.Error()
+		}
+	}()
+
+	commonHttp.JSON(w, http.StatusAccepted, commonHttp.Response{Success: true, Data: status})
+}
+
+// handleBackfillStatus reports the status of the most recent backfill
+func (s *WebhookService) handleBackfillStatus(w http.ResponseWriter, r *http.Request) {
+	s.backfill.mu.Lock()
+	status := s.backfill.status
+	s.backfill.mu.Unlock()
+
+	commonHttp.Success(w, status)
+}
+
+// parseBackfillOptions reads the since, until and category query parameters
+func parseBackfillOptions(r *http.Request) (ListTransactionsOptions, error) {
+	var opts ListTransactionsOptions
+
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		return opts, errors.Wrap(errors.ErrInvalidInput, "since is required")
+	}
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return opts, errors.Wrap(errors.ErrInvalidInput, "invalid since time")
+	}
+	opts.Since = t
+
+	if until := r.URL.Query().Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return opts, errors.Wrap(errors.ErrInvalidInput, "invalid until time")
+		}
+		opts.Until = t
+	}
+
+	opts.Category = r.URL.Query().Get("category")
+	return opts, nil
+}
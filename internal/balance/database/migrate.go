@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock held while a migration runs, so
+// instances starting together apply each migration once. It differs from the
+// tracker's, which may share the database.
+const migrationLockID = 7_246_002
+
+// migration is a versioned change to the balance schema, embedded from
+// migrations/NNNN_name.sql. The balance tables only gain tables, columns and
+// indexes, so unlike the tracker's migrations there are no down scripts.
+type migration struct {
+	version int
+	name    string
+	script  string
+}
+
+// loadMigrations reads the embedded migrations in version order
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	migrations := make([]migration, 0, len(entries))
+	for _, entry := range entries {
+		file := entry.Name()
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version != len(migrations)+1 {
+			return nil, fmt.Errorf("invalid migration file name %s, want %04d_name.sql", file, len(migrations)+1)
+		}
+		script, err := migrationFiles.ReadFile("migrations/" + file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+		migrations = append(migrations, migration{version: version, name: name, script: string(script)})
+	}
+	return migrations, nil
+}
+
+// migrate applies the migrations that have not been applied yet, in order
+func (c *Client) migrate(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	q := `CREATE TABLE IF NOT EXISTS balance_schema_migration (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`
+	if _, err := c.db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	for _, m := range migrations {
+		if err := c.runMigration(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runMigration applies a migration and records it in one transaction, unless
+// it has already been applied
+func (c *Client) runMigration(ctx context.Context, m migration) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	var applied bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM balance_schema_migration WHERE version = $1)`, m.version).Scan(&applied)
+	if err != nil {
+		return fmt.Errorf("failed to check migration %d: %w", m.version, err)
+	}
+	if applied {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, m.script); err != nil {
+		return fmt.Errorf("failed to run migration %d %s: %w", m.version, m.name, err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO balance_schema_migration (version, name) VALUES ($1, $2)`, m.version, m.name); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d: %w", m.version, err)
+	}
+	return nil
+}
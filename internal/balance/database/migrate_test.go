@@ -0,0 +1,18 @@
+package database
+
+import "testing"
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for _, m := range migrations {
+		if m.script == "" {
+			t.Fatalf("migration %d %s is empty", m.version, m.name)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+-- IF NOT EXISTS picks up databases whose tables were created before
+-- migrations existed
+CREATE TABLE IF NOT EXISTS dead_letter (
+	id BIGSERIAL PRIMARY KEY,
+	handler TEXT NOT NULL,
+	transaction_id TEXT NOT NULL,
+	event JSONB NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS dead_letter_next_attempt_at_idx ON dead_letter (next_attempt_at);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS transactions (
+	id TEXT PRIMARY KEY,
+	account_id TEXT NOT NULL,
+	status TEXT NOT NULL,
+	description TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	category_id TEXT,
+	parent_category_id TEXT,
+	created_at TIMESTAMPTZ NOT NULL,
+	settled_at TIMESTAMPTZ,
+	deleted_at TIMESTAMPTZ,
+	last_event_type TEXT NOT NULL,
+	account JSONB NOT NULL,
+	transaction JSONB NOT NULL,
+	first_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS transactions_created_at_idx ON transactions (created_at);
+CREATE INDEX IF NOT EXISTS transactions_account_id_idx ON transactions (account_id, created_at);
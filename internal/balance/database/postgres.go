@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/baely/txn/internal/balance/models"
+	"github.com/baely/txn/internal/common/errors"
+)
+
+type Client struct {
+	db *sql.DB
+}
+
+func NewClient(user, password, host, port, db string) (*Client, error) {
+	connString := fmt.Sprintf("user=%s password=%s host=%s port=%s dbname=%s sslmode=disable", user, password, host, port, db)
+	driver, err := sql.Open("postgres", connString)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		db: driver,
+	}
+	if err := c.migrate(context.Background()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+const deadLetterColumns = `id, handler, transaction_id, event, attempts, last_error, next_attempt_at, created_at, updated_at`
+
+// AddDeadLetter stores a failed delivery and returns its id
+func (c *Client) AddDeadLetter(ctx context.Context, dl models.DeadLetter) (int64, error) {
+	q := `INSERT INTO dead_letter (handler, transaction_id, event, attempts, last_error, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	var id int64
+	err := c.db.QueryRowContext(ctx, q, dl.Handler, dl.TransactionID, []byte(dl.Event), dl.Attempts, dl.LastError, dl.NextAttemptAt).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add dead letter: %w", err)
+	}
+	return id, nil
+}
+
+// ListDeadLetters returns every dead-lettered delivery, oldest first
+func (c *Client) ListDeadLetters(ctx context.Context) ([]models.DeadLetter, error) {
+	q := `SELECT ` + deadLetterColumns + ` FROM dead_letter ORDER BY created_at ASC`
+	return c.queryDeadLetters(ctx, q)
+}
+
+// DueDeadLetters returns deliveries whose next retry is due
+func (c *Client) DueDeadLetters(ctx context.Context, now time.Time, limit int) ([]models.DeadLetter, error) {
+	q := `SELECT ` + deadLetterColumns + ` FROM dead_letter
+		WHERE next_attempt_at IS NOT NULL AND next_attempt_at <= $1
+		ORDER BY next_attempt_at ASC
+		LIMIT $2`
+	return c.queryDeadLetters(ctx, q, now, limit)
+}
+
+// GetDeadLetter returns a single delivery
+func (c *Client) GetDeadLetter(ctx context.Context, id int64) (models.DeadLetter, error) {
+	q := `SELECT ` + deadLetterColumns + ` FROM dead_letter WHERE id = $1`
+	dls, err := c.queryDeadLetters(ctx, q, id)
+	if err != nil {
+		return models.DeadLetter{}, err
+	}
+	if len(dls) == 0 {
+		return models.DeadLetter{}, errors.Wrap(errors.ErrNotFound, "dead letter %d", id)
+	}
+	return dls[0], nil
+}
+
+// UpdateDeadLetter records the outcome of a failed retry
+func (c *Client) UpdateDeadLetter(ctx context.Context, id int64, attempts int, lastError string, nextAttemptAt *time.Time) error {
+	q := `UPDATE dead_letter SET attempts = $2, last_error = $3, next_attempt_at = $4, updated_at = now() WHERE id = $1`
+	res, err := c.db.ExecContext(ctx, q, id, attempts, lastError, nextAttemptAt)
+	if err != nil {
+		return fmt.Errorf("failed to update dead letter: %w", err)
+	}
+	return requireRow(res, id)
+}
+
+// DeleteDeadLetter removes a delivery after it succeeds or is discarded
+func (c *Client) DeleteDeadLetter(ctx context.Context, id int64) error {
+	q := `DELETE FROM dead_letter WHERE id = $1`
+	res, err := c.db.ExecContext(ctx, q, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete dead letter: %w", err)
+	}
+	return requireRow(res, id)
+}
+
+func (c *Client) queryDeadLetters(ctx context.Context, q string, args ...interface{}) ([]models.DeadLetter, error) {
+	rows, err := c.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	dls := make([]models.DeadLetter, 0)
+	for rows.Next() {
+		var dl models.DeadLetter
+		var event []byte
+		err := rows.Scan(&dl.ID, &dl.Handler, &dl.TransactionID, &event, &dl.Attempts, &dl.LastError, &dl.NextAttemptAt, &dl.CreatedAt, &dl.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan dead letter: %w", err)
+		}
+		dl.Event = event
+		dls = append(dls, dl)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dead letters: %w", err)
+	}
+	return dls, nil
+}
+
+// requireRow returns ErrNotFound if a statement did not affect any rows
+func requireRow(res sql.Result, id int64) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.Wrap(errors.ErrNotFound, "dead letter %d", id)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/baely/txn/internal/balance/models"
+	"github.com/baely/txn/internal/common/errors"
+)
+
+const transactionColumns = `id, account_id, status, description, amount, category_id, parent_category_id,
+	created_at, settled_at, deleted_at, last_event_type, account, transaction, first_seen_at, updated_at`
+
+// UpsertTransaction archives a transaction, replacing any earlier copy
+func (c *Client) UpsertTransaction(ctx context.Context, t models.Transaction) error {
+	q := `INSERT INTO transactions (id, account_id, status, description, amount, category_id, parent_category_id,
+			created_at, settled_at, last_event_type, account, transaction)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO UPDATE SET
+			account_id = EXCLUDED.account_id,
+			status = EXCLUDED.status,
+			description = EXCLUDED.description,
+			amount = EXCLUDED.amount,
+			category_id = EXCLUDED.category_id,
+			parent_category_id = EXCLUDED.parent_category_id,
+			created_at = EXCLUDED.created_at,
+			settled_at = EXCLUDED.settled_at,
+			last_event_type = EXCLUDED.last_event_type,
+			account = EXCLUDED.account,
+			transaction = EXCLUDED.transaction,
+			updated_at = now()`
+	_, err := c.db.ExecContext(ctx, q, t.ID, t.AccountID, t.Status, t.Description, t.Amount, t.CategoryID, t.ParentCategoryID,
+		t.CreatedAt, t.SettledAt, t.LastEventType, []byte(t.Account), []byte(t.Transaction))
+	if err != nil {
+		return fmt.Errorf("failed to upsert transaction: %w", err)
+	}
+	return nil
+}
+
+// MarkTransactionDeleted records that Up deleted a transaction.
+// Transactions that were never archived are ignored.
+func (c *Client) MarkTransactionDeleted(ctx context.Context, id string, deletedAt time.Time) error {
+	q := `UPDATE transactions SET deleted_at = $2, last_event_type = $3, updated_at = now() WHERE id = $1`
+	if _, err := c.db.ExecContext(ctx, q, id, deletedAt, "TRANSACTION_DELETED"); err != nil {
+		return fmt.Errorf("failed to mark transaction deleted: %w", err)
+	}
+	return nil
+}
+
+// GetArchivedTransaction returns a single archived transaction
+func (c *Client) GetArchivedTransaction(ctx context.Context, id string) (models.Transaction, error) {
+	q := `SELECT ` + transactionColumns + ` FROM transactions WHERE id = $1`
+	transactions, err := c.queryTransactions(ctx, q, id)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	if len(transactions) == 0 {
+		return models.Transaction{}, errors.Wrap(errors.ErrNotFound, "transaction %s", id)
+	}
+	return transactions[0], nil
+}
+
+// ListArchivedTransactions returns archived transactions matching the query, oldest first
+func (c *Client) ListArchivedTransactions(ctx context.Context, query models.TransactionQuery) ([]models.Transaction, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if !query.Since.IsZero() {
+		where("created_at >= $%d", query.Since)
+	}
+	if !query.Until.IsZero() {
+		where("created_at < $%d", query.Until)
+	}
+	if query.AccountID != "" {
+		where("account_id = $%d", query.AccountID)
+	}
+	if query.CategoryID != "" {
+		where("category_id = $%d", query.CategoryID)
+	}
+	if query.Search != "" {
+		where("description ILIKE '%%' || $%d || '%%'", query.Search)
+	}
+	if !query.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+
+	q := `SELECT ` + transactionColumns + ` FROM transactions`
+	if len(conditions) > 0 {
+		q += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	q += ` ORDER BY created_at ASC, id ASC`
+	if query.Limit > 0 {
+		args = append(args, query.Limit)
+		q += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+	if query.Offset > 0 {
+		args = append(args, query.Offset)
+		q += fmt.Sprintf(` OFFSET $%d`, len(args))
+	}
+
+	return c.queryTransactions(ctx, q, args...)
+}
+
+func (c *Client) queryTransactions(ctx context.Context, q string, args ...interface{}) ([]models.Transaction, error) {
+	rows, err := c.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	transactions := make([]models.Transaction, 0)
+	for rows.Next() {
+		var t models.Transaction
+		var account, transaction []byte
+		err := rows.Scan(&t.ID, &t.AccountID, &t.Status, &t.Description, &t.Amount, &t.CategoryID, &t.ParentCategoryID,
+			&t.CreatedAt, &t.SettledAt, &t.DeletedAt, &t.LastEventType, &account, &transaction, &t.FirstSeenAt, &t.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		t.Account = account
+		t.Transaction = transaction
+		transactions = append(transactions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transactions: %w", err)
+	}
+	return transactions, nil
+}
@@ -0,0 +1,365 @@
+package balance
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/baely/txn/internal/balance/models"
+	"github.com/baely/txn/internal/common/errors"
+	commonHttp "github.com/baely/txn/internal/common/http"
+)
+
+// Dead-letter retry policy
+const (
+	deadLetterBaseDelay   = time.Minute
+	deadLetterMaxDelay    = 6 * time.Hour
+	deadLetterMaxAttempts = 10
+	deadLetterPollPeriod  = 30 * time.Second
+	deadLetterBatchSize   = 20
+)
+
+// inboxDeadLetterHandler is the handler recorded for inbox entries that could
+// not be processed, which are retried by returning them to the inbox
+const inboxDeadLetterHandler = "inbox"
+
+// DeadLetterStore persists failed handler deliveries
+type DeadLetterStore interface {
+	AddDeadLetter(ctx context.Context, dl models.DeadLetter) (int64, error)
+	ListDeadLetters(ctx context.Context) ([]models.DeadLetter, error)
+	DueDeadLetters(ctx context.Context, now time.Time, limit int) ([]models.DeadLetter, error)
+	GetDeadLetter(ctx context.Context, id int64) (models.DeadLetter, error)
+	UpdateDeadLetter(ctx context.Context, id int64, attempts int, lastError string, nextAttemptAt *time.Time) error
+	DeleteDeadLetter(ctx context.Context, id int64) error
+}
+
+// nextAttempt returns when a delivery that has failed attempts times should be
+// retried, or nil once retries are exhausted and only a manual retry will do
+func nextAttempt(attempts int, now time.Time) *time.Time {
+	if attempts >= deadLetterMaxAttempts {
+		return nil
+	}
+
+	delay := deadLetterBaseDelay << (attempts - 1)
+	if delay <= 0 || delay > deadLetterMaxDelay {
+		delay = deadLetterMaxDelay
+	}
+
+	t := now.Add(delay)
+	return &t
+}
+
+// deadLetter stores the failed handlers of a dispatched event
+func (s *WebhookService) deadLetter(event TransactionEvent, failures []HandlerFailure) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Error("Failed to marshal dead-lettered event", "transaction_id", event.Transaction.Id, "error", err)
+		return
+	}
+
+	// The service context may already be cancelled, and losing the record would drop the event
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, failure := range failures {
+		dl := models.DeadLetter{
+			Handler:       failure.Handler,
+			TransactionID: event.Transaction.Id,
+			Event:         data,
+			Attempts:      1,
+			LastError:     failure.Err.Error(),
+			NextAttemptAt: nextAttempt(1, time.Now()),
+		}
+		id, err := s.deadLetters.AddDeadLetter(ctx, dl)
+		if err != nil {
+			s.logger.Error("Failed to dead-letter event",
+				"handler", failure.Handler,
+				"transaction_id", event.Transaction.Id,
+				"error", err)
+			continue
+		}
+		s.logger.Warn("Dead-lettered event",
+			"id", id,
+			"handler", failure.Handler,
+			"transaction_id", event.Transaction.Id)
+	}
+}
+
+// deadLetterInbox stores an inbox entry that ran out of attempts and marks it
+// done. Its retries are manual, as whatever failed is unlikely to pass on its own.
+// It reports whether the entry was stored; if not it stays in the inbox.
+func (s *WebhookService) deadLetterInbox(entry InboxEntry, cause error) bool {
+	var transactionID string
+	if t := parseEvent(entry.Payload).Data.Relationships.Transaction; t != nil {
+		transactionID = t.Data.Id
+	}
+
+	// The service context may already be cancelled, and losing the record would drop the event
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := s.deadLetters.AddDeadLetter(ctx, models.DeadLetter{
+		Handler:       inboxDeadLetterHandler,
+		TransactionID: transactionID,
+		Event:         entry.Payload,
+		Attempts:      entry.Attempts,
+		LastError:     cause.Error(),
+	})
+	if err != nil {
+		s.logger.Error("Failed to dead-letter inbox entry", "inbox_id", entry.ID, "error", err)
+		return false
+	}
+	if err := s.inbox.MarkDone(entry.ID); err != nil {
+		s.logger.Error("Failed to mark dead-lettered inbox entry done", "inbox_id", entry.ID, "error", err)
+	}
+	s.logger.Warn("Dead-lettered inbox entry", "id", id, "inbox_id", entry.ID, "transaction_id", transactionID)
+	return true
+}
+
+// runDeadLetterRetrier periodically retries dead-lettered deliveries that are due
+func (s *WebhookService) runDeadLetterRetrier() {
+	s.logger.Info("Starting dead-letter retrier")
+
+	ticker := time.NewTicker(deadLetterPollPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		dls, err := s.deadLetters.DueDeadLetters(s.ctx, time.Now(), deadLetterBatchSize)
+		if err != nil {
+			s.logger.Error("Failed to load due dead letters", "error", err)
+			continue
+		}
+
+		for _, dl := range dls {
+			if err := s.retryDeadLetter(s.ctx, dl); err != nil && s.ctx.Err() == nil {
+				s.logger.Warn("Dead-letter retry failed", "id", dl.ID, "handler", dl.Handler, "attempts", dl.Attempts+1, "error", err)
+			}
+		}
+	}
+}
+
+// retryDeadLetter delivers a dead-lettered event to its handler again.
+// On success the dead letter is removed; otherwise the next attempt is scheduled.
+// Dead-lettered inbox entries are returned to the inbox to be processed afresh.
+func (s *WebhookService) retryDeadLetter(ctx context.Context, dl models.DeadLetter) error {
+	if dl.Handler == inboxDeadLetterHandler {
+		if _, err := s.inbox.Append(dl.Event); err != nil {
+			return err
+		}
+		return s.deadLetters.DeleteDeadLetter(ctx, dl.ID)
+	}
+
+	handler, ok := s.handler(dl.Handler)
+	if !ok {
+		return errors.Wrap(errors.ErrNotFound, "handler %s is not registered", dl.Handler)
+	}
+
+	var event TransactionEvent
+	if err := json.Unmarshal(dl.Event, &event); err != nil {
+		return errors.Wrap(err, "failed to unmarshal dead-lettered event")
+	}
+
+	result := s.deliver(ctx, handler, event)
+	if result.Err != nil {
+		// Interrupted, leave the schedule untouched
+		return result.Err
+	}
+	if len(result.Failures) == 0 {
+		s.logger.Info("Dead-letter retry succeeded", "id", dl.ID, "handler", dl.Handler)
+		return s.deadLetters.DeleteDeadLetter(ctx, dl.ID)
+	}
+
+	retryErr := result.Failures[0].Err
+	attempts := dl.Attempts + 1
+	if err := s.deadLetters.UpdateDeadLetter(ctx, dl.ID, attempts, retryErr.Error(), nextAttempt(attempts, time.Now())); err != nil {
+		return err
+	}
+	return retryErr
+}
+
+// deliver dispatches an event to a single handler and waits for the outcome
+func (s *WebhookService) deliver(ctx context.Context, handler registeredHandler, event TransactionEvent) DispatchResult {
+	done := make(chan DispatchResult, 1)
+	s.dispatcher.Dispatch(ctx, event, []registeredHandler{handler}, func(result DispatchResult) {
+		done <- result
+	})
+	return <-done
+}
+
+// handler finds a registered handler by name
+func (s *WebhookService) handler(name string) (registeredHandler, bool) {
+	for _, h := range s.transactionHandlers {
+		if h.name == name {
+			return h, true
+		}
+	}
+	return registeredHandler{}, false
+}
+
+// handleListDeadLetters lists every dead-lettered delivery
+func (s *WebhookService) handleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	dls, err := s.deadLetters.ListDeadLetters(r.Context())
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, dls)
+}
+
+// handleRetryDeadLetter retries a dead-lettered delivery immediately
+func (s *WebhookService) handleRetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, err := deadLetterID(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	dl, err := s.deadLetters.GetDeadLetter(r.Context(), id)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	if err := s.retryDeadLetter(r.Context(), dl); err != nil {
+		if errors.Is(err, errors.ErrNotFound) {
+			commonHttp.HandleError(w, err)
+			return
+		}
+		commonHttp.Success(w, map[string]string{"status": "failed", "error": err.Error()})
+		return
+	}
+	commonHttp.Success(w, map[string]string{"status": "delivered"})
+}
+
+// handleDiscardDeadLetter drops a dead-lettered delivery without retrying it
+func (s *WebhookService) handleDiscardDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, err := deadLetterID(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	if err := s.deadLetters.DeleteDeadLetter(r.Context(), id); err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	s.logger.Info("Discarded dead letter", "id", id)
+	commonHttp.Success(w, map[string]string{"status": "discarded"})
+}
+
+// deadLetterID parses the id URL parameter
+func deadLetterID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(errors.ErrInvalidInput, "invalid dead letter id")
+	}
+	return id, nil
+}
+
+// memoryDeadLetterStore is a DeadLetterStore that keeps deliveries in memory
+type memoryDeadLetterStore struct {
+	mu     sync.Mutex
+	nextID int64
+	items  []models.DeadLetter
+}
+
+func newMemoryDeadLetterStore() *memoryDeadLetterStore {
+	return &memoryDeadLetterStore{nextID: 1}
+}
+
+func (m *memoryDeadLetterStore) AddDeadLetter(ctx context.Context, dl models.DeadLetter) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	dl.ID = m.nextID
+	dl.CreatedAt = now
+	dl.UpdatedAt = now
+	m.nextID++
+	m.items = append(m.items, dl)
+	return dl.ID, nil
+}
+
+func (m *memoryDeadLetterStore) ListDeadLetters(ctx context.Context) ([]models.DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.items), nil
+}
+
+func (m *memoryDeadLetterStore) DueDeadLetters(ctx context.Context, now time.Time, limit int) ([]models.DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	due := make([]models.DeadLetter, 0)
+	for _, dl := range m.items {
+		if dl.NextAttemptAt != nil && !dl.NextAttemptAt.After(now) {
+			due = append(due, dl)
+		}
+	}
+	slices.SortFunc(due, func(a, b models.DeadLetter) int {
+		return a.NextAttemptAt.Compare(*b.NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (m *memoryDeadLetterStore) GetDeadLetter(ctx context.Context, id int64) (models.DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(id)
+	if i < 0 {
+		return models.DeadLetter{}, errors.Wrap(errors.ErrNotFound, "dead letter %d", id)
+	}
+	return m.items[i], nil
+}
+
+func (m *memoryDeadLetterStore) UpdateDeadLetter(ctx context.Context, id int64, attempts int, lastError string, nextAttemptAt *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(id)
+	if i < 0 {
+		return errors.Wrap(errors.ErrNotFound, "dead letter %d", id)
+	}
+	m.items[i].Attempts = attempts
+	m.items[i].LastError = lastError
+	m.items[i].NextAttemptAt = nextAttemptAt
+	m.items[i].UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *memoryDeadLetterStore) DeleteDeadLetter(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(id)
+	if i < 0 {
+		return errors.Wrap(errors.ErrNotFound, "dead letter %d", id)
+	}
+	m.items = slices.Delete(m.items, i, i+1)
+	return nil
+}
+
+// index returns the position of a dead letter, or -1
+// Caller must hold the mutex lock before calling this function
+func (m *memoryDeadLetterStore) index(id int64) int {
+	return slices.IndexFunc(m.items, func(dl models.DeadLetter) bool {
+		return dl.ID == id
+	})
+}
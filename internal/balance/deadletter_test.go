@@ -0,0 +1,144 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/baely/txn/internal/balance/models"
+	"github.com/baely/txn/internal/common/errors"
+)
+
+func TestNextAttempt(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		attempts int
+		want     time.Duration // Zero for no further attempt
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		{deadLetterMaxAttempts - 1, deadLetterBaseDelay << (deadLetterMaxAttempts - 2)},
+		{deadLetterMaxAttempts, 0},
+		{deadLetterMaxAttempts + 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.attempts), func(t *testing.T) {
+			got := nextAttempt(tt.attempts, now)
+			if tt.want == 0 {
+				if got != nil {
+					t.Fatalf("got %v, want no further attempt", got)
+				}
+				return
+			}
+			if got == nil || !got.Equal(now.Add(tt.want)) {
+				t.Fatalf("got %v, want %v", got, now.Add(tt.want))
+			}
+		})
+	}
+}
+
+// TestNextAttemptCapped checks that no scheduled delay passes the maximum
+func TestNextAttemptCapped(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	for attempts := 1; attempts < deadLetterMaxAttempts; attempts++ {
+		if got := nextAttempt(attempts, now); got == nil || got.Sub(now) > deadLetterMaxDelay {
+			t.Fatalf("attempt %d: got %v, want at most %v away", attempts, got, deadLetterMaxDelay)
+		}
+	}
+}
+
+// flakyHandler fails until it has been called failures times
+type flakyHandler struct {
+	failures atomic.Int32
+}
+
+func (h *flakyHandler) HandleEvent(ctx context.Context, event TransactionEvent) error {
+	if h.failures.Add(-1) >= 0 {
+		return fmt.Errorf("still failing")
+	}
+	return nil
+}
+
+func TestRetryDeadLetter(t *testing.T) {
+	service := newTestServiceWithConfig(t, nil)
+	handler := &flakyHandler{}
+	handler.failures.Store(100)
+	service.RegisterHandlerV2(handler)
+	ctx := context.Background()
+
+	// A failed delivery is dead-lettered after one attempt
+	deliver(t, service, EventTypeCreated, "evt-1", "tx-1")
+	var dls []models.DeadLetter
+	for deadline := time.Now().Add(5 * time.Second); len(dls) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("failed delivery was not dead-lettered")
+		}
+		var err error
+		if dls, err = service.deadLetters.ListDeadLetters(ctx); err != nil {
+			t.Fatalf("failed to list dead letters: %v", err)
+		}
+	}
+	dl := dls[0]
+	if dl.Handler != "*balance.flakyHandler" || dl.TransactionID != "tx-1" || dl.Attempts != 1 || dl.NextAttemptAt == nil {
+		t.Fatalf("got %+v, want a scheduled dead letter for tx-1", dl)
+	}
+
+	get := func() models.DeadLetter {
+		t.Helper()
+		dl, err := service.deadLetters.GetDeadLetter(ctx, dl.ID)
+		if err != nil {
+			t.Fatalf("failed to get dead letter: %v", err)
+		}
+		return dl
+	}
+
+	tests := []struct {
+		name      string
+		attempts  int  // Attempts before the retry
+		want      int  // Attempts after the retry
+		scheduled bool // Whether a further attempt is scheduled
+	}{
+		{"first retry fails", 1, 2, true},
+		{"last scheduled retry fails", deadLetterMaxAttempts - 1, deadLetterMaxAttempts, false},
+		{"manual retry past the limit fails", deadLetterMaxAttempts, deadLetterMaxAttempts + 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := service.deadLetters.UpdateDeadLetter(ctx, dl.ID, tt.attempts, "", nextAttempt(tt.attempts, time.Now())); err != nil {
+				t.Fatalf("failed to update dead letter: %v", err)
+			}
+			if err := service.retryDeadLetter(ctx, get()); err == nil {
+				t.Fatal("got no error from a failing retry")
+			}
+			got := get()
+			if got.Attempts != tt.want || (got.NextAttemptAt != nil) != tt.scheduled || got.LastError != "still failing" {
+				t.Fatalf("got %d attempts, next %v, error %q, want %d attempts scheduled %v", got.Attempts, got.NextAttemptAt, got.LastError, tt.want, tt.scheduled)
+			}
+		})
+	}
+
+	// Retries run out, so the dead letter is no longer due
+	due, err := service.deadLetters.DueDeadLetters(ctx, time.Now().Add(deadLetterMaxDelay), deadLetterBatchSize)
+	if err != nil || len(due) != 0 {
+		t.Fatalf("got %d due dead letters, %v, want none", len(due), err)
+	}
+
+	// A successful retry removes the dead letter
+	handler.failures.Store(0)
+	if err := service.retryDeadLetter(ctx, get()); err != nil {
+		t.Fatalf("failed to retry dead letter: %v", err)
+	}
+	if _, err := service.deadLetters.GetDeadLetter(ctx, dl.ID); !errors.Is(err, errors.ErrNotFound) {
+		t.Fatalf("got %v, want the dead letter removed", err)
+	}
+
+	// Dead letters for handlers that are no longer registered cannot be retried
+	dl.Handler = "*balance.gone"
+	if err := service.retryDeadLetter(ctx, dl); !errors.Is(err, errors.ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+}
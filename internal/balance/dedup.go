@@ -0,0 +1,224 @@
+package balance
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/baely/txn/internal/common/errors"
+)
+
+// seenRetention is how long ids are remembered. Up redelivers and settles
+// transactions within days, so older ids are dropped when the log is opened.
+const seenRetention = 90 * 24 * time.Hour
+
+// seenRecord is a single line in the dedup log
+type seenRecord struct {
+	EventID       string    `json:"event_id,omitempty"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	SeenAt        time.Time `json:"seen_at"`
+}
+
+// SeenStore remembers which webhook events and transactions have already been
+// dispatched so that redeliveries and settlement updates are not handled twice.
+// Ids are reserved in memory while their handlers run and only persisted once
+// dispatch completes, so interrupted events are not mistaken for duplicates on replay.
+type SeenStore struct {
+	mu           sync.RWMutex
+	file         *os.File
+	events       map[string]time.Time
+	transactions map[string]time.Time
+	reserved     map[string]int
+}
+
+// OpenSeenStore opens the dedup log at path, creating it if necessary.
+// Ids older than seenRetention are forgotten and the log is compacted.
+func OpenSeenStore(path string) (*SeenStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create dedup directory")
+	}
+
+	s := &SeenStore{
+		events:       make(map[string]time.Time),
+		transactions: make(map[string]time.Time),
+		reserved:     make(map[string]int),
+	}
+
+	now := time.Now()
+	if err := s.load(path, now); err != nil {
+		return nil, err
+	}
+	s.expire(now.Add(-seenRetention))
+	if err := s.compact(path); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open dedup log")
+	}
+	s.file = file
+
+	return s, nil
+}
+
+// HasEvent reports whether the webhook event has already been dispatched
+func (s *SeenStore) HasEvent(eventID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.events[eventID]
+	return ok || s.reserved["event:"+eventID] > 0
+}
+
+// HasTransaction reports whether the transaction has already been dispatched
+func (s *SeenStore) HasTransaction(transactionID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.transactions[transactionID]
+	return ok || s.reserved["transaction:"+transactionID] > 0
+}
+
+// Reserve marks a webhook event and its transaction as in flight
+func (s *SeenStore) Reserve(eventID, transactionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if eventID != "" {
+		s.reserved["event:"+eventID]++
+	}
+	if transactionID != "" {
+		s.reserved["transaction:"+transactionID]++
+	}
+}
+
+// Release drops a reservation made by Reserve
+func (s *SeenStore) Release(eventID, transactionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range []string{"event:" + eventID, "transaction:" + transactionID} {
+		if s.reserved[key] <= 1 {
+			delete(s.reserved, key)
+		} else {
+			s.reserved[key]--
+		}
+	}
+}
+
+// Record marks a webhook event and its transaction as dispatched
+func (s *SeenStore) Record(eventID, transactionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	data, err := json.Marshal(seenRecord{EventID: eventID, TransactionID: transactionID, SeenAt: now})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal dedup record")
+	}
+	data = append(data, '\n')
+
+	if _, err := s.file.Write(data); err != nil {
+		return errors.Wrap(err, "failed to write dedup record")
+	}
+
+	if eventID != "" {
+		s.events[eventID] = now
+	}
+	if transactionID != "" {
+		s.transactions[transactionID] = now
+	}
+	return nil
+}
+
+// Close closes the underlying log file
+func (s *SeenStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// load reads previously recorded ids from the log. Records written before
+// ids were timestamped count as seen now.
+func (s *SeenStore) load(path string, now time.Time) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to read dedup log")
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record seenRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		seenAt := record.SeenAt
+		if seenAt.IsZero() {
+			seenAt = now
+		}
+		if record.EventID != "" {
+			s.events[record.EventID] = seenAt
+		}
+		if record.TransactionID != "" {
+			s.transactions[record.TransactionID] = seenAt
+		}
+	}
+	return errors.Wrap(scanner.Err(), "failed to scan dedup log")
+}
+
+// expire forgets ids last seen before cutoff
+func (s *SeenStore) expire(cutoff time.Time) {
+	for _, seen := range []map[string]time.Time{s.events, s.transactions} {
+		for id, seenAt := range seen {
+			if seenAt.Before(cutoff) {
+				delete(seen, id)
+			}
+		}
+	}
+}
+
+// compact atomically replaces the log with one record per remembered id
+func (s *SeenStore) compact(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrap(err, "failed to create dedup log")
+	}
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for id, seenAt := range s.events {
+		if err := enc.Encode(seenRecord{EventID: id, SeenAt: seenAt}); err != nil {
+			file.Close()
+			return errors.Wrap(err, "failed to write dedup record")
+		}
+	}
+	for id, seenAt := range s.transactions {
+		if err := enc.Encode(seenRecord{TransactionID: id, SeenAt: seenAt}); err != nil {
+			file.Close()
+			return errors.Wrap(err, "failed to write dedup record")
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return errors.Wrap(err, "failed to flush dedup log")
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return errors.Wrap(err, "failed to sync dedup log")
+	}
+	if err := file.Close(); err != nil {
+		return errors.Wrap(err, "failed to close dedup log")
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,118 @@
+package balance
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSeenStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.log")
+	seen, err := OpenSeenStore(path)
+	if err != nil {
+		t.Fatalf("failed to open seen store: %v", err)
+	}
+	if err := seen.Record("evt-1", "tx-1"); err != nil {
+		t.Fatalf("failed to record: %v", err)
+	}
+	if err := seen.Record("evt-2", "tx-1"); err != nil {
+		t.Fatalf("failed to record: %v", err)
+	}
+
+	// Reserved ids count as seen until released, but are not persisted
+	seen.Reserve("evt-3", "tx-3")
+	if !seen.HasEvent("evt-3") || !seen.HasTransaction("tx-3") {
+		t.Fatal("reserved ids are not seen")
+	}
+	seen.Release("evt-3", "tx-3")
+	seen.Reserve("evt-4", "tx-4")
+	if err := seen.Close(); err != nil {
+		t.Fatalf("failed to close seen store: %v", err)
+	}
+
+	seen, err = OpenSeenStore(path)
+	if err != nil {
+		t.Fatalf("failed to reopen seen store: %v", err)
+	}
+	defer seen.Close()
+
+	tests := []struct {
+		id   string
+		has  func(string) bool
+		want bool
+	}{
+		{"evt-1", seen.HasEvent, true},
+		{"evt-2", seen.HasEvent, true},
+		{"evt-3", seen.HasEvent, false},
+		{"evt-4", seen.HasEvent, false},
+		{"tx-1", seen.HasTransaction, true},
+		{"tx-3", seen.HasTransaction, false},
+		{"tx-4", seen.HasTransaction, false},
+		{"tx-1", seen.HasEvent, false},
+		{"evt-1", seen.HasTransaction, false},
+	}
+	for _, tt := range tests {
+		if got := tt.has(tt.id); got != tt.want {
+			t.Errorf("%s: got seen %v, want %v", tt.id, got, tt.want)
+		}
+	}
+
+	// Compaction keeps one record per id: evt-1, evt-2 and tx-1
+	if got := countLines(t, path); got != 3 {
+		t.Fatalf("got %d records after reopening, want 3", got)
+	}
+}
+
+// TestSeenStoreRetention checks that ids older than the retention window are
+// forgotten when the log is opened, and that untimestamped records are kept
+func TestSeenStoreRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.log")
+	now := time.Now()
+	records := []seenRecord{
+		{EventID: "evt-old", TransactionID: "tx-old", SeenAt: now.Add(-seenRetention - time.Hour)},
+		{EventID: "evt-new", TransactionID: "tx-new", SeenAt: now.Add(-seenRetention + time.Hour)},
+		{EventID: "evt-legacy", TransactionID: "tx-legacy"},
+		// A later record refreshes an id
+		{EventID: "evt-settled", TransactionID: "tx-settled", SeenAt: now.Add(-seenRetention - time.Hour)},
+		{TransactionID: "tx-settled", SeenAt: now},
+	}
+	var data []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			t.Fatalf("failed to marshal record: %v", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	seen, err := OpenSeenStore(path)
+	if err != nil {
+		t.Fatalf("failed to open seen store: %v", err)
+	}
+	defer seen.Close()
+
+	tests := []struct {
+		id   string
+		has  func(string) bool
+		want bool
+	}{
+		{"evt-old", seen.HasEvent, false},
+		{"tx-old", seen.HasTransaction, false},
+		{"evt-new", seen.HasEvent, true},
+		{"tx-new", seen.HasTransaction, true},
+		{"evt-legacy", seen.HasEvent, true},
+		{"tx-legacy", seen.HasTransaction, true},
+		{"evt-settled", seen.HasEvent, false},
+		{"tx-settled", seen.HasTransaction, true},
+	}
+	for _, tt := range tests {
+		if got := tt.has(tt.id); got != tt.want {
+			t.Errorf("%s: got seen %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
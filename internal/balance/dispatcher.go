@@ -0,0 +1,195 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// Default dispatcher settings
+const (
+	DefaultHandlerWorkers = 4
+	dispatchQueueSize     = 64
+)
+
+// DispatcherConfig contains configuration for the Dispatcher
+type DispatcherConfig struct {
+	Workers            int  // Maximum number of handlers running at once
+	SerializeByAccount bool // Handle events from the same account in order
+	Logger             *slog.Logger
+}
+
+// Dispatcher runs transaction event handlers on a bounded pool of workers.
+// A panicking handler is recovered and treated as a failed delivery.
+type Dispatcher struct {
+	queues    []chan dispatchJob
+	serialize bool
+	logger    *slog.Logger
+	wg        sync.WaitGroup
+}
+
+// dispatchJob is a single handler invocation for an event
+type dispatchJob struct {
+	ctx     context.Context
+	handler registeredHandler
+	event   TransactionEvent
+	group   *dispatchGroup
+}
+
+// HandlerFailure is a handler that failed to process a dispatched event
+type HandlerFailure struct {
+	Handler string
+	Err     error
+}
+
+// DispatchResult describes how the handlers for an event fared
+type DispatchResult struct {
+	Err      error            // Context error if dispatch was interrupted
+	Failures []HandlerFailure // Handlers that returned an error or panicked
+}
+
+// dispatchGroup tracks the handler invocations for one event
+type dispatchGroup struct {
+	remaining atomic.Int32
+	ctx       context.Context
+	onDone    func(DispatchResult)
+
+	mu       sync.Mutex
+	failures []HandlerFailure
+}
+
+// fail records a handler failure
+func (g *dispatchGroup) fail(handler string, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.failures = append(g.failures, HandlerFailure{Handler: handler, Err: err})
+}
+
+// finish records that n handler invocations have completed
+func (g *dispatchGroup) finish(n int32) {
+	if g.remaining.Add(-n) == 0 {
+		g.mu.Lock()
+		result := DispatchResult{Err: g.ctx.Err(), Failures: g.failures}
+		g.mu.Unlock()
+		g.onDone(result)
+	}
+}
+
+// NewDispatcher creates a dispatcher and starts its workers
+func NewDispatcher(cfg DispatcherConfig) *Dispatcher {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = DefaultHandlerWorkers
+	}
+
+	d := &Dispatcher{
+		serialize: cfg.SerializeByAccount,
+		logger:    cfg.Logger,
+	}
+
+	// Serialized dispatch gives every worker its own queue so that jobs for
+	// the same account always land on the same worker; otherwise they share one
+	queues := 1
+	if d.serialize {
+		queues = workers
+	}
+	for range queues {
+		d.queues = append(d.queues, make(chan dispatchJob, dispatchQueueSize))
+	}
+
+	for i := range workers {
+		d.wg.Add(1)
+		go d.work(d.queues[i%queues])
+	}
+
+	return d
+}
+
+// Dispatch queues an event for every handler. onDone is called exactly once,
+// after all handlers have finished, with the outcome of each.
+func (d *Dispatcher) Dispatch(ctx context.Context, event TransactionEvent, handlers []registeredHandler, onDone func(DispatchResult)) {
+	group := &dispatchGroup{ctx: ctx, onDone: onDone}
+	group.remaining.Store(int32(len(handlers)))
+	if len(handlers) == 0 {
+		onDone(DispatchResult{Err: ctx.Err()})
+		return
+	}
+
+	for i, handler := range handlers {
+		job := dispatchJob{ctx: ctx, handler: handler, event: event, group: group}
+		select {
+		case d.queue(job) <- job:
+		case <-ctx.Done():
+			// The remaining handlers will never run
+			group.finish(int32(len(handlers) - i))
+			return
+		}
+	}
+}
+
+// Close stops the workers once every queued job has run.
+// Dispatch must not be called after Close.
+func (d *Dispatcher) Close() {
+	for _, q := range d.queues {
+		close(q)
+	}
+	d.wg.Wait()
+}
+
+// queue selects the queue a job is sent to
+func (d *Dispatcher) queue(job dispatchJob) chan dispatchJob {
+	if !d.serialize {
+		return d.queues[0]
+	}
+
+	// Deleted transactions that were never archived carry no account, so fall
+	// back to the transaction
+	key := job.event.Account.Id
+	if key == "" {
+		key = job.event.Transaction.Id
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	h.Write([]byte(job.handler.name))
+	return d.queues[h.Sum32()%uint32(len(d.queues))]
+}
+
+// work runs jobs from a queue until it is closed
+func (d *Dispatcher) work(queue chan dispatchJob) {
+	defer d.wg.Done()
+	for job := range queue {
+		if err := d.invoke(job); err != nil {
+			d.logger.Error("Handler failed to process event",
+				"handler", job.handler.name,
+				"transaction_id", job.event.Transaction.Id,
+				"error", err)
+			job.group.fail(job.handler.name, err)
+		}
+		job.group.finish(1)
+	}
+}
+
+// invoke calls a handler with its timeout, converting a panic into an error
+func (d *Dispatcher) invoke(job dispatchJob) (err error) {
+	ctx, cancel := context.WithTimeout(job.ctx, job.handler.timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			d.logger.Error("Handler panicked",
+				"handler", job.handler.name,
+				"transaction_id", job.event.Transaction.Id,
+				"panic", r,
+				"stack", string(debug.Stack()))
+			err = fmt.Errorf("handler %s panicked: %v", job.handler.name, r)
+		}
+	}()
+
+	return job.handler.handler.HandleEvent(ctx, job.event)
+}
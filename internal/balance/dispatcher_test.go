@@ -0,0 +1,167 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+// handlerFunc adapts a function to TransactionEventHandlerV2
+type handlerFunc func(ctx context.Context, event TransactionEvent) error
+
+func (f handlerFunc) HandleEvent(ctx context.Context, event TransactionEvent) error {
+	return f(ctx, event)
+}
+
+func newTestDispatcher(workers int, serialize bool) *Dispatcher {
+	return NewDispatcher(DispatcherConfig{
+		Workers:            workers,
+		SerializeByAccount: serialize,
+		Logger:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+}
+
+func testHandler(name string, f handlerFunc) registeredHandler {
+	return registeredHandler{name: name, handler: f, timeout: time.Second}
+}
+
+// accountEvent builds an event for a transaction on an account
+func accountEvent(accountID, transactionID string) TransactionEvent {
+	var event TransactionEvent
+	event.Account = model.AccountResource{Id: accountID}
+	event.Transaction.Id = transactionID
+	return event
+}
+
+// wait waits for a dispatch result
+func wait(t *testing.T, results chan DispatchResult) DispatchResult {
+	t.Helper()
+	select {
+	case result := <-results:
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatch did not finish")
+		return DispatchResult{}
+	}
+}
+
+func TestDispatcherRecoversPanics(t *testing.T) {
+	d := newTestDispatcher(2, false)
+	defer d.Close()
+
+	handlers := []registeredHandler{
+		testHandler("panics", func(ctx context.Context, event TransactionEvent) error {
+			panic("boom")
+		}),
+		testHandler("fails", func(ctx context.Context, event TransactionEvent) error {
+			return fmt.Errorf("failed")
+		}),
+		testHandler("succeeds", func(ctx context.Context, event TransactionEvent) error {
+			return nil
+		}),
+	}
+
+	results := make(chan DispatchResult, 1)
+	d.Dispatch(context.Background(), accountEvent("acc-1", "tx-1"), handlers, func(result DispatchResult) {
+		results <- result
+	})
+	result := wait(t, results)
+	if result.Err != nil || len(result.Failures) != 2 {
+		t.Fatalf("got %+v, want the two failing handlers", result)
+	}
+	failed := make(map[string]error)
+	for _, f := range result.Failures {
+		failed[f.Handler] = f.Err
+	}
+	if err := failed["panics"]; err == nil || !strings.Contains(err.Error(), "panicked: boom") {
+		t.Fatalf("got %v for the panicking handler, want the panic as an error", err)
+	}
+	if failed["fails"] == nil {
+		t.Fatal("failing handler was not reported")
+	}
+
+	// The workers survive the panic
+	d.Dispatch(context.Background(), accountEvent("acc-1", "tx-2"), handlers[2:], func(result DispatchResult) {
+		results <- result
+	})
+	if result := wait(t, results); result.Err != nil || len(result.Failures) != 0 {
+		t.Fatalf("got %+v after a panic, want success", result)
+	}
+}
+
+// TestDispatcherAccountOrder checks that events for an account are handled in
+// the order they were dispatched, even when earlier ones are slower
+func TestDispatcherAccountOrder(t *testing.T) {
+	d := newTestDispatcher(8, true)
+	defer d.Close()
+
+	var mu sync.Mutex
+	handled := make(map[string][]string)
+	handler := testHandler("records", func(ctx context.Context, event TransactionEvent) error {
+		// Earlier transactions take longer
+		var n int
+		fmt.Sscanf(event.Transaction.Id, "tx-%d", &n)
+		time.Sleep(time.Duration(10-n) * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		handled[event.Account.Id] = append(handled[event.Account.Id], event.Transaction.Id)
+		return nil
+	})
+
+	accounts := []string{"acc-1", "acc-2", "acc-3"}
+	results := make(chan DispatchResult, 30)
+	for i := range 10 {
+		for _, account := range accounts {
+			d.Dispatch(context.Background(), accountEvent(account, fmt.Sprintf("tx-%d", i)), []registeredHandler{handler}, func(result DispatchResult) {
+				results <- result
+			})
+		}
+	}
+	for range 30 {
+		wait(t, results)
+	}
+
+	want := []string{"tx-0", "tx-1", "tx-2", "tx-3", "tx-4", "tx-5", "tx-6", "tx-7", "tx-8", "tx-9"}
+	for _, account := range accounts {
+		if got := handled[account]; !slices.Equal(got, want) {
+			t.Errorf("%s: got %v, want %v", account, got, want)
+		}
+	}
+}
+
+// TestDispatcherCloseDrains checks that Close, which Shutdown relies on, runs
+// every queued job before returning
+func TestDispatcherCloseDrains(t *testing.T) {
+	d := newTestDispatcher(1, false)
+
+	var mu sync.Mutex
+	var done []string
+	handler := testHandler("slow", func(ctx context.Context, event TransactionEvent) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+	for i := range 5 {
+		id := fmt.Sprintf("tx-%d", i)
+		d.Dispatch(context.Background(), accountEvent("acc-1", id), []registeredHandler{handler}, func(result DispatchResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			done = append(done, id)
+		})
+	}
+	d.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(done) != 5 {
+		t.Fatalf("got %d events finished when Close returned, want 5", len(done))
+	}
+}
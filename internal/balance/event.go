@@ -7,10 +7,29 @@ import (
 	"github.com/baely/balance/pkg/model"
 )
 
+// EventType identifies why a transaction event was dispatched
+type EventType string
+
+// Event types, named after the Up webhook event types they originate from
+const (
+	// EventTypeCreated is dispatched the first time a transaction is seen
+	EventTypeCreated EventType = "TRANSACTION_CREATED"
+	// EventTypeSettled is dispatched when a previously seen transaction settles
+	EventTypeSettled EventType = "TRANSACTION_SETTLED"
+	// EventTypeDeleted is dispatched when Up deletes a transaction
+	EventTypeDeleted EventType = "TRANSACTION_DELETED"
+	// EventTypeBackfill is dispatched when a historical transaction is replayed
+	EventTypeBackfill EventType = "TRANSACTION_BACKFILL"
+	// EventTypePing is sent by Up when a webhook is pinged and carries no transaction
+	EventTypePing EventType = "PING"
+)
+
 // TransactionEvent contains information about a bank transaction
 type TransactionEvent struct {
-	Account     model.AccountResource     // Account details
-	Transaction model.TransactionResource // Transaction details
+	Type           EventType                 `json:"type"`                       // Why the event was dispatched
+	WebhookEventID string                    `json:"webhook_event_id,omitempty"` // ID of the Up webhook event that triggered dispatch
+	Account        model.AccountResource     `json:"account"`                    // Account details
+	Transaction    model.TransactionResource `json:"transaction"`                // Transaction details
 }
 
 // TransactionEventHandler defines the interface for handling transaction events
@@ -20,10 +39,21 @@ type TransactionEventHandler interface {
 	HandleEvent(event TransactionEvent) error
 }
 
+// TransactionEventHandlerV2 defines the interface for context-aware transaction event handlers
+type TransactionEventHandlerV2 interface {
+	// HandleEvent processes a transaction event
+	// The context is cancelled when the handler's timeout elapses or the service shuts down
+	// Returns an error if the handling fails
+	HandleEvent(ctx context.Context, event TransactionEvent) error
+}
+
 // EventService defines the interface for event processing services
 type EventService interface {
 	// RegisterHandler registers a handler for transaction events
 	RegisterHandler(handler TransactionEventHandler)
+
+	// RegisterHandlerV2 registers a context-aware handler for transaction events
+	RegisterHandlerV2(handler TransactionEventHandlerV2, opts ...HandlerOption)
 	
 	// ProcessEvent processes a transaction event
 	ProcessEvent(ctx context.Context, event TransactionEvent) error
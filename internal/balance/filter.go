@@ -0,0 +1,159 @@
+package balance
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Direction is whether money left or entered an account
+type Direction string
+
+const (
+	DirectionDebit  Direction = "debit"  // Purchases, negative amounts
+	DirectionCredit Direction = "credit" // Refunds and deposits, positive amounts
+)
+
+// Uncategorised matches transactions without a category in EventFilter.Categories
+const Uncategorised = "uncategorised"
+
+// EventFilter selects which events a handler receives. Empty fields match
+// everything, and an event must match every field that is set.
+// Deleted events only carry ids, so they are matched on EventTypes alone.
+type EventFilter struct {
+	EventTypes       []EventType `json:"event_types,omitempty"`
+	AccountIDs       []string    `json:"account_ids,omitempty"`
+	AccountTypes     []string    `json:"account_types,omitempty"`     // Up account types, such as TRANSACTIONAL or SAVER
+	Categories       []string    `json:"categories,omitempty"`        // Up category ids, or Uncategorised
+	ParentCategories []string    `json:"parent_categories,omitempty"` // Up parent category ids, such as good-life
+	MerchantPattern  string      `json:"merchant_pattern,omitempty"`  // Case-insensitive regular expression on the description or raw text
+	MinAmount        *int        `json:"min_amount,omitempty"`        // Smallest absolute amount in cents
+	MaxAmount        *int        `json:"max_amount,omitempty"`        // Largest absolute amount in cents
+	Direction        Direction   `json:"direction,omitempty"`
+}
+
+// String describes the fields that are set, for logging
+func (f EventFilter) String() string {
+	var parts []string
+	add := func(name string, value any) {
+		parts = append(parts, fmt.Sprintf("%s=%v", name, value))
+	}
+	if len(f.EventTypes) > 0 {
+		add("event_types", f.EventTypes)
+	}
+	if len(f.AccountIDs) > 0 {
+		add("account_ids", f.AccountIDs)
+	}
+	if len(f.AccountTypes) > 0 {
+		add("account_types", f.AccountTypes)
+	}
+	if len(f.Categories) > 0 {
+		add("categories", f.Categories)
+	}
+	if len(f.ParentCategories) > 0 {
+		add("parent_categories", f.ParentCategories)
+	}
+	if f.MerchantPattern != "" {
+		add("merchant_pattern", f.MerchantPattern)
+	}
+	if f.MinAmount != nil {
+		add("min_amount", *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		add("max_amount", *f.MaxAmount)
+	}
+	if f.Direction != "" {
+		add("direction", f.Direction)
+	}
+	if len(parts) == 0 {
+		return "all events"
+	}
+	return strings.Join(parts, " ")
+}
+
+// eventMatcher is a compiled EventFilter
+type eventMatcher struct {
+	filter   EventFilter
+	merchant *regexp.Regexp
+}
+
+// newEventMatcher compiles a filter, panicking if the merchant pattern is invalid
+// since filters are fixed when handlers are registered at startup
+func newEventMatcher(filter EventFilter) *eventMatcher {
+	m := &eventMatcher{filter: filter}
+	if filter.MerchantPattern != "" {
+		m.merchant = regexp.MustCompile("(?i)" + filter.MerchantPattern)
+	}
+	return m
+}
+
+// Match reports whether an event passes the filter
+func (m *eventMatcher) Match(event TransactionEvent) bool {
+	f := m.filter
+
+	if len(f.EventTypes) > 0 && !slices.Contains(f.EventTypes, event.Type) {
+		return false
+	}
+	if event.Type == EventTypeDeleted {
+		return true
+	}
+
+	if len(f.AccountIDs) > 0 && !slices.Contains(f.AccountIDs, event.Account.Id) {
+		return false
+	}
+	if len(f.AccountTypes) > 0 && !slices.Contains(f.AccountTypes, string(event.Account.Attributes.AccountType)) {
+		return false
+	}
+
+	relationships := event.Transaction.Relationships
+	if len(f.Categories) > 0 {
+		category := Uncategorised
+		if relationships.Category.Data != nil {
+			category = relationships.Category.Data.Id
+		}
+		if !slices.Contains(f.Categories, category) {
+			return false
+		}
+	}
+	if len(f.ParentCategories) > 0 {
+		if relationships.ParentCategory.Data == nil || !slices.Contains(f.ParentCategories, relationships.ParentCategory.Data.Id) {
+			return false
+		}
+	}
+
+	if m.merchant != nil {
+		attributes := event.Transaction.Attributes
+		matched := m.merchant.MatchString(attributes.Description)
+		if !matched && attributes.RawText != nil {
+			matched = m.merchant.MatchString(*attributes.RawText)
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	amount := event.Transaction.Attributes.Amount.ValueInBaseUnits
+	switch f.Direction {
+	case DirectionDebit:
+		if amount >= 0 {
+			return false
+		}
+	case DirectionCredit:
+		if amount <= 0 {
+			return false
+		}
+	}
+
+	if amount < 0 {
+		amount = -amount
+	}
+	if f.MinAmount != nil && amount < *f.MinAmount {
+		return false
+	}
+	if f.MaxAmount != nil && amount > *f.MaxAmount {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,112 @@
+package balance
+
+import (
+	"testing"
+
+	"github.com/baely/txn/internal/balance/uptest"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+// cafePurchase builds a created event for a café purchase on a transactional account
+func cafePurchase(change func(t *uptest.Transaction)) TransactionEvent {
+	transaction := uptest.Transaction{
+		ID:          "tx-1",
+		AccountID:   "acc-1",
+		Description: "Chia Chia Pty Ltd",
+		RawText:     "SQ *CHIA CHIA DOCKLANDS",
+		Amount:      -680,
+		Category:    "restaurants-and-cafes",
+		Parent:      "good-life",
+	}
+	if change != nil {
+		change(&transaction)
+	}
+	return TransactionEvent{
+		Type:        EventTypeCreated,
+		Account:     uptest.NewAccount("acc-1", "Spending"),
+		Transaction: uptest.NewTransaction(transaction),
+	}
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	purchase := cafePurchase(nil)
+	refund := cafePurchase(func(t *uptest.Transaction) { t.Amount = 680 })
+	uncategorised := cafePurchase(func(t *uptest.Transaction) { t.Category, t.Parent = "", "" })
+	settled := purchase
+	settled.Type = EventTypeSettled
+	var deleted TransactionEvent
+	deleted.Type = EventTypeDeleted
+	deleted.Transaction.Id = "tx-1"
+
+	tests := []struct {
+		name   string
+		filter EventFilter
+		event  TransactionEvent
+		want   bool
+	}{
+		{"empty filter", EventFilter{}, purchase, true},
+		{"event type", EventFilter{EventTypes: []EventType{EventTypeCreated}}, purchase, true},
+		{"other event type", EventFilter{EventTypes: []EventType{EventTypeCreated}}, settled, false},
+		{"account", EventFilter{AccountIDs: []string{"acc-1"}}, purchase, true},
+		{"other account", EventFilter{AccountIDs: []string{"acc-2"}}, purchase, false},
+		{"account type", EventFilter{AccountTypes: []string{"TRANSACTIONAL"}}, purchase, true},
+		{"other account type", EventFilter{AccountTypes: []string{"SAVER"}}, purchase, false},
+		{"category", EventFilter{Categories: []string{"groceries", "restaurants-and-cafes"}}, purchase, true},
+		{"other category", EventFilter{Categories: []string{"groceries"}}, purchase, false},
+		{"uncategorised", EventFilter{Categories: []string{Uncategorised}}, uncategorised, true},
+		{"uncategorised not wanted", EventFilter{Categories: []string{"restaurants-and-cafes"}}, uncategorised, false},
+		{"parent category", EventFilter{ParentCategories: []string{"good-life"}}, purchase, true},
+		{"no parent category", EventFilter{ParentCategories: []string{"good-life"}}, uncategorised, false},
+		{"merchant in the description", EventFilter{MerchantPattern: "^chia chia"}, purchase, true},
+		{"merchant in the raw text", EventFilter{MerchantPattern: "docklands$"}, purchase, true},
+		{"other merchant", EventFilter{MerchantPattern: "charlie bit me"}, purchase, false},
+		{"debit", EventFilter{Direction: DirectionDebit}, purchase, true},
+		{"debit refund", EventFilter{Direction: DirectionDebit}, refund, false},
+		{"credit", EventFilter{Direction: DirectionCredit}, refund, true},
+		{"credit purchase", EventFilter{Direction: DirectionCredit}, purchase, false},
+		{"within amounts", EventFilter{MinAmount: intPtr(680), MaxAmount: intPtr(680)}, purchase, true},
+		{"refund within amounts", EventFilter{MinAmount: intPtr(500), MaxAmount: intPtr(700)}, refund, true},
+		{"under the minimum", EventFilter{MinAmount: intPtr(681)}, purchase, false},
+		{"over the maximum", EventFilter{MaxAmount: intPtr(679)}, purchase, false},
+		{"every field", EventFilter{
+			EventTypes:       []EventType{EventTypeCreated},
+			AccountIDs:       []string{"acc-1"},
+			AccountTypes:     []string{"TRANSACTIONAL"},
+			Categories:       []string{"restaurants-and-cafes"},
+			ParentCategories: []string{"good-life"},
+			MerchantPattern:  "chia",
+			MinAmount:        intPtr(100),
+			MaxAmount:        intPtr(1000),
+			Direction:        DirectionDebit,
+		}, purchase, true},
+		{"one field fails", EventFilter{Categories: []string{"restaurants-and-cafes"}, Direction: DirectionCredit}, purchase, false},
+		{"deleted with other fields", EventFilter{Categories: []string{"restaurants-and-cafes"}, Direction: DirectionDebit}, deleted, true},
+		{"deleted by event type", EventFilter{EventTypes: []EventType{EventTypeCreated}}, deleted, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newEventMatcher(tt.filter).Match(tt.event); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventFilterString(t *testing.T) {
+	tests := []struct {
+		filter EventFilter
+		want   string
+	}{
+		{EventFilter{}, "all events"},
+		{EventFilter{Categories: []string{"restaurants-and-cafes"}, Direction: DirectionDebit}, "categories=[restaurants-and-cafes] direction=debit"},
+		{EventFilter{MinAmount: intPtr(100)}, "min_amount=100"},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultHandlerTimeout bounds how long a handler may spend on a single event
+const DefaultHandlerTimeout = 30 * time.Second
+
+// registeredHandler is a handler along with its dispatch settings
+type registeredHandler struct {
+	name    string
+	handler TransactionEventHandlerV2
+	timeout time.Duration
+	filter  *eventMatcher // Nil receives every event
+}
+
+// HandlerInfo describes a registered handler
+type HandlerInfo struct {
+	Name    string       `json:"name"`
+	Timeout string       `json:"timeout"`
+	Filter  *EventFilter `json:"filter,omitempty"`
+}
+
+// info describes the handler for logs and the admin API
+func (h registeredHandler) info() HandlerInfo {
+	info := HandlerInfo{
+		Name:    h.name,
+		Timeout: h.timeout.String(),
+	}
+	if h.filter != nil {
+		info.Filter = &h.filter.filter
+	}
+	return info
+}
+
+// wants reports whether the handler subscribes to an event
+func (h registeredHandler) wants(event TransactionEvent) bool {
+	return h.filter == nil || h.filter.Match(event)
+}
+
+// HandlerOption configures how events are dispatched to a handler
+type HandlerOption func(*registeredHandler)
+
+// WithTimeout sets the maximum time the handler may spend on a single event
+func WithTimeout(timeout time.Duration) HandlerOption {
+	return func(h *registeredHandler) {
+		h.timeout = timeout
+	}
+}
+
+// WithFilter only dispatches events that match the filter to the handler
+func WithFilter(filter EventFilter) HandlerOption {
+	return func(h *registeredHandler) {
+		h.filter = newEventMatcher(filter)
+	}
+}
+
+// legacyHandler adapts a TransactionEventHandler to TransactionEventHandlerV2.
+// The context is only checked before the handler is called.
+type legacyHandler struct {
+	handler TransactionEventHandler
+}
+
+// HandleEvent calls the wrapped handler unless the context is already done
+func (h legacyHandler) HandleEvent(ctx context.Context, event TransactionEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return h.handler.HandleEvent(event)
+}
+
+// handlerName returns a human readable name for a handler
+func handlerName(handler any) string {
+	if h, ok := handler.(legacyHandler); ok {
+		handler = h.handler
+	}
+	return fmt.Sprintf("%T", handler)
+}
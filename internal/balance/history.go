@@ -0,0 +1,77 @@
+package balance
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/baely/txn/internal/balance/models"
+	"github.com/baely/txn/internal/common/errors"
+)
+
+// historyPageSize is how many archived transactions are read at a time
+const historyPageSize = 1000
+
+// History replays archived transactions as events
+type History struct {
+	archive TransactionArchive
+}
+
+// NewHistory creates a History over a transaction archive
+func NewHistory(archive TransactionArchive) *History {
+	return &History{archive: archive}
+}
+
+// History returns the archive of transactions this service has seen
+func (s *WebhookService) History() *History {
+	return NewHistory(s.archive)
+}
+
+// ArchivedEvents returns every archived transaction created in [since, until), oldest first.
+// Zero times leave the range open. Transactions Up has since deleted are returned
+// as EventTypeDeleted and the rest as EventTypeBackfill.
+func (h *History) ArchivedEvents(ctx context.Context, since, until time.Time) ([]TransactionEvent, error) {
+	query := models.TransactionQuery{
+		Since:          since,
+		Until:          until,
+		IncludeDeleted: true,
+		Limit:          historyPageSize,
+	}
+
+	events := make([]TransactionEvent, 0)
+	for {
+		page, err := h.archive.ListArchivedTransactions(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range page {
+			eventType := EventTypeBackfill
+			if t.DeletedAt != nil {
+				eventType = EventTypeDeleted
+			}
+			event, err := archivedEvent(t, eventType)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		}
+
+		if len(page) < historyPageSize {
+			return events, nil
+		}
+		query.Offset += len(page)
+	}
+}
+
+// archivedEvent rebuilds an event from an archive record
+func archivedEvent(t models.Transaction, eventType EventType) (TransactionEvent, error) {
+	event := TransactionEvent{Type: eventType}
+	if err := json.Unmarshal(t.Account, &event.Account); err != nil {
+		return TransactionEvent{}, errors.Wrap(err, "failed to unmarshal archived account %s", t.AccountID)
+	}
+	if err := json.Unmarshal(t.Transaction, &event.Transaction); err != nil {
+		return TransactionEvent{}, errors.Wrap(err, "failed to unmarshal archived transaction %s", t.ID)
+	}
+	return event, nil
+}
@@ -0,0 +1,266 @@
+package balance
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/baely/txn/internal/common/errors"
+)
+
+// InboxEntry is a webhook payload that has been durably accepted
+type InboxEntry struct {
+	ID         string    `json:"id"`
+	ReceivedAt time.Time `json:"received_at"`
+	Payload    []byte    `json:"payload"`
+	Attempts   int       `json:"-"` // Failed attempts to process it since the inbox was opened
+}
+
+// inboxRecord is a single line in the inbox log
+type inboxRecord struct {
+	Op         string    `json:"op"`
+	ID         string    `json:"id"`
+	ReceivedAt time.Time `json:"received_at,omitempty"`
+	Payload    []byte    `json:"payload,omitempty"`
+}
+
+const (
+	inboxOpAdd  = "add"
+	inboxOpDone = "done"
+)
+
+// Inbox is an append-only log of webhook payloads awaiting processing.
+// Payloads are written and synced to disk before they are acknowledged,
+// and entries that were never marked done are replayed when the inbox is reopened.
+type Inbox struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	queue  []InboxEntry
+	notify chan struct{}
+}
+
+// OpenInbox opens the inbox log at path, creating it if necessary.
+// Unprocessed entries from a previous run are queued for processing.
+func OpenInbox(path string) (*Inbox, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create inbox directory")
+	}
+
+	pending, err := readInbox(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compact the log so it only contains entries that still need processing
+	if err := writeInbox(path, pending); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open inbox")
+	}
+
+	i := &Inbox{
+		path:   path,
+		file:   file,
+		queue:  pending,
+		notify: make(chan struct{}, 1),
+	}
+	if len(pending) > 0 {
+		i.notify <- struct{}{}
+	}
+
+	return i, nil
+}
+
+// Append durably stores a payload and queues it for processing
+func (i *Inbox) Append(payload []byte) (InboxEntry, error) {
+	id, err := newInboxID()
+	if err != nil {
+		return InboxEntry{}, err
+	}
+
+	entry := InboxEntry{
+		ID:         id,
+		ReceivedAt: time.Now(),
+		Payload:    payload,
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if err := i.write(inboxRecord{Op: inboxOpAdd, ID: entry.ID, ReceivedAt: entry.ReceivedAt, Payload: entry.Payload}); err != nil {
+		return InboxEntry{}, err
+	}
+
+	i.queue = append(i.queue, entry)
+	select {
+	case i.notify <- struct{}{}:
+	default:
+	}
+
+	return entry, nil
+}
+
+// Next blocks until an entry is available or the context is cancelled
+func (i *Inbox) Next(ctx context.Context) (InboxEntry, error) {
+	for {
+		i.mu.Lock()
+		if len(i.queue) > 0 {
+			entry := i.queue[0]
+			i.queue = i.queue[1:]
+			i.mu.Unlock()
+			return entry, nil
+		}
+		i.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return InboxEntry{}, ctx.Err()
+		case <-i.notify:
+		}
+	}
+}
+
+// Requeue queues an entry that could not be processed to be handed out again
+func (i *Inbox) Requeue(entry InboxEntry) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.queue = append(i.queue, entry)
+	select {
+	case i.notify <- struct{}{}:
+	default:
+	}
+}
+
+// MarkDone records that an entry has been processed and must not be replayed
+func (i *Inbox) MarkDone(id string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.write(inboxRecord{Op: inboxOpDone, ID: id})
+}
+
+// Close closes the underlying log file
+func (i *Inbox) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.file.Close()
+}
+
+// write appends a record to the log and syncs it to disk
+// Caller must hold the mutex lock before calling this function
+func (i *Inbox) write(record inboxRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal inbox record")
+	}
+	data = append(data, '\n')
+
+	if _, err := i.file.Write(data); err != nil {
+		return errors.Wrap(err, "failed to write inbox record")
+	}
+	if err := i.file.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync inbox")
+	}
+	return nil
+}
+
+// readInbox returns the entries in the log that have not been marked done
+func readInbox(path string) ([]InboxEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to read inbox")
+	}
+	defer file.Close()
+
+	var order []string
+	entries := make(map[string]InboxEntry)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record inboxRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A torn final write from a crash; everything before it is intact
+			continue
+		}
+
+		switch record.Op {
+		case inboxOpAdd:
+			order = append(order, record.ID)
+			entries[record.ID] = InboxEntry{
+				ID:         record.ID,
+				ReceivedAt: record.ReceivedAt,
+				Payload:    record.Payload,
+			}
+		case inboxOpDone:
+			delete(entries, record.ID)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to scan inbox")
+	}
+
+	pending := make([]InboxEntry, 0, len(entries))
+	for _, id := range order {
+		if entry, ok := entries[id]; ok {
+			pending = append(pending, entry)
+		}
+	}
+	return pending, nil
+}
+
+// writeInbox atomically replaces the log with the given pending entries
+func writeInbox(path string, pending []InboxEntry) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrap(err, "failed to create inbox")
+	}
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, entry := range pending {
+		record := inboxRecord{Op: inboxOpAdd, ID: entry.ID, ReceivedAt: entry.ReceivedAt, Payload: entry.Payload}
+		if err := enc.Encode(record); err != nil {
+			file.Close()
+			return errors.Wrap(err, "failed to write inbox record")
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return errors.Wrap(err, "failed to flush inbox")
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return errors.Wrap(err, "failed to sync inbox")
+	}
+	if err := file.Close(); err != nil {
+		return errors.Wrap(err, "failed to close inbox")
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// newInboxID returns a random identifier for an inbox entry
+func newInboxID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate inbox id")
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,126 @@
+package balance
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baely/txn/internal/common/errors"
+)
+
+// next takes the next inbox entry, failing the test if there is none
+func next(t *testing.T, inbox *Inbox) InboxEntry {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	entry, err := inbox.Next(ctx)
+	if err != nil {
+		t.Fatalf("failed to take an entry: %v", err)
+	}
+	return entry
+}
+
+// countLines returns how many records are in a log file
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	defer file.Close()
+	n := 0
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		n++
+	}
+	return n
+}
+
+func TestInboxAppend(t *testing.T) {
+	inbox, err := OpenInbox(filepath.Join(t.TempDir(), "inbox.log"))
+	if err != nil {
+		t.Fatalf("failed to open inbox: %v", err)
+	}
+	defer inbox.Close()
+
+	first, err := inbox.Append([]byte(`{"n":1}`))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, err := inbox.Append([]byte(`{"n":2}`)); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	if got := next(t, inbox); got.ID != first.ID || string(got.Payload) != `{"n":1}` {
+		t.Fatalf("got %s %s, want the first entry", got.ID, got.Payload)
+	}
+	if got := next(t, inbox); string(got.Payload) != `{"n":2}` {
+		t.Fatalf("got %s, want the second entry", got.Payload)
+	}
+
+	// Requeued entries are handed out again
+	inbox.Requeue(first)
+	if got := next(t, inbox); got.ID != first.ID {
+		t.Fatalf("got %s, want the requeued entry %s", got.ID, first.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := inbox.Next(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v from an empty inbox, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// TestInboxReplay checks that entries not marked done are replayed in order
+// when the inbox is reopened, and that reopening compacts the log
+func TestInboxReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox.log")
+	inbox, err := OpenInbox(path)
+	if err != nil {
+		t.Fatalf("failed to open inbox: %v", err)
+	}
+	var ids []string
+	for _, payload := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		entry, err := inbox.Append([]byte(payload))
+		if err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+		ids = append(ids, entry.ID)
+	}
+	if err := inbox.MarkDone(ids[1]); err != nil {
+		t.Fatalf("failed to mark done: %v", err)
+	}
+	if err := inbox.Close(); err != nil {
+		t.Fatalf("failed to close inbox: %v", err)
+	}
+
+	// A crash mid-write leaves a torn final record
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	if _, err := file.WriteString(`{"op":"add","id":"torn`); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+	file.Close()
+	if got := countLines(t, path); got != 5 {
+		t.Fatalf("got %d records before reopening, want 5", got)
+	}
+
+	inbox, err = OpenInbox(path)
+	if err != nil {
+		t.Fatalf("failed to reopen inbox: %v", err)
+	}
+	defer inbox.Close()
+
+	for _, want := range []string{ids[0], ids[2]} {
+		if got := next(t, inbox); got.ID != want {
+			t.Fatalf("got %s, want %s", got.ID, want)
+		}
+	}
+	if got := countLines(t, path); got != 2 {
+		t.Fatalf("got %d records after reopening, want the log compacted to 2", got)
+	}
+}
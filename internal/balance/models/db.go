@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DeadLetter is a handler delivery that failed and is waiting to be retried
+type DeadLetter struct {
+	ID            int64           `json:"id"`
+	Handler       string          `json:"handler"`
+	TransactionID string          `json:"transaction_id"`
+	Event         json.RawMessage `json:"event"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"last_error"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at"` // nil once retries are exhausted
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// Transaction is an enriched Up transaction kept in the archive.
+// The columns used for querying are copied out of the raw Up resources.
+type Transaction struct {
+	ID               string          `json:"id"`
+	AccountID        string          `json:"account_id"`
+	Status           string          `json:"status"`
+	Description      string          `json:"description"`
+	Amount           int             `json:"amount"` // Value in cents, negative for purchases
+	CategoryID       *string         `json:"category_id"`
+	ParentCategoryID *string         `json:"parent_category_id"`
+	CreatedAt        time.Time       `json:"created_at"`
+	SettledAt        *time.Time      `json:"settled_at"`
+	DeletedAt        *time.Time      `json:"deleted_at,omitempty"` // Set once Up reports the transaction deleted
+	LastEventType    string          `json:"last_event_type"`
+	Account          json.RawMessage `json:"account"`     // Up account resource
+	Transaction      json.RawMessage `json:"transaction"` // Up transaction resource
+	FirstSeenAt      time.Time       `json:"first_seen_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
+
+// TransactionQuery filters archived transactions. Zero fields match everything.
+type TransactionQuery struct {
+	Since          time.Time // Created at or after
+	Until          time.Time // Created before
+	AccountID      string
+	CategoryID     string
+	Search         string // Case-insensitive substring of the description
+	IncludeDeleted bool
+	Limit          int
+	Offset         int
+}
@@ -0,0 +1,179 @@
+package balance
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/baely/txn/internal/common/errors"
+)
+
+// WebhookSecret is a secret Up may sign webhook deliveries with.
+// Several can be active at once so the webhook can be rotated without rejecting deliveries.
+type WebhookSecret struct {
+	ID       string    `json:"id"`                  // Name to log when the secret matches, such as the Up webhook id
+	Secret   string    `json:"secret"`              // Secret key returned by Up when the webhook was created
+	NotAfter time.Time `json:"not_after,omitempty"` // Secret is no longer accepted after this time, if set
+}
+
+// expired reports whether the secret is no longer accepted at now
+func (ws WebhookSecret) expired(now time.Time) bool {
+	return !ws.NotAfter.IsZero() && now.After(ws.NotAfter)
+}
+
+// withID returns the secret with an id derived from the secret itself if it has none
+func (ws WebhookSecret) withID() WebhookSecret {
+	if ws.ID == "" {
+		sum := sha256.Sum256([]byte(ws.Secret))
+		ws.ID = "sha256:" + hex.EncodeToString(sum[:4])
+	}
+	return ws
+}
+
+// WebhookSecrets is the set of secrets accepted for webhook deliveries.
+// Secrets from the config are fixed; the secrets file is reread whenever it changes,
+// so a secret can be added or retired without restarting the service.
+type WebhookSecrets struct {
+	mu      sync.Mutex
+	static  []WebhookSecret
+	path    string
+	modTime time.Time
+	file    []WebhookSecret
+	matched map[string]time.Time // When each secret last matched a delivery
+	logger  *slog.Logger
+}
+
+// WebhookSecretStatus describes a configured secret without revealing it
+type WebhookSecretStatus struct {
+	ID            string     `json:"id"`
+	NotAfter      *time.Time `json:"not_after,omitempty"`
+	Expired       bool       `json:"expired"`
+	LastMatchedAt *time.Time `json:"last_matched_at,omitempty"` // Since the service started
+}
+
+// NewWebhookSecrets creates a secret set from fixed secrets and an optional secrets file.
+// The file holds a JSON array of WebhookSecret.
+func NewWebhookSecrets(static []WebhookSecret, path string, logger *slog.Logger) (*WebhookSecrets, error) {
+	s := &WebhookSecrets{
+		path:    path,
+		matched: make(map[string]time.Time),
+		logger:  logger,
+	}
+	for _, secret := range static {
+		if secret.Secret != "" {
+			s.static = append(s.static, secret.withID())
+		}
+	}
+
+	if path != "" {
+		if err := s.reload(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Match returns the active secret that signature was made with.
+// A signature made with an expired secret does not match and is logged.
+func (s *WebhookSecrets) Match(payload []byte, signature string, now time.Time) (WebhookSecret, bool) {
+	s.mu.Lock()
+	if s.path != "" {
+		if err := s.reload(); err != nil {
+			s.logger.Error("Failed to reload webhook secrets, using previous secrets", "path", s.path, "error", err)
+		}
+	}
+	secrets := append(append([]WebhookSecret{}, s.static...), s.file...)
+	s.mu.Unlock()
+
+	for _, secret := range secrets {
+		if !ValidateWebhookEvent(payload, signature, secret.Secret) {
+			continue
+		}
+		if secret.expired(now) {
+			s.logger.Warn("Webhook signed with expired secret", "secret_id", secret.ID, "not_after", secret.NotAfter)
+			continue
+		}
+
+		s.mu.Lock()
+		s.matched[secret.ID] = now
+		s.mu.Unlock()
+		return secret, true
+	}
+	return WebhookSecret{}, false
+}
+
+// Active returns the secrets that are accepted at now
+func (s *WebhookSecrets) Active(now time.Time) []WebhookSecret {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := make([]WebhookSecret, 0, len(s.static)+len(s.file))
+	for _, secret := range append(append([]WebhookSecret{}, s.static...), s.file...) {
+		if !secret.expired(now) {
+			active = append(active, secret)
+		}
+	}
+	return active
+}
+
+// Status describes every configured secret and when it last matched a delivery
+func (s *WebhookSecrets) Status(now time.Time) []WebhookSecretStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]WebhookSecretStatus, 0, len(s.static)+len(s.file))
+	for _, secret := range append(append([]WebhookSecret{}, s.static...), s.file...) {
+		status := WebhookSecretStatus{
+			ID:      secret.ID,
+			Expired: secret.expired(now),
+		}
+		if !secret.NotAfter.IsZero() {
+			notAfter := secret.NotAfter
+			status.NotAfter = &notAfter
+		}
+		if t, ok := s.matched[secret.ID]; ok {
+			status.LastMatchedAt = &t
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// reload rereads the secrets file if it has changed since it was last read
+// Caller must hold the mutex lock before calling this function
+func (s *WebhookSecrets) reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return errors.Wrap(err, "failed to stat webhook secrets file")
+	}
+	if info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return errors.Wrap(err, "failed to read webhook secrets file")
+	}
+
+	var secrets []WebhookSecret
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return errors.Wrap(err, "failed to parse webhook secrets file")
+	}
+
+	loaded := make([]WebhookSecret, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret.Secret != "" {
+			loaded = append(loaded, secret.withID())
+		}
+	}
+	s.file = loaded
+	s.modTime = info.ModTime()
+
+	s.logger.Info("Loaded webhook secrets", "path", s.path, "count", len(s.file))
+	return nil
+}
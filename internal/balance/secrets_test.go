@@ -0,0 +1,135 @@
+package balance
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baely/txn/internal/balance/uptest"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestWebhookSecretsRotation(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	secrets, err := NewWebhookSecrets([]WebhookSecret{
+		{ID: "old", Secret: "old-secret", NotAfter: now.Add(time.Hour)},
+		{ID: "new", Secret: "new-secret"},
+		{ID: "empty"},
+	}, "", testLogger)
+	if err != nil {
+		t.Fatalf("failed to create secrets: %v", err)
+	}
+
+	payload := []byte(`{"data":{}}`)
+	tests := []struct {
+		name   string
+		secret string
+		at     time.Time
+		want   string // Matching secret id, empty for none
+	}{
+		{"old secret in the grace window", "old-secret", now, "old"},
+		{"old secret at the end of the window", "old-secret", now.Add(time.Hour), "old"},
+		{"old secret after the window", "old-secret", now.Add(time.Hour + time.Second), ""},
+		{"new secret", "new-secret", now, "new"},
+		{"new secret after the window", "new-secret", now.Add(24 * time.Hour), "new"},
+		{"unknown secret", "other-secret", now, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret, ok := secrets.Match(payload, uptest.SignPayload(tt.secret, payload), tt.at)
+			if ok != (tt.want != "") || secret.ID != tt.want {
+				t.Fatalf("got %q matched %v, want %q", secret.ID, ok, tt.want)
+			}
+		})
+	}
+
+	if active := secrets.Active(now.Add(2 * time.Hour)); len(active) != 1 || active[0].ID != "new" {
+		t.Fatalf("got %+v, want only the new secret active", active)
+	}
+	statuses := secrets.Status(now.Add(2 * time.Hour))
+	if len(statuses) != 2 || statuses[0].ID != "old" || !statuses[0].Expired || statuses[0].NotAfter == nil || statuses[1].Expired {
+		t.Fatalf("got %+v, want the old secret expired and the new one not", statuses)
+	}
+	if statuses[1].LastMatchedAt == nil || !statuses[1].LastMatchedAt.Equal(now.Add(24*time.Hour)) {
+		t.Fatalf("got %v, want the new secret last matched a day later", statuses[1].LastMatchedAt)
+	}
+}
+
+// TestWebhookSecretsReload checks that the secrets file is reread when it
+// changes, and that a broken file leaves the previous secrets in place
+func TestWebhookSecretsReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	modTime := time.Now()
+	write := func(data []byte) {
+		t.Helper()
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("failed to write secrets file: %v", err)
+		}
+		// Make each write visible even on filesystems with coarse timestamps
+		modTime = modTime.Add(time.Second)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("failed to touch secrets file: %v", err)
+		}
+	}
+	writeSecrets := func(secrets ...WebhookSecret) {
+		t.Helper()
+		data, err := json.Marshal(secrets)
+		if err != nil {
+			t.Fatalf("failed to marshal secrets: %v", err)
+		}
+		write(data)
+	}
+
+	if _, err := NewWebhookSecrets(nil, path, testLogger); err == nil {
+		t.Fatal("got no error for a missing secrets file")
+	}
+
+	writeSecrets(WebhookSecret{ID: "first", Secret: "first-secret"})
+	secrets, err := NewWebhookSecrets([]WebhookSecret{{Secret: "config-secret"}}, path, testLogger)
+	if err != nil {
+		t.Fatalf("failed to create secrets: %v", err)
+	}
+
+	// Secrets without an id are named after a hash of the secret
+	configID := WebhookSecret{Secret: "config-secret"}.withID().ID
+	payload := []byte(`{"data":{}}`)
+	match := func(secret string) string {
+		got, _ := secrets.Match(payload, uptest.SignPayload(secret, payload), time.Now())
+		return got.ID
+	}
+
+	steps := []struct {
+		name   string
+		change func()
+		want   map[string]string // Secret to the id it matches, empty for none
+	}{
+		{"initial file", func() {}, map[string]string{"first-secret": "first", "config-secret": configID, "second-secret": ""}},
+		{"secret added", func() {
+			writeSecrets(WebhookSecret{ID: "first", Secret: "first-secret"}, WebhookSecret{ID: "second", Secret: "second-secret"})
+		}, map[string]string{"first-secret": "first", "second-secret": "second"}},
+		{"secret retired", func() {
+			writeSecrets(WebhookSecret{ID: "second", Secret: "second-secret"})
+		}, map[string]string{"first-secret": "", "second-secret": "second"}},
+		{"broken file keeps the previous secrets", func() {
+			write([]byte(`[{"id": "third", "secret": `))
+		}, map[string]string{"second-secret": "second", "config-secret": configID}},
+		{"file removed keeps the previous secrets", func() {
+			if err := os.Remove(path); err != nil {
+				t.Fatalf("failed to remove secrets file: %v", err)
+			}
+		}, map[string]string{"second-secret": "second"}},
+	}
+	for _, step := range steps {
+		step.change()
+		for secret, want := range step.want {
+			if got := match(secret); got != want {
+				t.Errorf("%s: %s matched %q, want %q", step.name, secret, got, want)
+			}
+		}
+	}
+}
@@ -9,53 +9,180 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/baely/balance/pkg/model"
 )
 
-const upBaseUri = "https://api.up.com.au/api/v1/"
+// DefaultUpBaseURL is the base URL of the production Up API
+const DefaultUpBaseURL = "https://api.up.com.au/api/v1/"
+
+// Retry policy for Up API requests
+const (
+	defaultMaxRetries = 3
+	retryBaseDelay    = 500 * time.Millisecond
+	retryMaxDelay     = 30 * time.Second
+)
 
 type UpClient struct {
 	accessToken string
+	baseURL     string
 	client      *http.Client
+	maxRetries  int
+}
+
+// UpClientOption configures an UpClient
+type UpClientOption func(*UpClient)
+
+// WithBaseURL points the client at a different Up API, such as a fake for tests
+func WithBaseURL(baseURL string) UpClientOption {
+	return func(c *UpClient) {
+		if baseURL != "" {
+			c.baseURL = strings.TrimSuffix(baseURL, "/") + "/"
+		}
+	}
 }
 
-func NewUpClient(accessToken string) *UpClient {
-	return &UpClient{
+// WithHTTPClient sets the HTTP client used to send requests
+func WithHTTPClient(client *http.Client) UpClientOption {
+	return func(c *UpClient) {
+		c.client = client
+	}
+}
+
+func NewUpClient(accessToken string, opts ...UpClientOption) *UpClient {
+	c := &UpClient{
 		accessToken: accessToken,
+		baseURL:     DefaultUpBaseURL,
 		client:      &http.Client{},
+		maxRetries:  defaultMaxRetries,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *UpClient) request(ctx context.Context, endpoint string, ret interface{}) error {
-	var b []byte
-	r := bytes.NewBuffer(b)
+	uri := fmt.Sprintf("%s%s", c.baseURL, endpoint)
+	return c.requestURI(ctx, uri, ret)
+}
+
+// requestURI performs a GET against an absolute Up API URI, such as a pagination link
+func (c *UpClient) requestURI(ctx context.Context, uri string, ret interface{}) error {
+	return c.send(ctx, http.MethodGet, uri, nil, ret)
+}
+
+// send performs a request against an absolute Up API URI, encoding body as JSON if set.
+// Network errors, 5xx responses and rate limiting are retried with backoff.
+// POST requests are only retried when rate limited, as Up may have acted on them.
+func (c *UpClient) send(ctx context.Context, method, uri string, body interface{}, ret interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
 
-	uri := fmt.Sprintf("%s%s", upBaseUri, endpoint)
+	var err error
+	for attempt := 0; ; attempt++ {
+		var delay time.Duration
+		delay, err = c.do(ctx, method, uri, payload, ret)
+		if err == nil || delay < 0 || attempt >= c.maxRetries {
+			return err
+		}
+		if method == http.MethodPost && !isRateLimited(err) {
+			return err
+		}
+
+		if delay == 0 {
+			delay = backoff(attempt)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, r)
+// do sends a single request. Alongside any error it returns how long to wait
+// before retrying, zero to use the default backoff, or -1 if retrying is pointless.
+func (c *UpClient) do(ctx context.Context, method, uri string, payload []byte, ret interface{}) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri, bytes.NewReader(payload))
 	if err != nil {
-		return err
+		return -1, err
 	}
 
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.accessToken))
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return err
+		if ctx.Err() != nil {
+			return -1, ctx.Err()
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		// The body is best effort; the status code alone is enough to classify the error
+		_ = json.NewDecoder(resp.Body).Decode(apiErr)
+
+		if !apiErr.retryable() {
+			return -1, apiErr
+		}
+		return retryAfter(resp.Header.Get("Retry-After")), apiErr
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("request failed with status: %d", resp.StatusCode)
+	if ret == nil || resp.StatusCode == http.StatusNoContent {
+		return 0, nil
 	}
 
 	err = json.NewDecoder(resp.Body).Decode(ret)
 	if err != nil {
-		return err
+		return -1, err
 	}
 
-	return nil
+	return 0, nil
+}
+
+// backoff returns the delay before the given retry attempt
+func backoff(attempt int) time.Duration {
+	delay := retryBaseDelay << attempt
+	if delay <= 0 || delay > retryMaxDelay {
+		return retryMaxDelay
+	}
+	return delay
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+// It returns zero if the header is missing or invalid.
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(header); err == nil {
+		delay = time.Until(t)
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+	return min(delay, retryMaxDelay)
 }
 
 func (c *UpClient) GetAccount(ctx context.Context, accountId string) (model.AccountResource, error) {
@@ -84,9 +211,70 @@ func (c *UpClient) GetTransaction(ctx context.Context, transactionId string) (mo
 	return resp.Data, nil
 }
 
-func ValidateWebhookEvent(payload []byte, signature string) bool {
+// ListTransactionsOptions filters the transactions returned by ListTransactions
+type ListTransactionsOptions struct {
+	Since    time.Time // Only transactions created at or after this time
+	Until    time.Time // Only transactions created before this time
+	Category string    // Only transactions in this category
+	PageSize int       // Number of transactions per page, up to 100
+}
+
+// listTransactionsResponse is a single page of transactions
+type listTransactionsResponse struct {
+	Data  []model.TransactionResource `json:"data"`
+	Links pageLinks                   `json:"links"`
+}
+
+// ListTransactions returns an iterator over all transactions matching the options,
+// newest first. It follows Up's pagination links until every page has been read
+// and stops at the first error, which is yielded with a zero transaction.
+func (c *UpClient) ListTransactions(ctx context.Context, opts ListTransactionsOptions) func(yield func(model.TransactionResource, error) bool) {
+	query := url.Values{}
+	pageSize := opts.PageSize
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 100
+	}
+	query.Set("page[size]", strconv.Itoa(pageSize))
+	if !opts.Since.IsZero() {
+		query.Set("filter[since]", opts.Since.Format(time.RFC3339))
+	}
+	if !opts.Until.IsZero() {
+		query.Set("filter[until]", opts.Until.Format(time.RFC3339))
+	}
+	if opts.Category != "" {
+		query.Set("filter[category]", opts.Category)
+	}
+
+	return func(yield func(model.TransactionResource, error) bool) {
+		uri := fmt.Sprintf("%stransactions?%s", c.baseURL, query.Encode())
+		for uri != "" {
+			var resp listTransactionsResponse
+			if err := c.requestURI(ctx, uri, &resp); err != nil {
+				yield(model.TransactionResource{}, err)
+				return
+			}
+
+			for _, transaction := range resp.Data {
+				if !yield(transaction, nil) {
+					return
+				}
+			}
+
+			uri = ""
+			if resp.Links.Next != nil {
+				uri = *resp.Links.Next
+			}
+		}
+	}
+}
+
+// ValidateWebhookEvent reports whether signature is the HMAC-SHA256 of payload under secret.
+// An empty secret never validates.
+func ValidateWebhookEvent(payload []byte, signature string, secret string) bool {
+	if secret == "" {
+		return false
+	}
 	sig, _ := hex.DecodeString(signature)
-	secret := os.Getenv("UP_WEBHOOK_SECRET")
 	mac := hmac.New(sha256.New, []byte(secret))
 	mac.Write(payload)
 	calculatedSignature := mac.Sum(nil)
@@ -0,0 +1,212 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+
+	"github.com/baely/txn/internal/balance/uptest"
+	"github.com/baely/txn/internal/common/errors"
+)
+
+// scriptedResponse is one response from a scriptedServer
+type scriptedResponse struct {
+	status     int
+	retryAfter string
+}
+
+// scriptedServer answers requests with a fixed sequence of responses, the last
+// repeating, and records the methods it was sent
+type scriptedServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	responses []scriptedResponse
+	methods   []string
+}
+
+func newScriptedServer(t *testing.T, responses ...scriptedResponse) *scriptedServer {
+	s := &scriptedServer{responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		resp := s.responses[min(len(s.methods), len(s.responses)-1)]
+		s.methods = append(s.methods, r.Method)
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if resp.retryAfter != "" {
+			w.Header().Set("Retry-After", resp.retryAfter)
+		}
+		w.WriteHeader(resp.status)
+		if resp.status == http.StatusOK {
+			fmt.Fprintf(w, `{"data":{"type":"accounts","id":"acc-1"}}`)
+		} else {
+			fmt.Fprintf(w, `{"errors":[{"status":"%d","title":"Failed","detail":"Scripted failure."}]}`, resp.status)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// requests returns how many requests the server received
+func (s *scriptedServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.methods)
+}
+
+func TestUpClientRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		responses []scriptedResponse
+		requests  int
+		want      error // Nil for success
+		minDelay  time.Duration
+	}{
+		{"success", http.MethodGet, []scriptedResponse{{status: 200}}, 1, nil, 0},
+		{"server error then success", http.MethodGet, []scriptedResponse{{status: 500}, {status: 200}}, 2, nil, retryBaseDelay},
+		{"rate limited then success", http.MethodGet, []scriptedResponse{{status: 429, retryAfter: "1"}, {status: 200}}, 2, nil, time.Second},
+		{"gives up after the retries", http.MethodGet, []scriptedResponse{{status: 503}}, 2, errors.ErrUnavailable, retryBaseDelay},
+		{"not found is not retried", http.MethodGet, []scriptedResponse{{status: 404}}, 1, errors.ErrNotFound, 0},
+		{"unauthorized is not retried", http.MethodGet, []scriptedResponse{{status: 401}}, 1, errors.ErrUnauthorized, 0},
+		{"post is not retried on a server error", http.MethodPost, []scriptedResponse{{status: 500}, {status: 200}}, 1, errors.ErrUnavailable, 0},
+		{"post is retried when rate limited", http.MethodPost, []scriptedResponse{{status: 429, retryAfter: "1"}, {status: 200}}, 2, nil, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newScriptedServer(t, tt.responses...)
+			c := NewUpClient(testAccessToken, WithBaseURL(server.URL))
+			c.maxRetries = 1
+
+			var body any
+			if tt.method == http.MethodPost {
+				body = map[string]string{"ping": "pong"}
+			}
+			var resp model.GetAccountResponse
+			start := time.Now()
+			err := c.send(context.Background(), tt.method, server.URL+"/accounts/acc-1", body, &resp)
+			elapsed := time.Since(start)
+
+			if got := server.requests(); got != tt.requests {
+				t.Fatalf("got %d requests, want %d", got, tt.requests)
+			}
+			if tt.want == nil {
+				if err != nil || resp.Data.Id != "acc-1" {
+					t.Fatalf("got %q, %v, want acc-1", resp.Data.Id, err)
+				}
+			} else if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if elapsed < tt.minDelay {
+				t.Fatalf("took %v, want at least %v between attempts", elapsed, tt.minDelay)
+			}
+		})
+	}
+}
+
+// TestUpClientRetryCancelled checks that a cancelled context stops the retry wait
+func TestUpClientRetryCancelled(t *testing.T) {
+	server := newScriptedServer(t, scriptedResponse{status: 429, retryAfter: "30"})
+	c := NewUpClient(testAccessToken, WithBaseURL(server.URL))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetAccount(ctx, "acc-1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got := server.requests(); got != 1 {
+		t.Fatalf("got %d requests, want 1", got)
+	}
+}
+
+// TestUpClientNotFound checks the error for a missing resource on the fake Up API
+func TestUpClientNotFound(t *testing.T) {
+	up := uptest.NewServer(testAccessToken)
+	defer up.Close()
+	c := NewUpClient(testAccessToken, WithBaseURL(up.BaseURL()))
+
+	_, err := c.GetTransaction(context.Background(), "tx-missing")
+	if !errors.Is(err, errors.ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || len(apiErr.Errors) != 1 {
+		t.Fatalf("got %#v, want a 404 APIError with Up's error", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"missing", "", 0, 0},
+		{"seconds", "5", 5 * time.Second, 5 * time.Second},
+		{"zero seconds", "0", 0, 0},
+		{"negative seconds", "-5", 0, 0},
+		{"seconds past the maximum", "3600", retryMaxDelay, retryMaxDelay},
+		{"http date", time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 8 * time.Second, 10 * time.Second},
+		{"http date in the past", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+		{"http date past the maximum", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), retryMaxDelay, retryMaxDelay},
+		{"invalid", "soon", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfter(tt.header); got < tt.min || got > tt.max {
+				t.Fatalf("got %v, want between %v and %v", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestAPIErrorUnwrap(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusBadRequest, errors.ErrInvalidInput},
+		{http.StatusUnauthorized, errors.ErrUnauthorized},
+		{http.StatusForbidden, errors.ErrUnauthorized},
+		{http.StatusNotFound, errors.ErrNotFound},
+		{http.StatusUnprocessableEntity, errors.ErrInvalidInput},
+		{http.StatusTooManyRequests, errors.ErrUnavailable},
+		{http.StatusInternalServerError, errors.ErrUnavailable},
+		{http.StatusBadGateway, errors.ErrUnavailable},
+		{http.StatusMultipleChoices, errors.ErrInternal},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			// Callers see the API error wrapped with context
+			err := errors.Wrap(&APIError{StatusCode: tt.status}, "failed to retrieve transaction tx-1")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want it to match %v", err, tt.want)
+			}
+			if tt.want != errors.ErrNotFound && errors.Is(err, errors.ErrNotFound) {
+				t.Fatalf("got %v matching ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestAPIErrorMessage(t *testing.T) {
+	err := &APIError{StatusCode: 422, Errors: []APIErrorObject{
+		{Title: "Invalid Parameter", Detail: "filter[since] is not a date."},
+		{Title: "Too Many Filters"},
+	}}
+	want := "up api request failed with status 422: Invalid Parameter: filter[since] is not a date.; Too Many Filters"
+	if got := err.Error(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got := (&APIError{StatusCode: 503}).Error(); !strings.HasSuffix(got, "status 503") {
+		t.Fatalf("got %q, want just the status", got)
+	}
+}
@@ -0,0 +1,71 @@
+package balance
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/baely/txn/internal/common/errors"
+)
+
+// APIErrorObject is a single JSON:API error object returned by Up
+type APIErrorObject struct {
+	Status string `json:"status"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Source *struct {
+		Parameter string `json:"parameter,omitempty"`
+		Pointer   string `json:"pointer,omitempty"`
+	} `json:"source,omitempty"`
+}
+
+// APIError is a non-success response from the Up API.
+// It unwraps to the matching error in internal/common/errors, so callers can use
+// errors.Is(err, errors.ErrNotFound) to tell a missing resource from an outage.
+type APIError struct {
+	StatusCode int
+	Errors     []APIErrorObject `json:"errors"`
+}
+
+// Error describes the response status and the errors Up reported
+func (e *APIError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("up api request failed with status %d", e.StatusCode)
+	}
+
+	details := make([]string, 0, len(e.Errors))
+	for _, obj := range e.Errors {
+		if obj.Detail != "" {
+			details = append(details, fmt.Sprintf("%s: %s", obj.Title, obj.Detail))
+		} else {
+			details = append(details, obj.Title)
+		}
+	}
+	return fmt.Sprintf("up api request failed with status %d: %s", e.StatusCode, strings.Join(details, "; "))
+}
+
+// Unwrap maps the response status onto a common error
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusNotFound:
+		return errors.ErrNotFound
+	case e.StatusCode == http.StatusUnauthorized, e.StatusCode == http.StatusForbidden:
+		return errors.ErrUnauthorized
+	case e.StatusCode == http.StatusTooManyRequests, e.StatusCode >= 500:
+		return errors.ErrUnavailable
+	case e.StatusCode >= 400:
+		return errors.ErrInvalidInput
+	}
+	return errors.ErrInternal
+}
+
+// retryable reports whether the request may succeed if it is sent again
+func (e *APIError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// isRateLimited reports whether err is a rate limited response from Up
+func isRateLimited(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
@@ -0,0 +1,119 @@
+package uptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+)
+
+// Transaction describes a transaction to seed into the fake server
+type Transaction struct {
+	ID          string
+	AccountID   string
+	Description string
+	RawText     string
+	Amount      int    // Value in cents, negative for purchases
+	Category    string // Up category id, such as restaurants-and-cafes
+	Parent      string // Up parent category id, such as good-life
+	Status      string // Defaults to SETTLED
+	CreatedAt   time.Time
+}
+
+// NewAccount builds an AUD transactional account resource
+func NewAccount(id, displayName string) model.AccountResource {
+	var account model.AccountResource
+	mustBuild(map[string]any{
+		"type": "accounts",
+		"id":   id,
+		"attributes": map[string]any{
+			"displayName":   displayName,
+			"accountType":   "TRANSACTIONAL",
+			"ownershipType": "INDIVIDUAL",
+			"balance":       money(0),
+			"createdAt":     time.Now().Format(time.RFC3339),
+		},
+	}, &account)
+	return account
+}
+
+// NewTransaction builds a transaction resource in the shape Up returns
+func NewTransaction(t Transaction) model.TransactionResource {
+	status := t.Status
+	if status == "" {
+		status = "SETTLED"
+	}
+	createdAt := t.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	var rawText, settledAt, category, parent any
+	if t.RawText != "" {
+		rawText = t.RawText
+	}
+	if status == "SETTLED" {
+		settledAt = createdAt.Format(time.RFC3339)
+	}
+	if t.Category != "" {
+		category = map[string]string{"type": "categories", "id": t.Category}
+	}
+	if t.Parent != "" {
+		parent = map[string]string{"type": "categories", "id": t.Parent}
+	}
+
+	var transaction model.TransactionResource
+	mustBuild(map[string]any{
+		"type": "transactions",
+		"id":   t.ID,
+		"attributes": map[string]any{
+			"status":      status,
+			"rawText":     rawText,
+			"description": t.Description,
+			"message":     nil,
+			"amount":      money(t.Amount),
+			"settledAt":   settledAt,
+			"createdAt":   createdAt.Format(time.RFC3339),
+		},
+		"relationships": map[string]any{
+			"account": map[string]any{
+				"data": map[string]string{"type": "accounts", "id": t.AccountID},
+			},
+			"category": map[string]any{
+				"data": category,
+			},
+			"parentCategory": map[string]any{
+				"data": parent,
+			},
+		},
+	}, &transaction)
+	return transaction
+}
+
+// money builds an AUD money object from a value in cents
+func money(cents int) map[string]any {
+	sign := ""
+	abs := cents
+	if cents < 0 {
+		sign = "-"
+		abs = -cents
+	}
+	return map[string]any{
+		"currencyCode":     "AUD",
+		"value":            fmt.Sprintf("%s%d.%02d", sign, abs/100, abs%100),
+		"valueInBaseUnits": cents,
+	}
+}
+
+// mustBuild converts a JSON-shaped value into a model type.
+// Going through JSON keeps the builders independent of the model's nested struct types.
+func mustBuild(v any, out any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		panic(err)
+	}
+}
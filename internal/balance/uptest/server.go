@@ -0,0 +1,230 @@
+// Package uptest provides an in-process fake of the Up API and helpers for
+// building signed webhook deliveries, so the webhook path can run without network
+package uptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baely/balance/pkg/model"
+	"github.com/go-chi/chi/v5"
+)
+
+// Server is a fake Up API backed by httptest.
+// Point an UpClient at BaseURL() and authenticate with AccessToken.
+type Server struct {
+	*httptest.Server
+	AccessToken string
+
+	mu           sync.RWMutex
+	accounts     map[string]model.AccountResource
+	transactions map[string]model.TransactionResource
+	webhooks     map[string]*webhook
+	nextID       int
+}
+
+// NewServer starts a fake Up API that accepts the given access token
+func NewServer(accessToken string) *Server {
+	s := &Server{
+		AccessToken:  accessToken,
+		accounts:     make(map[string]model.AccountResource),
+		transactions: make(map[string]model.TransactionResource),
+		webhooks:     make(map[string]*webhook),
+	}
+
+	r := chi.NewRouter()
+	r.Use(s.authenticate)
+	r.Get("/api/v1/util/ping", s.handlePing)
+	r.Get("/api/v1/accounts/{id}", s.handleGetAccount)
+	r.Get("/api/v1/transactions", s.handleListTransactions)
+	r.Get("/api/v1/transactions/{id}", s.handleGetTransaction)
+	r.Get("/api/v1/webhooks", s.handleListWebhooks)
+	r.Post("/api/v1/webhooks", s.handleCreateWebhook)
+	r.Get("/api/v1/webhooks/{id}", s.handleGetWebhook)
+	r.Delete("/api/v1/webhooks/{id}", s.handleDeleteWebhook)
+	r.Post("/api/v1/webhooks/{id}/ping", s.handlePingWebhook)
+	r.Get("/api/v1/webhooks/{id}/logs", s.handleWebhookLogs)
+
+	s.Server = httptest.NewServer(r)
+	return s
+}
+
+// BaseURL returns the base URL to configure an UpClient with
+func (s *Server) BaseURL() string {
+	return s.URL + "/api/v1/"
+}
+
+// AddAccount seeds an account
+func (s *Server) AddAccount(account model.AccountResource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accounts[account.Id] = account
+}
+
+// AddTransaction seeds a transaction, replacing any with the same id
+func (s *Server) AddTransaction(transaction model.TransactionResource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.transactions[transaction.Id] = transaction
+}
+
+// DeleteTransaction removes a transaction, as Up does when it deletes one
+func (s *Server) DeleteTransaction(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.transactions, id)
+}
+
+// authenticate rejects requests without the expected bearer token
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+s.AccessToken {
+			writeError(w, http.StatusUnauthorized, "Not Authorized", "The request was not authenticated because no valid credential was found in the Authorization header, or the Authorization header was not present.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handlePing(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"meta": map[string]string{
+			"id":          "uptest",
+			"statusEmoji": "⚡️",
+		},
+	})
+}
+
+func (s *Server) handleGetAccount(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	account, ok := s.accounts[chi.URLParam(r, "id")]
+	s.mu.RUnlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found", "The requested account could not be found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, model.GetAccountResponse{Data: account})
+}
+
+func (s *Server) handleGetTransaction(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	transaction, ok := s.transactions[chi.URLParam(r, "id")]
+	s.mu.RUnlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found", "The requested transaction could not be found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, model.GetTransactionResponse{Data: transaction})
+}
+
+// handleListTransactions returns transactions newest first, honouring Up's
+// page[size], filter[since], filter[until] and filter[category] parameters
+func (s *Server) handleListTransactions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	pageSize := 10
+	if v := query.Get("page[size]"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			writeError(w, http.StatusBadRequest, "Invalid Parameter", "page[size] must be between 1 and 100.")
+			return
+		}
+		pageSize = n
+	}
+
+	var since, until time.Time
+	for name, t := range map[string]*time.Time{"filter[since]": &since, "filter[until]": &until} {
+		if v := query.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid Parameter", name+" must be an RFC 3339 date-time.")
+				return
+			}
+			*t = parsed
+		}
+	}
+	category := query.Get("filter[category]")
+
+	offset := 0
+	if v := query.Get("page[after]"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid Parameter", "page[after] is not a valid cursor.")
+			return
+		}
+		offset = n
+	}
+
+	s.mu.RLock()
+	matched := make([]model.TransactionResource, 0, len(s.transactions))
+	for _, transaction := range s.transactions {
+		createdAt := transaction.Attributes.CreatedAt
+		if !since.IsZero() && createdAt.Before(since) {
+			continue
+		}
+		if !until.IsZero() && !createdAt.Before(until) {
+			continue
+		}
+		if category != "" && (transaction.Relationships.Category.Data == nil || transaction.Relationships.Category.Data.Id != category) {
+			continue
+		}
+		matched = append(matched, transaction)
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(matched, func(a, b model.TransactionResource) int {
+		if c := b.Attributes.CreatedAt.Compare(a.Attributes.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Id, b.Id)
+	})
+
+	end := min(offset+pageSize, len(matched))
+	page := matched[min(offset, end):end]
+
+	var next *string
+	if end < len(matched) {
+		q := r.URL.Query()
+		q.Set("page[after]", strconv.Itoa(end))
+		link := fmt.Sprintf("%s%s?%s", s.URL, r.URL.Path, q.Encode())
+		next = &link
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data": page,
+		"links": map[string]*string{
+			"prev": nil,
+			"next": next,
+		},
+	})
+}
+
+// writeJSON writes a JSON response body
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes a JSON:API error response
+func writeError(w http.ResponseWriter, status int, title, detail string) {
+	writeJSON(w, status, map[string]any{
+		"errors": []map[string]string{{
+			"status": strconv.Itoa(status),
+			"title":  title,
+			"detail": detail,
+		}},
+	})
+}
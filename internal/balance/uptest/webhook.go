@@ -0,0 +1,58 @@
+package uptest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// SignatureHeader is the header Up sends the webhook signature in
+const SignatureHeader = "X-Up-Authenticity-Signature"
+
+// SignPayload returns the signature Up would send for a payload
+func SignPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookEvent builds a webhook event callback body for a transaction
+func WebhookEvent(eventType, eventID, transactionID string) []byte {
+	relationships := map[string]any{}
+	if transactionID != "" {
+		relationships["transaction"] = map[string]any{
+			"data": map[string]string{"type": "transactions", "id": transactionID},
+		}
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"data": map[string]any{
+			"type": "webhook-events",
+			"id":   eventID,
+			"attributes": map[string]any{
+				"eventType": eventType,
+				"createdAt": time.Now().Format(time.RFC3339),
+			},
+			"relationships": relationships,
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return payload
+}
+
+// NewWebhookRequest builds a signed webhook delivery to target
+func NewWebhookRequest(target, secret string, payload []byte) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, SignPayload(secret, payload))
+	return req
+}
@@ -0,0 +1,272 @@
+package uptest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// webhook is a webhook registered with the fake server
+type webhook struct {
+	id          string
+	url         string
+	description string
+	secretKey   string
+	createdAt   time.Time
+	logs        []deliveryLog // Newest first
+}
+
+// deliveryLog is an attempt to deliver an event to a webhook
+type deliveryLog struct {
+	id           string
+	eventID      string
+	status       string
+	requestBody  string
+	statusCode   int
+	responseBody string
+	createdAt    time.Time
+}
+
+// WebhookSecret returns the secret key of a registered webhook
+func (s *Server) WebhookSecret(id string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	w, ok := s.webhooks[id]
+	if !ok {
+		return "", false
+	}
+	return w.secretKey, true
+}
+
+// SendEvent delivers a signed event of eventType for a transaction to every
+// registered webhook, the way Up does when a transaction changes
+func (s *Server) SendEvent(eventType, transactionID string) {
+	s.mu.RLock()
+	ids := make([]string, 0, len(s.webhooks))
+	for id := range s.webhooks {
+		ids = append(ids, id)
+	}
+	s.mu.RUnlock()
+
+	for _, id := range ids {
+		s.deliver(id, eventType, transactionID)
+	}
+}
+
+// deliver sends a signed event to a webhook and records the attempt
+func (s *Server) deliver(webhookID, eventType, transactionID string) string {
+	s.mu.Lock()
+	w, ok := s.webhooks[webhookID]
+	if !ok {
+		s.mu.Unlock()
+		return ""
+	}
+	eventID := s.newID()
+	logID := s.newID()
+	target, secret := w.url, w.secretKey
+	s.mu.Unlock()
+
+	payload := WebhookEvent(eventType, eventID, transactionID)
+	log := deliveryLog{
+		id:          logID,
+		eventID:     eventID,
+		status:      "UNDELIVERABLE",
+		requestBody: string(payload),
+		createdAt:   time.Now(),
+	}
+
+	resp, err := s.Client().Do(NewWebhookRequest(target, secret, payload))
+	if err == nil {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		log.statusCode = resp.StatusCode
+		log.responseBody = string(body)
+		log.status = "DELIVERED"
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			log.status = "BAD_RESPONSE_CODE"
+		}
+	}
+
+	s.mu.Lock()
+	if w, ok := s.webhooks[webhookID]; ok {
+		w.logs = append([]deliveryLog{log}, w.logs...)
+	}
+	s.mu.Unlock()
+
+	return eventID
+}
+
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	webhooks := make([]*webhook, 0, len(s.webhooks))
+	for _, wh := range s.webhooks {
+		webhooks = append(webhooks, wh)
+	}
+	slices.SortFunc(webhooks, func(a, b *webhook) int {
+		return a.createdAt.Compare(b.createdAt)
+	})
+
+	data := make([]any, 0, len(webhooks))
+	for _, wh := range webhooks {
+		data = append(data, wh.resource(false))
+	}
+	s.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data":  data,
+		"links": map[string]*string{"prev": nil, "next": nil},
+	})
+}
+
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Data struct {
+			Attributes struct {
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Data.Attributes.URL == "" {
+		writeError(w, http.StatusBadRequest, "Invalid Request Body", "A webhook url is required.")
+		return
+	}
+
+	s.mu.Lock()
+	wh := &webhook{
+		id:          s.newID(),
+		url:         req.Data.Attributes.URL,
+		description: req.Data.Attributes.Description,
+		secretKey:   randomHex(32),
+		createdAt:   time.Now(),
+	}
+	s.webhooks[wh.id] = wh
+	resource := wh.resource(true)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, map[string]any{"data": resource})
+}
+
+func (s *Server) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wh, ok := s.webhooks[chi.URLParam(r, "id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found", "The requested webhook could not be found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": wh.resource(false)})
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := chi.URLParam(r, "id")
+	if _, ok := s.webhooks[id]; !ok {
+		writeError(w, http.StatusNotFound, "Not Found", "The requested webhook could not be found.")
+		return
+	}
+	delete(s.webhooks, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlePingWebhook(w http.ResponseWriter, r *http.Request) {
+	eventID := s.deliver(chi.URLParam(r, "id"), "PING", "")
+	if eventID == "" {
+		writeError(w, http.StatusNotFound, "Not Found", "The requested webhook could not be found.")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"data": map[string]any{
+			"type": "webhook-events",
+			"id":   eventID,
+			"attributes": map[string]any{
+				"eventType": "PING",
+				"createdAt": time.Now().Format(time.RFC3339),
+			},
+		},
+	})
+}
+
+func (s *Server) handleWebhookLogs(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wh, ok := s.webhooks[chi.URLParam(r, "id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found", "The requested webhook could not be found.")
+		return
+	}
+
+	data := make([]any, 0, len(wh.logs))
+	for _, l := range wh.logs {
+		var response any
+		if l.statusCode != 0 {
+			response = map[string]any{"statusCode": l.statusCode, "body": l.responseBody}
+		}
+		data = append(data, map[string]any{
+			"type": "webhook-delivery-logs",
+			"id":   l.id,
+			"attributes": map[string]any{
+				"request":        map[string]string{"body": l.requestBody},
+				"response":       response,
+				"deliveryStatus": l.status,
+				"createdAt":      l.createdAt.Format(time.RFC3339),
+			},
+			"relationships": map[string]any{
+				"webhookEvent": map[string]any{
+					"data": map[string]string{"type": "webhook-events", "id": l.eventID},
+				},
+			},
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data":  data,
+		"links": map[string]*string{"prev": nil, "next": nil},
+	})
+}
+
+// resource renders the webhook in Up's format. Up only reveals the secret key on creation.
+func (wh *webhook) resource(withSecret bool) map[string]any {
+	attributes := map[string]any{
+		"url":         wh.url,
+		"description": wh.description,
+		"createdAt":   wh.createdAt.Format(time.RFC3339),
+	}
+	if withSecret {
+		attributes["secretKey"] = wh.secretKey
+	}
+	return map[string]any{
+		"type":       "webhooks",
+		"id":         wh.id,
+		"attributes": attributes,
+	}
+}
+
+// newID returns a unique resource id
+// Caller must hold the mutex lock before calling this function
+func (s *Server) newID() string {
+	s.nextID++
+	return fmt.Sprintf("%08d-%s", s.nextID, randomHex(4))
+}
+
+// randomHex returns n random bytes encoded as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
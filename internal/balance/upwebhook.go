@@ -0,0 +1,218 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Webhook is a webhook registered with Up
+type Webhook struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description,omitempty"`
+	SecretKey   string    `json:"secret_key,omitempty"` // Only returned when the webhook is created
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WebhookDeliveryLog is a single attempt by Up to deliver an event to a webhook
+type WebhookDeliveryLog struct {
+	ID             string    `json:"id"`
+	EventID        string    `json:"event_id"`
+	DeliveryStatus string    `json:"delivery_status"` // DELIVERED, UNDELIVERABLE or BAD_RESPONSE_CODE
+	RequestBody    string    `json:"request_body"`
+	StatusCode     int       `json:"status_code,omitempty"` // Zero if no response was received
+	ResponseBody   string    `json:"response_body,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// webhookResource is a webhook in Up's JSON:API format
+type webhookResource struct {
+	ID         string `json:"id"`
+	Attributes struct {
+		URL         string    `json:"url"`
+		Description *string   `json:"description"`
+		SecretKey   string    `json:"secretKey"`
+		CreatedAt   time.Time `json:"createdAt"`
+	} `json:"attributes"`
+}
+
+func (r webhookResource) webhook() Webhook {
+	w := Webhook{
+		ID:        r.ID,
+		URL:       r.Attributes.URL,
+		SecretKey: r.Attributes.SecretKey,
+		CreatedAt: r.Attributes.CreatedAt,
+	}
+	if r.Attributes.Description != nil {
+		w.Description = *r.Attributes.Description
+	}
+	return w
+}
+
+// webhookDeliveryLogResource is a delivery log in Up's JSON:API format
+type webhookDeliveryLogResource struct {
+	ID         string `json:"id"`
+	Attributes struct {
+		Request struct {
+			Body string `json:"body"`
+		} `json:"request"`
+		Response *struct {
+			StatusCode int    `json:"statusCode"`
+			Body       string `json:"body"`
+		} `json:"response"`
+		DeliveryStatus string    `json:"deliveryStatus"`
+		CreatedAt      time.Time `json:"createdAt"`
+	} `json:"attributes"`
+	Relationships struct {
+		WebhookEvent struct {
+			Data struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		} `json:"webhookEvent"`
+	} `json:"relationships"`
+}
+
+func (r webhookDeliveryLogResource) log() WebhookDeliveryLog {
+	l := WebhookDeliveryLog{
+		ID:             r.ID,
+		EventID:        r.Relationships.WebhookEvent.Data.ID,
+		DeliveryStatus: r.Attributes.DeliveryStatus,
+		RequestBody:    r.Attributes.Request.Body,
+		CreatedAt:      r.Attributes.CreatedAt,
+	}
+	if r.Attributes.Response != nil {
+		l.StatusCode = r.Attributes.Response.StatusCode
+		l.ResponseBody = r.Attributes.Response.Body
+	}
+	return l
+}
+
+// pageLinks are the pagination links of a list response
+type pageLinks struct {
+	Prev *string `json:"prev"`
+	Next *string `json:"next"`
+}
+
+// ListWebhooks returns every webhook registered with Up
+func (c *UpClient) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	webhooks := make([]Webhook, 0)
+
+	uri := fmt.Sprintf("%swebhooks?page[size]=100", c.baseURL)
+	for uri != "" {
+		var resp struct {
+			Data  []webhookResource `json:"data"`
+			Links pageLinks         `json:"links"`
+		}
+		if err := c.requestURI(ctx, uri, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, r := range resp.Data {
+			webhooks = append(webhooks, r.webhook())
+		}
+
+		uri = ""
+		if resp.Links.Next != nil {
+			uri = *resp.Links.Next
+		}
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhook returns a single webhook
+func (c *UpClient) GetWebhook(ctx context.Context, webhookID string) (Webhook, error) {
+	var resp struct {
+		Data webhookResource `json:"data"`
+	}
+
+	endpoint := fmt.Sprintf("webhooks/%s", url.PathEscape(webhookID))
+
+	if err := c.request(ctx, endpoint, &resp); err != nil {
+		return Webhook{}, err
+	}
+
+	return resp.Data.webhook(), nil
+}
+
+// CreateWebhook registers a webhook for targetURL. The returned webhook holds the
+// secret key used to sign its deliveries, which Up never returns again.
+func (c *UpClient) CreateWebhook(ctx context.Context, targetURL, description string) (Webhook, error) {
+	attributes := map[string]string{"url": targetURL}
+	if description != "" {
+		attributes["description"] = description
+	}
+	body := map[string]any{
+		"data": map[string]any{"attributes": attributes},
+	}
+
+	var resp struct {
+		Data webhookResource `json:"data"`
+	}
+	if err := c.send(ctx, http.MethodPost, c.baseURL+"webhooks", body, &resp); err != nil {
+		return Webhook{}, err
+	}
+
+	return resp.Data.webhook(), nil
+}
+
+// DeleteWebhook removes a webhook so Up stops delivering events to it
+func (c *UpClient) DeleteWebhook(ctx context.Context, webhookID string) error {
+	uri := fmt.Sprintf("%swebhooks/%s", c.baseURL, url.PathEscape(webhookID))
+	return c.send(ctx, http.MethodDelete, uri, nil, nil)
+}
+
+// PingWebhook asks Up to send a PING event to a webhook and returns the event id
+func (c *UpClient) PingWebhook(ctx context.Context, webhookID string) (string, error) {
+	var resp struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+
+	uri := fmt.Sprintf("%swebhooks/%s/ping", c.baseURL, url.PathEscape(webhookID))
+	if err := c.send(ctx, http.MethodPost, uri, nil, &resp); err != nil {
+		return "", err
+	}
+
+	return resp.Data.ID, nil
+}
+
+// ListWebhookLogs returns up to limit of the most recent delivery attempts for a webhook,
+// newest first
+func (c *UpClient) ListWebhookLogs(ctx context.Context, webhookID string, limit int) ([]WebhookDeliveryLog, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	logs := make([]WebhookDeliveryLog, 0, limit)
+
+	uri := fmt.Sprintf("%swebhooks/%s/logs?page[size]=%s", c.baseURL, url.PathEscape(webhookID), strconv.Itoa(min(limit, 100)))
+	for uri != "" && len(logs) < limit {
+		var resp struct {
+			Data  []webhookDeliveryLogResource `json:"data"`
+			Links pageLinks                    `json:"links"`
+		}
+		if err := c.requestURI(ctx, uri, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, r := range resp.Data {
+			if len(logs) == limit {
+				break
+			}
+			logs = append(logs, r.log())
+		}
+
+		uri = ""
+		if resp.Links.Next != nil {
+			uri = *resp.Links.Next
+		}
+	}
+
+	return logs, nil
+}
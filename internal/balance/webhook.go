@@ -8,44 +8,180 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/baely/balance/pkg/model"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/baely/txn/internal/balance/database"
 	"github.com/baely/txn/internal/common/errors"
 	commonHttp "github.com/baely/txn/internal/common/http"
 )
 
+// DefaultInboxRetryDelay is how long to wait before retrying an event that failed to process
+const DefaultInboxRetryDelay = time.Minute
+
+// inboxMaxAttempts is how many times an event is processed before it is dead-lettered
+const inboxMaxAttempts = 10
+
 // WebhookService handles webhook events from Up Banking
 type WebhookService struct {
 	upClient            *UpClient
-	rawChan             chan []byte
+	webhookSecrets      *WebhookSecrets
+	deadLetters         DeadLetterStore
+	archive             TransactionArchive
+	inbox               *Inbox
+	seen                *SeenStore
 	router              chi.Router
-	transactionHandlers []TransactionEventHandler
+	transactionHandlers []registeredHandler
+	handlerTimeout      time.Duration
+	inboxRetryDelay     time.Duration
+	dispatcher          *Dispatcher
+	backfill            backfillState
 	logger              *slog.Logger
-}
 
-// New creates a new WebhookService with default configuration
-func New() *WebhookService {
-	return NewWithConfig(&Config{
-		UpAccessToken: os.Getenv("UP_ACCESS_TOKEN"),
-		Logger:        slog.Default(),
-	})
+	// ctx is cancelled on shutdown to stop in-flight work
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
 // Config contains configuration for the WebhookService
 type Config struct {
-	UpAccessToken string
-	Logger        *slog.Logger
+	UpAccessToken   string
+	UpBaseURL       string // Defaults to the production Up API
+	WebhookSecret   string
+	AdminSecretCode string
+	Logger          *slog.Logger
+	CacheDir        string
+	DBUser          string
+	DBPassword      string
+	DBHost          string
+	DBPort          string
+	DBName          string
+	HandlerTimeout  time.Duration // Default per-handler timeout
+	InboxRetryDelay time.Duration // Wait before retrying an event that failed to process
+
+	// HandlerWorkers limits how many handlers run at once
+	HandlerWorkers int
+	// SerializeByAccount handles events from the same account in order
+	SerializeByAccount bool
+	// WebhookSecrets are accepted alongside WebhookSecret, for rotating the Up webhook
+	WebhookSecrets []WebhookSecret
+	// WebhookSecretsFile is a JSON file of further secrets, reread when it changes
+	WebhookSecretsFile string
+}
+
+// DefaultConfig returns the default service configuration
+func DefaultConfig() *Config {
+	cacheDir := os.Getenv("CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = "/data"
+	}
+	return &Config{
+		UpAccessToken:   os.Getenv("UP_ACCESS_TOKEN"),
+		UpBaseURL:       os.Getenv("UP_BASE_URL"),
+		WebhookSecret:   os.Getenv("UP_WEBHOOK_SECRET"),
+		AdminSecretCode: os.Getenv("ADMIN_SECRET_CODE"),
+		Logger:          slog.Default(),
+		CacheDir:        cacheDir,
+		DBUser:          os.Getenv("DB_USER"),
+		DBPassword:      os.Getenv("DB_PASSWORD"),
+		DBHost:          os.Getenv("DB_HOST"),
+		DBPort:          os.Getenv("DB_PORT"),
+		DBName:          os.Getenv("DB_NAME"),
+		HandlerTimeout:  DefaultHandlerTimeout,
+		InboxRetryDelay: DefaultInboxRetryDelay,
+
+		HandlerWorkers:     DefaultHandlerWorkers,
+		SerializeByAccount: true,
+		WebhookSecretsFile: os.Getenv("UP_WEBHOOK_SECRETS_FILE"),
+	}
+}
+
+// New creates a new WebhookService with default configuration
+func New() *WebhookService {
+	return NewWithConfig(DefaultConfig())
 }
 
 // NewWithConfig creates a new WebhookService with custom configuration
 func NewWithConfig(cfg *Config) *WebhookService {
+	inbox, err := OpenInbox(filepath.Join(cfg.CacheDir, "balance-inbox.log"))
+	if err != nil {
+		errors.Must(err) // This will panic if the inbox cannot be opened
+	}
+
+	seen, err := OpenSeenStore(filepath.Join(cfg.CacheDir, "balance-seen.log"))
+	if err != nil {
+		errors.Must(err) // This will panic if the dedup log cannot be opened
+	}
+
+	// Without a database, dead letters and the archive are kept in memory, which is enough for local development
+	var deadLetters DeadLetterStore
+	var archive TransactionArchive
+	if cfg.DBHost != "" {
+		db, err := database.NewClient(
+			cfg.DBUser,
+			cfg.DBPassword,
+			cfg.DBHost,
+			cfg.DBPort,
+			cfg.DBName,
+		)
+		if err != nil {
+			errors.Must(err) // This will panic with database connection errors
+		}
+		deadLetters = db
+		archive = db
+	} else {
+		cfg.Logger.Warn("No database configured, dead letters and archived transactions will not survive a restart")
+		deadLetters = newMemoryDeadLetterStore()
+		archive = newMemoryTransactionArchive()
+	}
+
+	secrets, err := NewWebhookSecrets(
+		append([]WebhookSecret{{Secret: cfg.WebhookSecret}}, cfg.WebhookSecrets...),
+		cfg.WebhookSecretsFile,
+		cfg.Logger,
+	)
+	if err != nil {
+		errors.Must(err) // This will panic if the secrets file cannot be loaded
+	}
+	if len(secrets.Active(time.Now())) == 0 {
+		cfg.Logger.Warn("No webhook secrets configured, all webhook deliveries will be rejected")
+	}
+
+	handlerTimeout := cfg.HandlerTimeout
+	if handlerTimeout <= 0 {
+		handlerTimeout = DefaultHandlerTimeout
+	}
+	inboxRetryDelay := cfg.InboxRetryDelay
+	if inboxRetryDelay <= 0 {
+		inboxRetryDelay = DefaultInboxRetryDelay
+	}
+
+	dispatcher := NewDispatcher(DispatcherConfig{
+		Workers:            cfg.HandlerWorkers,
+		SerializeByAccount: cfg.SerializeByAccount,
+		Logger:             cfg.Logger,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
 	service := &WebhookService{
-		upClient: NewUpClient(cfg.UpAccessToken),
-		rawChan:  make(chan []byte, 100), // Buffered channel to handle bursts
-		logger:   cfg.Logger,
+		upClient:        NewUpClient(cfg.UpAccessToken, WithBaseURL(cfg.UpBaseURL)),
+		webhookSecrets:  secrets,
+		deadLetters:     deadLetters,
+		archive:         archive,
+		inbox:           inbox,
+		seen:            seen,
+		handlerTimeout:  handlerTimeout,
+		inboxRetryDelay: inboxRetryDelay,
+		dispatcher:      dispatcher,
+		logger:          cfg.Logger,
+		ctx:             ctx,
+		cancel:          cancel,
 	}
 
 	// Setup router with standard middleware
@@ -58,15 +194,68 @@ func NewWithConfig(cfg *Config) *WebhookService {
 	// Register routes
 	r.Post("/up/event", service.handleWebhook)
 	r.Post("/event", service.handleWebhook)
+
+	// Admin routes require the admin secret as a bearer token
+	r.Group(func(r chi.Router) {
+		r.Use(commonHttp.RequireBearerToken(cfg.AdminSecretCode))
+		r.Post("/admin/backfill", service.handleBackfill)
+		r.Get("/admin/backfill", service.handleBackfillStatus)
+		r.Get("/admin/dead-letters", service.handleListDeadLetters)
+		r.Post("/admin/dead-letters/{id}/retry", service.handleRetryDeadLetter)
+		r.Delete("/admin/dead-letters/{id}", service.handleDiscardDeadLetter)
+		r.Get("/admin/webhooks", service.handleListWebhooks)
+		r.Post("/admin/webhooks", service.handleCreateWebhook)
+		r.Delete("/admin/webhooks/{id}", service.handleDeleteWebhook)
+		r.Post("/admin/webhooks/{id}/ping", service.handlePingWebhook)
+		r.Get("/admin/webhooks/{id}/logs", service.handleWebhookLogs)
+		r.Get("/admin/webhook-secrets", service.handleWebhookSecrets)
+		r.Get("/admin/handlers", service.handleListHandlers)
+		r.Get("/admin/transactions", service.handleListTransactions)
+		r.Get("/admin/transactions/{id}", service.handleGetTransaction)
+	})
 	
 	service.router = r
 
-	// Start processing goroutine
-	go service.processEvents()
+	// Start processing goroutines
+	service.wg.Add(2)
+	go func() {
+		defer service.wg.Done()
+		service.processEvents()
+	}()
+	go func() {
+		defer service.wg.Done()
+		service.runDeadLetterRetrier()
+	}()
 
 	return service
 }
 
+// Shutdown cancels in-flight event processing and waits for it to stop.
+// Events that were interrupted stay in the inbox and are replayed on the next start.
+func (s *WebhookService) Shutdown(ctx context.Context) error {
+	s.logger.Info("Shutting down webhook service")
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		// Nothing dispatches any more, so let the workers drain their queues
+		s.dispatcher.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "webhook service did not stop in time")
+	}
+
+	if err := s.inbox.Close(); err != nil {
+		return errors.Wrap(err, "failed to close inbox")
+	}
+	return errors.Wrap(s.seen.Close(), "failed to close dedup log")
+}
+
 // Chi returns the router for this service
 func (s *WebhookService) Chi() chi.Router {
 	return s.router
@@ -74,8 +263,51 @@ func (s *WebhookService) Chi() chi.Router {
 
 // RegisterHandler registers a handler for transaction events
 func (s *WebhookService) RegisterHandler(handler TransactionEventHandler) {
-	s.logger.Info("Registering transaction handler", "handler", handler)
-	s.transactionHandlers = append(s.transactionHandlers, handler)
+	s.RegisterHandlerV2(legacyHandler{handler: handler})
+}
+
+// RegisterHandlerV2 registers a context-aware handler for transaction events
+func (s *WebhookService) RegisterHandlerV2(handler TransactionEventHandlerV2, opts ...HandlerOption) {
+	h := registeredHandler{
+		name:    handlerName(handler),
+		handler: handler,
+		timeout: s.handlerTimeout,
+	}
+	for _, opt := range opts {
+		opt(&h)
+	}
+
+	filter := "all events"
+	if h.filter != nil {
+		filter = h.filter.filter.String()
+	}
+	s.logger.Info("Registering transaction handler", "handler", h.name, "timeout", h.timeout, "filter", filter)
+	s.transactionHandlers = append(s.transactionHandlers, h)
+}
+
+// Handlers describes every registered handler and the events it subscribes to
+func (s *WebhookService) Handlers() []HandlerInfo {
+	handlers := make([]HandlerInfo, 0, len(s.transactionHandlers))
+	for _, h := range s.transactionHandlers {
+		handlers = append(handlers, h.info())
+	}
+	return handlers
+}
+
+// subscribers returns the handlers whose filters match an event
+func (s *WebhookService) subscribers(event TransactionEvent) []registeredHandler {
+	handlers := make([]registeredHandler, 0, len(s.transactionHandlers))
+	for _, h := range s.transactionHandlers {
+		if h.wants(event) {
+			handlers = append(handlers, h)
+		}
+	}
+	return handlers
+}
+
+// handleListHandlers lists the registered handlers and their filters
+func (s *WebhookService) handleListHandlers(w http.ResponseWriter, r *http.Request) {
+	commonHttp.Success(w, s.Handlers())
 }
 
 // handleWebhook processes incoming webhook requests
@@ -88,69 +320,198 @@ func (s *WebhookService) handleWebhook(w http.ResponseWriter, r *http.Request) {
 	}
 
 	signature := r.Header.Get("X-Up-Authenticity-Signature")
-	if !ValidateWebhookEvent(body, signature) {
+	secret, ok := s.webhookSecrets.Match(body, signature, time.Now())
+	if !ok {
 		s.logger.Warn("Invalid webhook signature", "signature", signature)
 		commonHttp.Error(w, errors.ErrUnauthorized, http.StatusUnauthorized)
 		return
 	}
 
-	// Queue event for processing
-	s.rawChan <- body
-	
+	// Persist event before acknowledging so it survives a restart
+	entry, err := s.inbox.Append(body)
+	if err != nil {
+		s.logger.Error("Failed to store webhook event", "error", err)
+		commonHttp.Error(w, errors.Wrap(err, "failed to store webhook event"), http.StatusInternalServerError)
+		return
+	}
+	s.logger.Info("Webhook event stored", "inbox_id", entry.ID, "secret_id", secret.ID)
+
 	// Return success immediately
 	commonHttp.Success(w, map[string]string{"status": "accepted"})
 }
 
-// processEvents listens for events and processes them asynchronously
+// processEvents consumes stored events and hands them to the dispatcher
 func (s *WebhookService) processEvents() {
 	s.logger.Info("Starting webhook event processor")
-	for raw := range s.rawChan {
-		s.processEvent(raw)
+	for {
+		entry, err := s.inbox.Next(s.ctx)
+		if err != nil {
+			if s.ctx.Err() == nil {
+				s.logger.Error("Failed to read from inbox", "error", err)
+			}
+			return
+		}
+
+		// Entries that fail stay pending and are retried, such as when Up is
+		// unavailable, until they run out of attempts and are dead-lettered
+		if err := s.processEvent(s.ctx, entry); err != nil {
+			entry.Attempts++
+			s.logger.Error("Failed to process event", "inbox_id", entry.ID, "attempts", entry.Attempts, "error", err)
+			if entry.Attempts >= inboxMaxAttempts && s.deadLetterInbox(entry, err) {
+				continue
+			}
+			time.AfterFunc(s.inboxRetryDelay, func() {
+				s.inbox.Requeue(entry)
+			})
+		}
 	}
 }
 
-// processEvent handles a single event
-func (s *WebhookService) processEvent(raw []byte) {
-	ctx := context.Background()
+// processEvent handles a single event. The inbox entry is marked done once
+// every handler has finished, or immediately if there is nothing to dispatch.
+func (s *WebhookService) processEvent(ctx context.Context, entry InboxEntry) error {
+	raw := entry.Payload
+	markDone := func() error {
+		return s.inbox.MarkDone(entry.ID)
+	}
+	// Interrupted events stay in the inbox to be replayed
+	onDispatched := func(err error) {
+		if err != nil {
+			return
+		}
+		if err := markDone(); err != nil {
+			s.logger.Error("Failed to mark inbox entry done", "inbox_id", entry.ID, "error", err)
+		}
+	}
+
 	event := parseEvent(raw)
-	s.logger.Info("Processing event", "type", event.Data.Type, "id", event.Data.Id)
+	eventType := parseEventType(raw)
+	s.logger.Info("Processing event", "type", event.Data.Type, "event_type", eventType, "id", event.Data.Id)
+
+	// Skip redeliveries of a webhook event we have already dispatched
+	if s.seen.HasEvent(event.Data.Id) {
+		s.logger.Info("Skipping duplicate webhook event", "id", event.Data.Id)
+		return markDone()
+	}
 
 	// Retrieve transaction details
 	eventTransaction := event.Data.Relationships.Transaction
 	if eventTransaction == nil {
 		s.logger.Warn("Event contains no transaction details")
-		return
+		return markDone()
+	}
+
+	transactionID := eventTransaction.Data.Id
+	switch eventType {
+	case EventTypeCreated, EventTypeSettled:
+		// A transaction is only new the first time we see it, whichever
+		// webhook delivers it; anything after that is a settlement update
+		if s.seen.HasTransaction(transactionID) {
+			if eventType == EventTypeCreated {
+				s.logger.Info("Skipping duplicate transaction", "id", transactionID)
+				if err := s.seen.Record(event.Data.Id, transactionID); err != nil {
+					return err
+				}
+				return markDone()
+			}
+			eventType = EventTypeSettled
+		} else {
+			eventType = EventTypeCreated
+		}
+	case EventTypeDeleted:
+		// Deleted transactions can no longer be fetched, so handlers only get the
+		// id, and the account id if the transaction was archived. The account
+		// keeps the delete behind the transaction's earlier events when
+		// dispatch is serialized by account.
+		var account model.AccountResource
+		archived, err := s.archive.GetArchivedTransaction(ctx, transactionID)
+		switch {
+		case err == nil:
+			account.Id = archived.AccountID
+		case !errors.Is(err, errors.ErrNotFound):
+			return err
+		}
+		if err := s.archive.MarkTransactionDeleted(ctx, transactionID, time.Now()); err != nil {
+			return err
+		}
+
+		var transaction model.TransactionResource
+		transaction.Id = transactionID
+		s.dispatch(ctx, TransactionEvent{
+			Type:           eventType,
+			WebhookEventID: event.Data.Id,
+			Account:        account,
+			Transaction:    transaction,
+		}, onDispatched)
+		return nil
+	default:
+		s.logger.Info("Ignoring unsupported event type", "event_type", eventType, "id", event.Data.Id)
+		return markDone()
 	}
 
 	// Get transaction details
-	transaction, err := s.upClient.GetTransaction(ctx, eventTransaction.Data.Id)
+	transaction, err := s.upClient.GetTransaction(ctx, transactionID)
+	if errors.Is(err, errors.ErrNotFound) {
+		// The transaction vanished before we could fetch it, so there is nothing to dispatch
+		s.logger.Warn("Transaction no longer exists", "id", transactionID)
+		return markDone()
+	}
 	if err != nil {
-		s.logger.Error("Failed to retrieve transaction", "id", eventTransaction.Data.Id, "error", err)
-		return
+		return errors.Wrap(err, "failed to retrieve transaction %s", transactionID)
 	}
 
 	// Get account details
 	accountID := transaction.Relationships.Account.Data.Id
 	account, err := s.upClient.GetAccount(ctx, accountID)
 	if err != nil {
-		s.logger.Error("Failed to retrieve account", "id", accountID, "error", err)
-		return
+		return errors.Wrap(err, "failed to retrieve account %s", accountID)
 	}
 
 	// Create event data
 	data := TransactionEvent{
-		Account:     account,
-		Transaction: transaction,
+		Type:           eventType,
+		WebhookEventID: event.Data.Id,
+		Account:        account,
+		Transaction:    transaction,
 	}
 
-	// Notify all handlers
-	for _, handler := range s.transactionHandlers {
-		go func(h TransactionEventHandler, d TransactionEvent) {
-			if err := h.HandleEvent(d); err != nil {
-				s.logger.Error("Handler failed to process event", "handler", h, "error", err)
-			}
-		}(handler, data)
+	if err := s.archiveEvent(ctx, data); err != nil {
+		return err
 	}
+
+	s.dispatch(ctx, data, onDispatched)
+	return nil
+}
+
+// dispatch hands an event to every subscribed handler without waiting for them to finish.
+// Once they have, failed handlers are dead-lettered, the event is recorded as seen
+// and onDone is called with nil. Interrupted events are not recorded, so they are
+// processed again when replayed, and onDone receives the context error.
+func (s *WebhookService) dispatch(ctx context.Context, data TransactionEvent, onDone func(error)) {
+	s.seen.Reserve(data.WebhookEventID, data.Transaction.Id)
+
+	handlers := s.subscribers(data)
+	if len(handlers) == 0 {
+		s.logger.Debug("No handlers subscribed to event", "type", data.Type, "transaction_id", data.Transaction.Id)
+	}
+
+	s.dispatcher.Dispatch(ctx, data, handlers, func(result DispatchResult) {
+		defer s.seen.Release(data.WebhookEventID, data.Transaction.Id)
+
+		if result.Err != nil {
+			s.logger.Warn("Event dispatch interrupted", "transaction_id", data.Transaction.Id, "error", result.Err)
+			onDone(result.Err)
+			return
+		}
+
+		if len(result.Failures) > 0 {
+			s.deadLetter(data, result.Failures)
+		}
+		if err := s.seen.Record(data.WebhookEventID, data.Transaction.Id); err != nil {
+			s.logger.Error("Failed to record dispatched event", "transaction_id", data.Transaction.Id, "error", err)
+		}
+		onDone(nil)
+	})
 }
 
 // parseEvent converts JSON data to a webhook event
@@ -161,3 +522,18 @@ func parseEvent(value []byte) model.WebhookEventCallback {
 	}
 	return event
 }
+
+// parseEventType extracts the Up event type from a raw webhook event
+func parseEventType(value []byte) EventType {
+	var event struct {
+		Data struct {
+			Attributes struct {
+				EventType string `json:"eventType"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(value, &event); err != nil {
+		slog.Error("Failed to parse webhook event type", "error", err)
+	}
+	return EventType(event.Data.Attributes.EventType)
+}
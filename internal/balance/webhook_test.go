@@ -0,0 +1,216 @@
+package balance
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/baely/txn/internal/balance/models"
+	"github.com/baely/txn/internal/balance/uptest"
+	"github.com/baely/txn/internal/common/errors"
+)
+
+const (
+	testAccessToken   = "up-token"
+	testWebhookSecret = "webhook-secret"
+)
+
+// recordingHandler passes every event it receives to a channel
+type recordingHandler struct {
+	events chan TransactionEvent
+}
+
+func (h recordingHandler) HandleEvent(ctx context.Context, event TransactionEvent) error {
+	h.events <- event
+	return nil
+}
+
+// newTestService starts a service backed by a fake Up API holding one café purchase
+func newTestService(t *testing.T) (*WebhookService, recordingHandler) {
+	service := newTestServiceWithConfig(t, nil)
+	handler := recordingHandler{events: make(chan TransactionEvent, 1)}
+	service.RegisterHandlerV2(handler)
+	return service, handler
+}
+
+// newTestServiceWithConfig starts a service like newTestService, letting the
+// test change its configuration, without registering a handler
+func newTestServiceWithConfig(t *testing.T, change func(cfg *Config)) *WebhookService {
+	up := uptest.NewServer(testAccessToken)
+	t.Cleanup(up.Close)
+	up.AddAccount(uptest.NewAccount("acc-1", "Spending"))
+	up.AddTransaction(uptest.NewTransaction(uptest.Transaction{
+		ID:          "tx-1",
+		AccountID:   "acc-1",
+		Description: "Chia Chia Pty Ltd",
+		Amount:      -680,
+		Category:    "restaurants-and-cafes",
+	}))
+
+	cfg := &Config{
+		UpAccessToken:      testAccessToken,
+		UpBaseURL:          up.BaseURL(),
+		WebhookSecret:      testWebhookSecret,
+		AdminSecretCode:    "admin",
+		Logger:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+		CacheDir:           t.TempDir(),
+		HandlerWorkers:     1,
+		SerializeByAccount: true,
+	}
+	if change != nil {
+		change(cfg)
+	}
+	service := NewWithConfig(cfg)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := service.Shutdown(ctx); err != nil {
+			t.Errorf("failed to shut down: %v", err)
+		}
+	})
+	return service
+}
+
+// deliver sends a signed webhook for a transaction and checks it is accepted
+func deliver(t *testing.T, service *WebhookService, eventType EventType, eventID, transactionID string) {
+	t.Helper()
+	payload := uptest.WebhookEvent(string(eventType), eventID, transactionID)
+	rec := httptest.NewRecorder()
+	service.Chi().ServeHTTP(rec, uptest.NewWebhookRequest("/up/event", testWebhookSecret, payload))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+}
+
+// TestWebhookDelivery sends a signed webhook and checks that the handler gets
+// the transaction fetched from Up
+func TestWebhookDelivery(t *testing.T) {
+	service, handler := newTestService(t)
+
+	payload := uptest.WebhookEvent(string(EventTypeCreated), "evt-1", "tx-1")
+	rec := httptest.NewRecorder()
+	service.Chi().ServeHTTP(rec, uptest.NewWebhookRequest("/up/event", testWebhookSecret, payload))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	select {
+	case event := <-handler.events:
+		if event.Type != EventTypeCreated || event.WebhookEventID != "evt-1" {
+			t.Fatalf("got %s event %s, want %s event evt-1", event.Type, event.WebhookEventID, EventTypeCreated)
+		}
+		if event.Transaction.Id != "tx-1" || event.Transaction.Attributes.Amount.ValueInBaseUnits != -680 {
+			t.Fatalf("got transaction %s for %d, want tx-1 for -680", event.Transaction.Id, event.Transaction.Attributes.Amount.ValueInBaseUnits)
+		}
+		if event.Account.Id != "acc-1" {
+			t.Fatalf("got account %s, want acc-1", event.Account.Id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not receive the transaction")
+	}
+}
+
+// TestWebhookBadSignature checks that a delivery signed with the wrong secret
+// is rejected and never reaches a handler
+func TestWebhookBadSignature(t *testing.T) {
+	service, handler := newTestService(t)
+
+	payload := uptest.WebhookEvent(string(EventTypeCreated), "evt-1", "tx-1")
+	rec := httptest.NewRecorder()
+	service.Chi().ServeHTTP(rec, uptest.NewWebhookRequest("/up/event", "wrong-secret", payload))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	select {
+	case event := <-handler.events:
+		t.Fatalf("handler received %s for a rejected delivery", event.Transaction.Id)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// slowCreateHandler takes a while over created transactions and records the
+// order events finish in
+type slowCreateHandler struct {
+	events chan TransactionEvent
+}
+
+func (h slowCreateHandler) HandleEvent(ctx context.Context, event TransactionEvent) error {
+	if event.Type == EventTypeCreated {
+		time.Sleep(100 * time.Millisecond)
+	}
+	h.events <- event
+	return nil
+}
+
+// TestWebhookDeleteAfterCreate checks that deleting a transaction is handled
+// after its creation, even when the creation is slow and other workers are free
+func TestWebhookDeleteAfterCreate(t *testing.T) {
+	service := newTestServiceWithConfig(t, func(cfg *Config) {
+		cfg.HandlerWorkers = 8
+	})
+	handler := slowCreateHandler{events: make(chan TransactionEvent, 2)}
+	service.RegisterHandlerV2(handler)
+
+	deliver(t, service, EventTypeCreated, "evt-1", "tx-1")
+	deliver(t, service, EventTypeDeleted, "evt-2", "tx-1")
+
+	for _, want := range []EventType{EventTypeCreated, EventTypeDeleted} {
+		select {
+		case event := <-handler.events:
+			if event.Type != want {
+				t.Fatalf("got %s, want %s", event.Type, want)
+			}
+			if event.Account.Id != "acc-1" {
+				t.Fatalf("got %s for account %q, want acc-1", event.Type, event.Account.Id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("handler did not receive %s", want)
+		}
+	}
+}
+
+// TestWebhookInboxDeadLetter checks that an event that keeps failing to
+// process is dead-lettered once it runs out of attempts, and that retrying it
+// returns it to the inbox
+func TestWebhookInboxDeadLetter(t *testing.T) {
+	// Up rejects the token, so the transaction can never be fetched
+	service := newTestServiceWithConfig(t, func(cfg *Config) {
+		cfg.UpAccessToken = "wrong-token"
+		cfg.InboxRetryDelay = time.Millisecond
+	})
+	deliver(t, service, EventTypeCreated, "evt-1", "tx-1")
+
+	ctx := context.Background()
+	var dls []models.DeadLetter
+	for deadline := time.Now().Add(5 * time.Second); len(dls) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("event was not dead-lettered")
+		}
+		var err error
+		if dls, err = service.deadLetters.ListDeadLetters(ctx); err != nil {
+			t.Fatalf("failed to list dead letters: %v", err)
+		}
+	}
+	dl := dls[0]
+	if dl.Handler != inboxDeadLetterHandler || dl.TransactionID != "tx-1" || dl.Attempts != inboxMaxAttempts || dl.NextAttemptAt != nil {
+		t.Fatalf("got %+v, want an inbox dead letter for tx-1 after %d attempts", dl, inboxMaxAttempts)
+	}
+	if got := countLines(t, service.inbox.path); got != 2 {
+		t.Fatalf("got %d inbox records, want the entry added and marked done", got)
+	}
+
+	if err := service.retryDeadLetter(ctx, dl); err != nil {
+		t.Fatalf("failed to retry dead letter: %v", err)
+	}
+	if _, err := service.deadLetters.GetDeadLetter(ctx, dl.ID); !errors.Is(err, errors.ErrNotFound) {
+		t.Fatalf("got %v, want the dead letter removed", err)
+	}
+	if got := countLines(t, service.inbox.path); got < 3 {
+		t.Fatalf("got %d inbox records, want the entry back in the inbox", got)
+	}
+}
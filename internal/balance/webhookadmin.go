@@ -0,0 +1,97 @@
+package balance
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/baely/txn/internal/common/errors"
+	commonHttp "github.com/baely/txn/internal/common/http"
+)
+
+// createWebhookRequest is the body of a request to register an Up webhook
+type createWebhookRequest struct {
+	URL         string `json:"url"`
+	Description string `json:"description"`
+}
+
+// handleListWebhooks lists the webhooks registered with Up
+func (s *WebhookService) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := s.upClient.ListWebhooks(r.Context())
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, webhooks)
+}
+
+// handleCreateWebhook registers a webhook with Up.
+// The response includes the secret key, which Up will not return again.
+func (s *WebhookService) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		commonHttp.HandleError(w, errors.Wrap(errors.ErrInvalidInput, "invalid request body"))
+		return
+	}
+	if req.URL == "" {
+		commonHttp.HandleError(w, errors.Wrap(errors.ErrInvalidInput, "url is required"))
+		return
+	}
+
+	webhook, err := s.upClient.CreateWebhook(r.Context(), req.URL, req.Description)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	s.logger.Info("Created Up webhook", "id", webhook.ID, "url", webhook.URL)
+	commonHttp.JSON(w, http.StatusCreated, commonHttp.Response{Success: true, Data: webhook})
+}
+
+// handleDeleteWebhook removes a webhook from Up
+func (s *WebhookService) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if err := s.upClient.DeleteWebhook(r.Context(), id); err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	s.logger.Info("Deleted Up webhook", "id", id)
+	commonHttp.Success(w, map[string]string{"status": "deleted"})
+}
+
+// handlePingWebhook asks Up to send a PING event to a webhook
+func (s *WebhookService) handlePingWebhook(w http.ResponseWriter, r *http.Request) {
+	eventID, err := s.upClient.PingWebhook(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, map[string]string{"event_id": eventID})
+}
+
+// handleWebhookLogs lists recent delivery attempts for a webhook
+func (s *WebhookService) handleWebhookLogs(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			commonHttp.HandleError(w, errors.Wrap(errors.ErrInvalidInput, "invalid limit"))
+			return
+		}
+		limit = n
+	}
+
+	logs, err := s.upClient.ListWebhookLogs(r.Context(), chi.URLParam(r, "id"), limit)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, logs)
+}
+
+// handleWebhookSecrets lists the accepted webhook secrets by id
+func (s *WebhookService) handleWebhookSecrets(w http.ResponseWriter, r *http.Request) {
+	commonHttp.Success(w, s.webhookSecrets.Status(time.Now()))
+}
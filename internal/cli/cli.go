@@ -0,0 +1,65 @@
+// Package cli implements the txn command line subcommands
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/baely/txn/internal/balance"
+	"github.com/baely/txn/internal/common/errors"
+)
+
+// command is a top level subcommand
+type command struct {
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"webhooks":  {usage: "Manage Up webhooks", run: runWebhooks},
+	"migrate":   {usage: "Apply or revert tracker schema migrations", run: runMigrate},
+	"reprocess": {usage: "Rerun archived transactions through the tracker rules", run: runReprocess},
+}
+
+// Run executes the subcommand named by args[0]
+func Run(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage()
+		return nil
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		printUsage()
+		return errors.Wrap(errors.ErrInvalidInput, "unknown command %q", args[0])
+	}
+	return cmd.run(ctx, args[1:])
+}
+
+// printUsage lists the available subcommands
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Usage: txn [command]\n\nRuns the server when no command is given.\n\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %-10s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprint(os.Stderr, b.String())
+}
+
+// upClient creates an Up API client from UP_ACCESS_TOKEN and UP_BASE_URL
+func upClient() (*balance.UpClient, error) {
+	token := os.Getenv("UP_ACCESS_TOKEN")
+	if token == "" {
+		return nil, errors.Wrap(errors.ErrInvalidInput, "UP_ACCESS_TOKEN is not set")
+	}
+	return balance.NewUpClient(token, balance.WithBaseURL(os.Getenv("UP_BASE_URL"))), nil
+}
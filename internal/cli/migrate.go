@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/baely/txn/internal/common/errors"
+	"github.com/baely/txn/internal/tracker/database"
+)
+
+const migrateUsage = `Usage: txn migrate <command>
+
+Commands:
+  up                Apply every pending tracker migration
+  down [-steps N]   Revert the last N applied migrations (default 1)
+  status            List migrations and when they were applied
+`
+
+// runMigrate dispatches the migrate subcommands
+func runMigrate(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return errors.Wrap(errors.ErrInvalidInput, "missing migrate command")
+	}
+
+	switch args[0] {
+	case "up":
+		return migrateUp(ctx)
+	case "down":
+		return migrateDown(ctx, args[1:])
+	case "status":
+		return migrateStatus(ctx)
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return errors.Wrap(errors.ErrInvalidInput, "unknown migrate command %q", args[0])
+	}
+}
+
+func migrateUp(ctx context.Context) error {
+	db, err := connectTracker()
+	if err != nil {
+		return err
+	}
+	applied, err := db.MigrateUp(ctx)
+	for _, m := range applied {
+		fmt.Printf("Applied %04d %s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to apply migrations")
+	}
+	if len(applied) == 0 {
+		fmt.Println("Schema is up to date")
+	}
+	return nil
+}
+
+func migrateDown(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+	steps := fs.Int("steps", 1, "Number of migrations to revert")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *steps < 1 {
+		return errors.Wrap(errors.ErrInvalidInput, "-steps must be at least 1")
+	}
+
+	db, err := connectTracker()
+	if err != nil {
+		return err
+	}
+	reverted, err := db.MigrateDown(ctx, *steps)
+	for _, m := range reverted {
+		fmt.Printf("Reverted %04d %s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to revert migrations")
+	}
+	if len(reverted) == 0 {
+		fmt.Println("No migrations to revert")
+	}
+	return nil
+}
+
+func migrateStatus(ctx context.Context) error {
+	db, err := connectTracker()
+	if err != nil {
+		return err
+	}
+	migrations, err := db.MigrationStatus(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to read migrations")
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, m := range migrations {
+		applied := "pending"
+		if m.AppliedAt != nil {
+			applied = m.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\n", m.Version, m.Name, applied)
+	}
+	return tw.Flush()
+}
+
+// connectTracker opens the tracker database without migrating it
+func connectTracker() (*database.Client, error) {
+	user, password, host, port, name := dbConfig()
+	db, err := database.Connect(user, password, host, port, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to tracker database")
+	}
+	return db, nil
+}
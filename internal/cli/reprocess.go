@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/baely/txn/internal/balance"
+	balancedb "github.com/baely/txn/internal/balance/database"
+	"github.com/baely/txn/internal/common/errors"
+	"github.com/baely/txn/internal/tracker/database"
+	"github.com/baely/txn/internal/tracker/models"
+	"github.com/baely/txn/internal/tracker/server"
+)
+
+// runReprocess reruns archived transactions through the tracker rules
+func runReprocess(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reprocess", flag.ContinueOnError)
+	since := fs.String("since", "", "Only transactions created at or after this RFC 3339 time")
+	until := fs.String("until", "", "Only transactions created before this RFC 3339 time")
+	apply := fs.Bool("apply", false, "Apply the changes instead of showing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	sinceTime, err := parseTimeFlag("since", *since)
+	if err != nil {
+		return err
+	}
+	untilTime, err := parseTimeFlag("until", *until)
+	if err != nil {
+		return err
+	}
+
+	user, password, host, port, name := dbConfig()
+	archive, err := balancedb.NewClient(user, password, host, port, name)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to balance database")
+	}
+	db, err := database.NewClient(user, password, host, port, name)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to tracker database")
+	}
+
+	result, err := server.Reprocess(ctx, db, balance.NewHistory(archive), sinceTime, untilTime, !*apply)
+	if err != nil {
+		return errors.Wrap(err, "failed to reprocess transactions")
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tTIME\tTRANSACTION\tBEFORE\tAFTER")
+	for _, change := range result.Changes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			change.Action,
+			change.Time().Format(time.RFC3339),
+			change.SourceTransactionID,
+			describeEvent(change.Before),
+			describeEvent(change.After))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d transactions: %d added, %d changed, %d removed, %d unchanged\n",
+		result.Transactions, result.Added, result.Changed, result.Removed, result.Unchanged)
+	if result.DryRun && len(result.Changes) > 0 {
+		fmt.Println("Dry run, rerun with -apply to apply these changes")
+	}
+	return nil
+}
+
+// describeEvent summarises a caffeine event for a table cell
+func describeEvent(e *models.CaffeineEvent) string {
+	if e == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%s %dmg $%d.%02d", e.Description, e.Amount, e.Cost/100, e.Cost%100)
+}
+
+// parseTimeFlag parses an optional RFC 3339 flag value
+func parseTimeFlag(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.Wrap(errors.ErrInvalidInput, "invalid -%s time", name)
+	}
+	return t, nil
+}
+
+// dbConfig reads the database connection settings from the environment
+func dbConfig() (user, password, host, port, name string) {
+	return os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME")
+}
@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/baely/txn/internal/common/errors"
+)
+
+const webhooksUsage = `Usage: txn webhooks <command>
+
+Commands:
+  list                                    List registered webhooks
+  create -url URL [-description TEXT]     Register a webhook and print its secret key
+  delete ID                               Delete a webhook
+  ping ID                                 Send a PING event to a webhook
+  logs [-limit N] ID                      Show recent delivery attempts
+`
+
+// runWebhooks dispatches the webhooks subcommands
+func runWebhooks(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, webhooksUsage)
+		return errors.Wrap(errors.ErrInvalidInput, "missing webhooks command")
+	}
+
+	switch args[0] {
+	case "list":
+		return webhooksList(ctx)
+	case "create":
+		return webhooksCreate(ctx, args[1:])
+	case "delete":
+		return webhooksDelete(ctx, args[1:])
+	case "ping":
+		return webhooksPing(ctx, args[1:])
+	case "logs":
+		return webhooksLogs(ctx, args[1:])
+	default:
+		fmt.Fprint(os.Stderr, webhooksUsage)
+		return errors.Wrap(errors.ErrInvalidInput, "unknown webhooks command %q", args[0])
+	}
+}
+
+func webhooksList(ctx context.Context) error {
+	client, err := upClient()
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := client.ListWebhooks(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list webhooks")
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tURL\tDESCRIPTION\tCREATED")
+	for _, w := range webhooks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", w.ID, w.URL, w.Description, w.CreatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+func webhooksCreate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("webhooks create", flag.ContinueOnError)
+	url := fs.String("url", "", "URL Up should deliver events to")
+	description := fs.String("description", "", "Description of the webhook")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *url == "" {
+		return errors.Wrap(errors.ErrInvalidInput, "-url is required")
+	}
+
+	client, err := upClient()
+	if err != nil {
+		return err
+	}
+
+	webhook, err := client.CreateWebhook(ctx, *url, *description)
+	if err != nil {
+		return errors.Wrap(err, "failed to create webhook")
+	}
+
+	fmt.Printf("ID:         %s\n", webhook.ID)
+	fmt.Printf("URL:        %s\n", webhook.URL)
+	fmt.Printf("Secret key: %s\n", webhook.SecretKey)
+	fmt.Fprintln(os.Stderr, "\nUp will not show the secret key again. Set it as UP_WEBHOOK_SECRET.")
+	return nil
+}
+
+func webhooksDelete(ctx context.Context, args []string) error {
+	id, err := webhookIDArg(args)
+	if err != nil {
+		return err
+	}
+
+	client, err := upClient()
+	if err != nil {
+		return err
+	}
+
+	if err := client.DeleteWebhook(ctx, id); err != nil {
+		return errors.Wrap(err, "failed to delete webhook")
+	}
+	fmt.Printf("Deleted webhook %s\n", id)
+	return nil
+}
+
+func webhooksPing(ctx context.Context, args []string) error {
+	id, err := webhookIDArg(args)
+	if err != nil {
+		return err
+	}
+
+	client, err := upClient()
+	if err != nil {
+		return err
+	}
+
+	eventID, err := client.PingWebhook(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to ping webhook")
+	}
+	fmt.Printf("Sent PING event %s\n", eventID)
+	return nil
+}
+
+func webhooksLogs(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("webhooks logs", flag.ContinueOnError)
+	limit := fs.Int("limit", 20, "Number of delivery attempts to show")
+	verbose := fs.Bool("v", false, "Show request and response bodies")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := webhookIDArg(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	client, err := upClient()
+	if err != nil {
+		return err
+	}
+
+	logs, err := client.ListWebhookLogs(ctx, id, *limit)
+	if err != nil {
+		return errors.Wrap(err, "failed to list webhook logs")
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CREATED\tSTATUS\tCODE\tEVENT")
+	for _, l := range logs {
+		code := "-"
+		if l.StatusCode != 0 {
+			code = fmt.Sprint(l.StatusCode)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", l.CreatedAt.Format(time.RFC3339), l.DeliveryStatus, code, l.EventID)
+		if *verbose {
+			fmt.Fprintf(tw, "\trequest:  %s\n", l.RequestBody)
+			fmt.Fprintf(tw, "\tresponse: %s\n", l.ResponseBody)
+		}
+	}
+	return tw.Flush()
+}
+
+// webhookIDArg returns the single webhook id argument
+func webhookIDArg(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.Wrap(errors.ErrInvalidInput, "expected a webhook id")
+	}
+	return args[0], nil
+}
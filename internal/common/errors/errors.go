@@ -13,6 +13,7 @@ var (
 	ErrUnauthorized  = errors.New("unauthorized")
 	ErrInternal      = errors.New("internal error")
 	ErrAlreadyExists = errors.New("already exists")
+	ErrUnavailable   = errors.New("service unavailable")
 )
 
 // Wrap adds context to an error while preserving the original error
@@ -2,9 +2,13 @@
 package http
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -62,6 +66,10 @@ func HandleError(w http.ResponseWriter, err error) {
 		statusCode = http.StatusUnauthorized
 	case errors.Is(err, errors.ErrAlreadyExists):
 		statusCode = http.StatusConflict
+	case errors.Is(err, errors.ErrUnavailable):
+		statusCode = http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		statusCode = http.StatusGatewayTimeout
 	}
 
 	Error(w, err, statusCode)
@@ -79,3 +87,30 @@ func NewRouter() *chi.Mux {
 
 	return r
 }
+
+// RequireBearerToken rejects requests that do not carry the given bearer token.
+// An empty token rejects every request.
+func RequireBearerToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				Error(w, errors.ErrUnauthorized, http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Timeout bounds the request context to d. Handlers that pass the context down
+// fail with context.DeadlineExceeded once it runs out.
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -17,8 +17,6 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-
-	"github.com/baely/txn/internal/balance"
 )
 
 // Melbourne timezone for all operations
@@ -108,16 +106,6 @@ func (s *PresenceService) Chi() chi.Router {
 	return s.router
 }
 
-// HandleEvent processes transaction events from the webhook service
-// It implements the balance.TransactionEventHandler interface
-// This is now a no-op since we don't use transaction data anymore
-func (s *PresenceService) HandleEvent(event balance.TransactionEvent) error {
-	s.logger.Debug("Received transaction event (ignored)",
-		"description", event.Transaction.Attributes.Description,
-		"amount", event.Transaction.Attributes.Amount.Value)
-	return nil
-}
-
 // Embedded static assets
 var (
 	//go:embed index.html
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/baely/txn/internal/common/errors"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+const candidateColumns = `id, source_transaction_id, merchant, raw_text, category, cost, timestamp, status,
+	drink, caffeine, rule_id, created_at, reviewed_at`
+
+// AddCandidate queues an unmatched purchase for review. A transaction is only
+// queued once, so replays do not undo an earlier review.
+func (c *Client) AddCandidate(ctx context.Context, candidate models.Candidate) error {
+	q := `INSERT INTO caffeine_candidate (source_transaction_id, merchant, raw_text, category, cost, timestamp)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (source_transaction_id) DO NOTHING`
+	_, err := c.db.ExecContext(ctx, q, candidate.SourceTransactionID, candidate.Merchant, candidate.RawText,
+		candidate.Category, candidate.Cost, candidate.Timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to add candidate: %w", err)
+	}
+	return nil
+}
+
+// DeletePendingCandidate removes an unreviewed candidate, when its transaction
+// is deleted or a rule now matches it
+func (c *Client) DeletePendingCandidate(ctx context.Context, transactionID string) error {
+	q := `DELETE FROM caffeine_candidate WHERE source_transaction_id = $1 AND status = $2`
+	if _, err := c.db.ExecContext(ctx, q, transactionID, models.CandidatePending); err != nil {
+		return fmt.Errorf("failed to delete candidate: %w", err)
+	}
+	return nil
+}
+
+// ListCandidates returns candidates with the given status, oldest first
+func (c *Client) ListCandidates(ctx context.Context, status models.CandidateStatus) ([]models.Candidate, error) {
+	q := `SELECT ` + candidateColumns + ` FROM caffeine_candidate WHERE status = $1 ORDER BY timestamp, id`
+	rows, err := c.db.QueryContext(ctx, q, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query candidates: %w", err)
+	}
+	defer rows.Close()
+
+	candidates := make([]models.Candidate, 0)
+	for rows.Next() {
+		candidate, err := scanCandidate(rows)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read candidates: %w", err)
+	}
+	return candidates, nil
+}
+
+// GetCandidate returns a single candidate
+func (c *Client) GetCandidate(ctx context.Context, id int64) (models.Candidate, error) {
+	q := `SELECT ` + candidateColumns + ` FROM caffeine_candidate WHERE id = $1`
+	candidate, err := scanCandidate(c.db.QueryRowContext(ctx, q, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Candidate{}, errors.Wrap(errors.ErrNotFound, "candidate %d", id)
+	}
+	return candidate, err
+}
+
+// ResolveCandidate records a review in a single transaction: the optional rule
+// is created, the optional event recorded, and the candidate marked reviewed.
+// The event is recorded as edited so reprocessing keeps it. Candidates can
+// only be reviewed once.
+func (c *Client) ResolveCandidate(ctx context.Context, id int64, status models.CandidateStatus, event *models.CaffeineEvent, rule *models.Rule) (models.Candidate, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Candidate{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current models.CandidateStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM caffeine_candidate WHERE id = $1 FOR UPDATE`, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Candidate{}, errors.Wrap(errors.ErrNotFound, "candidate %d", id)
+	}
+	if err != nil {
+		return models.Candidate{}, fmt.Errorf("failed to lock candidate: %w", err)
+	}
+	if current != models.CandidatePending {
+		return models.Candidate{}, errors.Wrap(errors.ErrAlreadyExists, "candidate %d was already classified as %s", id, current)
+	}
+
+	var ruleID *int64
+	if rule != nil {
+		created, err := insertRule(ctx, tx, *rule)
+		if err != nil {
+			return models.Candidate{}, err
+		}
+		ruleID = &created.ID
+	}
+
+	drink, caffeine := "", 0
+	if event != nil {
+		q := `INSERT INTO caffeine_event (timestamp, description, amount, cost, source_transaction_id, confidence, flagged, edited)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, TRUE) ON CONFLICT (source_transaction_id, source_item) DO NOTHING`
+		_, err := tx.ExecContext(ctx, q, event.Timestamp.Unix(), event.Description, event.Amount, event.Cost,
+			event.SourceTransactionID, event.Confidence, event.Flagged)
+		if err != nil {
+			return models.Candidate{}, fmt.Errorf("failed to add event: %w", err)
+		}
+		drink, caffeine = event.Description, event.Amount
+	}
+
+	q := `UPDATE caffeine_candidate SET status = $2, drink = $3, caffeine = $4, rule_id = $5, reviewed_at = now()
+		WHERE id = $1
+		RETURNING ` + candidateColumns
+	candidate, err := scanCandidate(tx.QueryRowContext(ctx, q, id, status, drink, caffeine, ruleID))
+	if err != nil {
+		return models.Candidate{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Candidate{}, fmt.Errorf("failed to commit review: %w", err)
+	}
+	return candidate, nil
+}
+
+func scanCandidate(row scanner) (models.Candidate, error) {
+	var candidate models.Candidate
+	var ruleID sql.NullInt64
+	var reviewedAt sql.NullTime
+	err := row.Scan(&candidate.ID, &candidate.SourceTransactionID, &candidate.Merchant, &candidate.RawText, &candidate.Category,
+		&candidate.Cost, &candidate.Timestamp, &candidate.Status, &candidate.Drink, &candidate.Caffeine, &ruleID,
+		&candidate.CreatedAt, &reviewedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return candidate, err
+	}
+	if err != nil {
+		return candidate, fmt.Errorf("failed to scan candidate: %w", err)
+	}
+	if ruleID.Valid {
+		candidate.RuleID = &ruleID.Int64
+	}
+	if reviewedAt.Valid {
+		candidate.ReviewedAt = &reviewedAt.Time
+	}
+	return candidate, nil
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/baely/txn/internal/common/errors"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+// GetEvent returns a single caffeine event that has not been deleted
+func (c *Client) GetEvent(ctx context.Context, id int64) (models.CaffeineEvent, error) {
+	q := `SELECT ` + eventSelectColumns + ` FROM caffeine_event WHERE id = $1 AND NOT deleted`
+	event, err := scanEvent(c.db.QueryRowContext(ctx, q, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.CaffeineEvent{}, errors.Wrap(errors.ErrNotFound, "event %d", id)
+	}
+	return event, err
+}
+
+// CreateEvent records a manually logged caffeine event and returns it as stored
+func (c *Client) CreateEvent(ctx context.Context, event models.CaffeineEvent) (models.CaffeineEvent, error) {
+	q := `INSERT INTO caffeine_event (` + eventColumns + `)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10)
+		RETURNING ` + eventSelectColumns
+	created, err := scanEvent(c.db.QueryRowContext(ctx, q, event.Timestamp.Unix(), event.Description, event.Amount, event.Cost,
+		event.SourceTransactionID, event.SourceItem, event.Confidence, event.Flagged, event.ForSomeoneElse, event.Edited))
+	if err != nil {
+		return models.CaffeineEvent{}, fmt.Errorf("failed to create event: %w", err)
+	}
+	return created, nil
+}
+
+// UpdateEvent replaces the editable fields of an event and returns it as stored
+func (c *Client) UpdateEvent(ctx context.Context, event models.CaffeineEvent) (models.CaffeineEvent, error) {
+	q := `UPDATE caffeine_event SET timestamp = $2, description = $3, amount = $4, cost = $5, flagged = $6,
+			for_someone_else = $7, edited = $8
+		WHERE id = $1 AND NOT deleted
+		RETURNING ` + eventSelectColumns
+	updated, err := scanEvent(c.db.QueryRowContext(ctx, q, event.ID, event.Timestamp.Unix(), event.Description, event.Amount,
+		event.Cost, event.Flagged, event.ForSomeoneElse, event.Edited))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.CaffeineEvent{}, errors.Wrap(errors.ErrNotFound, "event %d", event.ID)
+	}
+	return updated, err
+}
+
+// DeleteEvent removes a manually logged caffeine event. Events from Up
+// transactions are marked deleted and edited instead, so backfills and
+// reprocessing do not add them back.
+func (c *Client) DeleteEvent(ctx context.Context, id int64) error {
+	q := `UPDATE caffeine_event SET deleted = TRUE, edited = TRUE WHERE id = $1 AND source_transaction_id IS NOT NULL AND NOT deleted`
+	res, err := c.db.ExecContext(ctx, q, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		res, err = c.db.ExecContext(ctx, `DELETE FROM caffeine_event WHERE id = $1 AND source_transaction_id IS NULL`, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete event: %w", err)
+		}
+		if n, err = res.RowsAffected(); err != nil {
+			return err
+		}
+	}
+	if n == 0 {
+		return errors.Wrap(errors.ErrNotFound, "event %d", id)
+	}
+	return nil
+}
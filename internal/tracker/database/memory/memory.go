@@ -0,0 +1,636 @@
+// Package memory is an in-memory tracker store for local development. Nothing
+// is persisted, so every run starts from the default rules and presets.
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/baely/txn/internal/common/errors"
+	"github.com/baely/txn/internal/tracker/database"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+// Store keeps tracker data in maps guarded by a single lock
+type Store struct {
+	mu sync.Mutex
+
+	events     map[int64]models.CaffeineEvent
+	rules      map[int64]models.Rule
+	candidates map[int64]models.Candidate
+	presets    map[string]models.Preset
+	profile    models.Profile
+	lastID     int64
+}
+
+var _ database.Store = (*Store)(nil)
+
+// New returns an empty store seeded with the default rules and presets
+func New() *Store {
+	s := &Store{
+		events:     make(map[int64]models.CaffeineEvent),
+		rules:      make(map[int64]models.Rule),
+		candidates: make(map[int64]models.Candidate),
+		presets:    make(map[string]models.Preset),
+		profile:    database.DefaultProfile,
+	}
+	for _, rule := range database.DefaultRules {
+		s.insertRule(rule)
+	}
+	for _, preset := range database.DefaultPresets {
+		s.insertPreset(preset)
+	}
+	return s
+}
+
+// nextID returns a new id. Ids are shared across tables, which is fine since
+// they only need to be unique within one.
+func (s *Store) nextID() int64 {
+	s.lastID++
+	return s.lastID
+}
+
+// AddEvent records a caffeine event. Events with a source transaction id are
+// only recorded once, so replaying a transaction is a no-op.
+func (s *Store) AddEvent(ctx context.Context, event models.CaffeineEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if event.SourceTransactionID != "" && s.findBySource(event.SourceTransactionID, event.SourceItem) != 0 {
+		return nil
+	}
+	s.insertEvent(event)
+	return nil
+}
+
+// GetEvents returns the caffeine events strictly between start and end, oldest first
+func (s *Store) GetEvents(ctx context.Context, start, end time.Time) ([]models.CaffeineEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filterEvents(func(e models.CaffeineEvent) bool {
+		return inRange(e, start.Unix(), end.Unix()) && counted(e)
+	}), nil
+}
+
+// GetTotalCost returns the cost in cents of the events between start and end
+func (s *Store) GetTotalCost(ctx context.Context, start, end time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cost := 0
+	for _, e := range s.events {
+		if inRange(e, max(start.Unix(), 0), end.Unix()) && counted(e) {
+			cost += e.Cost
+		}
+	}
+	return cost, nil
+}
+
+// GetTotalIntake returns the caffeine in mg of the events between start and
+// end, leaving out drinks bought for someone else
+func (s *Store) GetTotalIntake(ctx context.Context, start, end time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	intake := 0
+	for _, e := range s.events {
+		if inRange(e, max(start.Unix(), 0), end.Unix()) && counted(e) && !e.ForSomeoneElse {
+			intake += e.Amount
+		}
+	}
+	return intake, nil
+}
+
+// GetEvent returns a single caffeine event that has not been deleted
+func (s *Store) GetEvent(ctx context.Context, id int64) (models.CaffeineEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event, ok := s.events[id]
+	if !ok || event.Deleted {
+		return models.CaffeineEvent{}, errors.Wrap(errors.ErrNotFound, "event %d", id)
+	}
+	return event, nil
+}
+
+// CreateEvent records a manually logged caffeine event and returns it as stored
+func (s *Store) CreateEvent(ctx context.Context, event models.CaffeineEvent) (models.CaffeineEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if event.SourceTransactionID != "" && s.findBySource(event.SourceTransactionID, event.SourceItem) != 0 {
+		return models.CaffeineEvent{}, errors.Wrap(errors.ErrAlreadyExists, "event for transaction %s item %d", event.SourceTransactionID, event.SourceItem)
+	}
+	return s.insertEvent(event), nil
+}
+
+// UpdateEvent replaces the editable fields of an event and returns it as stored
+func (s *Store) UpdateEvent(ctx context.Context, event models.CaffeineEvent) (models.CaffeineEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.events[event.ID]
+	if !ok || stored.Deleted {
+		return models.CaffeineEvent{}, errors.Wrap(errors.ErrNotFound, "event %d", event.ID)
+	}
+	stored.Timestamp = time.Unix(event.Timestamp.Unix(), 0)
+	stored.Description = event.Description
+	stored.Amount = event.Amount
+	stored.Cost = event.Cost
+	stored.Flagged = event.Flagged
+	stored.ForSomeoneElse = event.ForSomeoneElse
+	stored.Edited = event.Edited
+	s.events[event.ID] = stored
+	return stored, nil
+}
+
+// DeleteEvent removes a manually logged caffeine event. Events from Up
+// transactions are marked deleted and edited instead, so backfills and
+// reprocessing do not add them back.
+func (s *Store) DeleteEvent(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event, ok := s.events[id]
+	if !ok || event.Deleted {
+		return errors.Wrap(errors.ErrNotFound, "event %d", id)
+	}
+	if event.SourceTransactionID == "" {
+		delete(s.events, id)
+		return nil
+	}
+	event.Deleted, event.Edited = true, true
+	s.events[id] = event
+	return nil
+}
+
+// GetEventsBySource returns the caffeine events recorded for the given Up transactions
+func (s *Store) GetEventsBySource(ctx context.Context, transactionIDs []string) ([]models.CaffeineEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filterEvents(func(e models.CaffeineEvent) bool {
+		return e.SourceTransactionID != "" && slices.Contains(transactionIDs, e.SourceTransactionID)
+	}), nil
+}
+
+// GetFlaggedEvents returns events matched with low confidence, oldest first
+func (s *Store) GetFlaggedEvents(ctx context.Context) ([]models.CaffeineEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filterEvents(func(e models.CaffeineEvent) bool {
+		return e.Flagged && counted(e)
+	}), nil
+}
+
+// DeleteEventsBySource removes the caffeine events recorded for an Up
+// transaction and undoes any purchases it reversed
+func (s *Store) DeleteEventsBySource(ctx context.Context, transactionID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var removed int64
+	for id, e := range s.events {
+		switch {
+		case e.SourceTransactionID == transactionID:
+			delete(s.events, id)
+			removed++
+		case e.ReversedBy == transactionID:
+			e.ReversedBy, e.ReversedByItem = "", 0
+			s.events[id] = e
+		}
+	}
+	return removed, nil
+}
+
+// ReverseRefundedEvent marks the most recent Up purchase matching a refund as
+// reversed by it. Each refund reverses at most one purchase, so replaying it
+// is a no-op.
+func (s *Store) ReverseRefundedEvent(ctx context.Context, refund models.CaffeineEvent) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.events {
+		if e.ReversedBy == refund.SourceTransactionID && e.ReversedByItem == refund.SourceItem {
+			return 0, nil
+		}
+	}
+	matches := s.filterEvents(func(e models.CaffeineEvent) bool {
+		return e.SourceTransactionID != "" && counted(e) &&
+			e.Description == refund.Description && e.Cost == refund.Cost && e.Timestamp.Unix() <= refund.Timestamp.Unix()
+	})
+	if len(matches) == 0 {
+		return 0, nil
+	}
+	event := matches[len(matches)-1]
+	event.ReversedBy, event.ReversedByItem = refund.SourceTransactionID, refund.SourceItem
+	s.events[event.ID] = event
+	return 1, nil
+}
+
+// SetForSomeoneElse marks whether a drink was bought for someone else
+func (s *Store) SetForSomeoneElse(ctx context.Context, transactionID string, item int, forSomeoneElse bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.findBySource(transactionID, item)
+	if id == 0 {
+		return errors.Wrap(errors.ErrNotFound, "event for transaction %s item %d", transactionID, item)
+	}
+	event := s.events[id]
+	event.ForSomeoneElse = forSomeoneElse
+	s.events[id] = event
+	return nil
+}
+
+// ApplyEventChanges applies a reprocessing diff, all or nothing
+func (s *Store) ApplyEventChanges(ctx context.Context, changes []models.EventChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events, candidates := maps.Clone(s.events), maps.Clone(s.candidates)
+	for _, change := range changes {
+		id := s.findBySource(change.SourceTransactionID, change.SourceItem)
+		switch change.Action {
+		case models.ChangeAdd:
+			if id == 0 {
+				e := *change.After
+				s.insertEvent(models.CaffeineEvent{
+					Timestamp:           e.Timestamp,
+					Description:         e.Description,
+					Amount:              e.Amount,
+					Cost:                e.Cost,
+					SourceTransactionID: change.SourceTransactionID,
+					SourceItem:          change.SourceItem,
+					Confidence:          e.Confidence,
+					Flagged:             e.Flagged,
+					ReversedBy:          e.ReversedBy,
+					ReversedByItem:      e.ReversedByItem,
+				})
+			}
+			// A rule now covers the purchase, so it no longer needs review
+			s.deletePendingCandidate(change.SourceTransactionID)
+		case models.ChangeUpdate:
+			if id != 0 {
+				e, stored := change.After, s.events[id]
+				stored.Timestamp = time.Unix(e.Timestamp.Unix(), 0)
+				stored.Description = e.Description
+				stored.Amount = e.Amount
+				stored.Cost = e.Cost
+				stored.Confidence = e.Confidence
+				stored.Flagged = e.Flagged
+				stored.ReversedBy, stored.ReversedByItem = e.ReversedBy, e.ReversedByItem
+				s.events[id] = stored
+			}
+		case models.ChangeRemove:
+			delete(s.events, id)
+		default:
+			s.events, s.candidates = events, candidates
+			return fmt.Errorf("failed to apply %s for transaction %s item %d: unknown change action %q",
+				change.Action, change.SourceTransactionID, change.SourceItem, change.Action)
+		}
+	}
+	return nil
+}
+
+// insertEvent stores an event under a new id, keeping timestamps to the
+// second like the other stores
+func (s *Store) insertEvent(event models.CaffeineEvent) models.CaffeineEvent {
+	event.ID = s.nextID()
+	event.Timestamp = time.Unix(event.Timestamp.Unix(), 0)
+	s.events[event.ID] = event
+	return event
+}
+
+// findBySource returns the id of a transaction's event, or 0 if there is none
+func (s *Store) findBySource(transactionID string, item int) int64 {
+	for id, e := range s.events {
+		if e.SourceTransactionID == transactionID && e.SourceItem == item {
+			return id
+		}
+	}
+	return 0
+}
+
+// filterEvents returns the matching events by time, then item and id
+func (s *Store) filterEvents(match func(models.CaffeineEvent) bool) []models.CaffeineEvent {
+	events := make([]models.CaffeineEvent, 0)
+	for _, e := range s.events {
+		if match(e) {
+			events = append(events, e)
+		}
+	}
+	slices.SortFunc(events, func(a, b models.CaffeineEvent) int {
+		return cmp.Or(
+			a.Timestamp.Compare(b.Timestamp),
+			cmp.Compare(a.SourceItem, b.SourceItem),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+	return events
+}
+
+// inRange reports whether an event falls strictly between two unix times
+func inRange(e models.CaffeineEvent, start, end int64) bool {
+	t := e.Timestamp.Unix()
+	return t > start && t < end
+}
+
+// counted reports whether an event counts towards levels and totals, which
+// refunded and deleted purchases do not
+func counted(e models.CaffeineEvent) bool {
+	return e.ReversedBy == "" && !e.Deleted
+}
+
+// ListRules returns every matching rule in evaluation order
+func (s *Store) ListRules(ctx context.Context) ([]models.Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rules := make([]models.Rule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		rules = append(rules, cloneRule(rule))
+	}
+	slices.SortFunc(rules, func(a, b models.Rule) int {
+		return cmp.Or(cmp.Compare(a.Priority, b.Priority), cmp.Compare(a.ID, b.ID))
+	})
+	return rules, nil
+}
+
+// GetRule returns a single rule
+func (s *Store) GetRule(ctx context.Context, id int64) (models.Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule, ok := s.rules[id]
+	if !ok {
+		return models.Rule{}, errors.Wrap(errors.ErrNotFound, "rule %d", id)
+	}
+	return cloneRule(rule), nil
+}
+
+// CreateRule adds a rule and returns it as stored
+func (s *Store) CreateRule(ctx context.Context, rule models.Rule) (models.Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return cloneRule(s.insertRule(rule)), nil
+}
+
+// UpdateRule replaces a rule and returns it as stored
+func (s *Store) UpdateRule(ctx context.Context, rule models.Rule) (models.Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.rules[rule.ID]
+	if !ok {
+		return models.Rule{}, errors.Wrap(errors.ErrNotFound, "rule %d", rule.ID)
+	}
+	rule = cloneRule(rule)
+	rule.CreatedAt = stored.CreatedAt
+	rule.UpdatedAt = time.Now()
+	s.rules[rule.ID] = rule
+	return cloneRule(rule), nil
+}
+
+// DeleteRule removes a rule. Candidates reviewed into it keep their review.
+func (s *Store) DeleteRule(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rules[id]; !ok {
+		return errors.Wrap(errors.ErrNotFound, "rule %d", id)
+	}
+	delete(s.rules, id)
+	for cid, candidate := range s.candidates {
+		if candidate.RuleID != nil && *candidate.RuleID == id {
+			candidate.RuleID = nil
+			s.candidates[cid] = candidate
+		}
+	}
+	return nil
+}
+
+func (s *Store) insertRule(rule models.Rule) models.Rule {
+	rule = cloneRule(rule)
+	if rule.MerchantMatch == "" {
+		rule.MerchantMatch = models.MatchExact
+	}
+	rule.ID = s.nextID()
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = rule.CreatedAt
+	s.rules[rule.ID] = rule
+	return rule
+}
+
+// cloneRule copies a rule so callers cannot change the stored prices
+func cloneRule(rule models.Rule) models.Rule {
+	rule.Price = clonePtr(rule.Price)
+	rule.MinPrice = clonePtr(rule.MinPrice)
+	rule.MaxPrice = clonePtr(rule.MaxPrice)
+	return rule
+}
+
+func clonePtr[T any](v *T) *T {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+// AddCandidate queues an unmatched purchase for review. A transaction is only
+// queued once, so replays do not undo an earlier review.
+func (s *Store) AddCandidate(ctx context.Context, candidate models.Candidate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.candidates {
+		if c.SourceTransactionID == candidate.SourceTransactionID {
+			return nil
+		}
+	}
+	id := s.nextID()
+	s.candidates[id] = models.Candidate{
+		ID:                  id,
+		SourceTransactionID: candidate.SourceTransactionID,
+		Merchant:            candidate.Merchant,
+		RawText:             candidate.RawText,
+		Category:            candidate.Category,
+		Cost:                candidate.Cost,
+		Timestamp:           candidate.Timestamp,
+		Status:              models.CandidatePending,
+		CreatedAt:           time.Now(),
+	}
+	return nil
+}
+
+// DeletePendingCandidate removes an unreviewed candidate, when its transaction
+// is deleted or a rule now matches it
+func (s *Store) DeletePendingCandidate(ctx context.Context, transactionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deletePendingCandidate(transactionID)
+	return nil
+}
+
+func (s *Store) deletePendingCandidate(transactionID string) {
+	for id, c := range s.candidates {
+		if c.SourceTransactionID == transactionID && c.Status == models.CandidatePending {
+			delete(s.candidates, id)
+		}
+	}
+}
+
+// ListCandidates returns candidates with the given status, oldest first
+func (s *Store) ListCandidates(ctx context.Context, status models.CandidateStatus) ([]models.Candidate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	candidates := make([]models.Candidate, 0)
+	for _, c := range s.candidates {
+		if c.Status == status {
+			candidates = append(candidates, cloneCandidate(c))
+		}
+	}
+	slices.SortFunc(candidates, func(a, b models.Candidate) int {
+		return cmp.Or(a.Timestamp.Compare(b.Timestamp), cmp.Compare(a.ID, b.ID))
+	})
+	return candidates, nil
+}
+
+// GetCandidate returns a single candidate
+func (s *Store) GetCandidate(ctx context.Context, id int64) (models.Candidate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	candidate, ok := s.candidates[id]
+	if !ok {
+		return models.Candidate{}, errors.Wrap(errors.ErrNotFound, "candidate %d", id)
+	}
+	return cloneCandidate(candidate), nil
+}
+
+// ResolveCandidate records a review: the optional rule is created, the
+// optional event recorded as edited, and the candidate marked reviewed.
+// Candidates can only be reviewed once.
+func (s *Store) ResolveCandidate(ctx context.Context, id int64, status models.CandidateStatus, event *models.CaffeineEvent, rule *models.Rule) (models.Candidate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	candidate, ok := s.candidates[id]
+	if !ok {
+		return models.Candidate{}, errors.Wrap(errors.ErrNotFound, "candidate %d", id)
+	}
+	if candidate.Status != models.CandidatePending {
+		return models.Candidate{}, errors.Wrap(errors.ErrAlreadyExists, "candidate %d was already classified as %s", id, candidate.Status)
+	}
+
+	if rule != nil {
+		created := s.insertRule(*rule)
+		candidate.RuleID = &created.ID
+	}
+	if event != nil {
+		if s.findBySource(event.SourceTransactionID, 0) == 0 {
+			s.insertEvent(models.CaffeineEvent{
+				Timestamp:           event.Timestamp,
+				Description:         event.Description,
+				Amount:              event.Amount,
+				Cost:                event.Cost,
+				SourceTransactionID: event.SourceTransactionID,
+				Confidence:          event.Confidence,
+				Flagged:             event.Flagged,
+				Edited:              true,
+			})
+		}
+		candidate.Drink, candidate.Caffeine = event.Description, event.Amount
+	}
+
+	now := time.Now()
+	candidate.Status = status
+	candidate.ReviewedAt = &now
+	s.candidates[id] = candidate
+	return cloneCandidate(candidate), nil
+}
+
+func cloneCandidate(c models.Candidate) models.Candidate {
+	c.RuleID = clonePtr(c.RuleID)
+	c.ReviewedAt = clonePtr(c.ReviewedAt)
+	return c
+}
+
+// ListPresets returns every preset by slug
+func (s *Store) ListPresets(ctx context.Context) ([]models.Preset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	presets := make([]models.Preset, 0, len(s.presets))
+	for _, preset := range s.presets {
+		presets = append(presets, preset)
+	}
+	slices.SortFunc(presets, func(a, b models.Preset) int {
+		return cmp.Compare(a.Slug, b.Slug)
+	})
+	return presets, nil
+}
+
+// GetPreset returns the preset with the given slug
+func (s *Store) GetPreset(ctx context.Context, slug string) (models.Preset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	preset, ok := s.presets[slug]
+	if !ok {
+		return models.Preset{}, errors.Wrap(errors.ErrNotFound, "preset %s", slug)
+	}
+	return preset, nil
+}
+
+// CreatePreset adds a preset and returns it as stored
+func (s *Store) CreatePreset(ctx context.Context, preset models.Preset) (models.Preset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.presets[preset.Slug]; ok {
+		return models.Preset{}, errors.Wrap(errors.ErrAlreadyExists, "preset %s", preset.Slug)
+	}
+	return s.insertPreset(preset), nil
+}
+
+// UpdatePreset replaces the preset with the given slug, which may be renamed
+func (s *Store) UpdatePreset(ctx context.Context, slug string, preset models.Preset) (models.Preset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.presets[slug]
+	if !ok {
+		return models.Preset{}, errors.Wrap(errors.ErrNotFound, "preset %s", slug)
+	}
+	if _, taken := s.presets[preset.Slug]; taken && preset.Slug != slug {
+		return models.Preset{}, errors.Wrap(errors.ErrAlreadyExists, "preset %s", preset.Slug)
+	}
+	stored.Slug = preset.Slug
+	stored.Description = preset.Description
+	stored.Amount = preset.Amount
+	stored.Cost = preset.Cost
+	stored.UpdatedAt = time.Now()
+	delete(s.presets, slug)
+	s.presets[stored.Slug] = stored
+	return stored, nil
+}
+
+// DeletePreset removes a preset. Events logged from it are kept.
+func (s *Store) DeletePreset(ctx context.Context, slug string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.presets[slug]; !ok {
+		return errors.Wrap(errors.ErrNotFound, "preset %s", slug)
+	}
+	delete(s.presets, slug)
+	return nil
+}
+
+func (s *Store) insertPreset(preset models.Preset) models.Preset {
+	preset.ID = s.nextID()
+	preset.CreatedAt = time.Now()
+	preset.UpdatedAt = preset.CreatedAt
+	s.presets[preset.Slug] = preset
+	return preset
+}
+
+// GetProfile returns the saved profile, or database.DefaultProfile if there is none
+func (s *Store) GetProfile(ctx context.Context) (models.Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.profile, nil
+}
+
+// UpdateProfile saves the profile and returns it as stored
+func (s *Store) UpdateProfile(ctx context.Context, profile models.Profile) (models.Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	profile.UpdatedAt = time.Now()
+	s.profile = profile
+	return profile, nil
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/baely/txn/internal/tracker/database"
+	"github.com/baely/txn/internal/tracker/database/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Store {
+		return New()
+	})
+}
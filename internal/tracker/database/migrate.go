@@ -0,0 +1,231 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/baely/txn/internal/common/errors"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock held while a migration runs, so
+// instances starting together apply each migration once
+const migrationLockID = 7_246_001
+
+// Migration is a versioned change to the tracker schema. Migrations are
+// embedded from migrations/NNNN_name.up.sql and the matching .down.sql, which
+// is left out of migrations that must not be reverted.
+type Migration struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // Nil until the migration is applied
+
+	up   string
+	down string
+}
+
+// loadMigrations reads the embedded migrations in version order
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %s", file)
+		}
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %s", file)
+		}
+
+		script, err := migrationFiles.ReadFile("migrations/" + file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.up = string(script)
+		} else {
+			m.down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+	return migrations, nil
+}
+
+// MigrationStatus returns every known migration, with when it was applied
+func (c *Client) MigrationStatus(ctx context.Context) ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range migrations {
+		if t, ok := applied[migrations[i].Version]; ok {
+			migrations[i].AppliedAt = &t
+		}
+	}
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration in order and returns the ones it applied
+func (c *Client) MigrateUp(ctx context.Context) ([]Migration, error) {
+	migrations, err := c.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]Migration, 0)
+	for _, m := range migrations {
+		if m.AppliedAt != nil {
+			continue
+		}
+		ran, err := c.runMigration(ctx, m, true)
+		if err != nil {
+			return applied, err
+		}
+		if ran {
+			applied = append(applied, m)
+		}
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts the most recent steps applied migrations and returns the
+// ones it reverted
+func (c *Client) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := c.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := make([]Migration, 0, steps)
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := migrations[i]
+		if m.AppliedAt == nil {
+			continue
+		}
+		if m.down == "" {
+			return reverted, errors.Wrap(errors.ErrInvalidInput, "migration %d %s cannot be reverted", m.Version, m.Name)
+		}
+		ran, err := c.runMigration(ctx, m, false)
+		if err != nil {
+			return reverted, err
+		}
+		if ran {
+			reverted = append(reverted, m)
+		}
+	}
+	return reverted, nil
+}
+
+// ensureMigrationsTable creates the table recording applied migrations
+func (c *Client) ensureMigrationsTable(ctx context.Context) error {
+	q := `CREATE TABLE IF NOT EXISTS caffeine_schema_migration (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`
+	if _, err := c.db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns when each applied migration was applied, by version
+func (c *Client) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	if err := c.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := c.db.QueryContext(ctx, `SELECT version, applied_at FROM caffeine_schema_migration`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// runMigration applies or reverts a migration and records it in one
+// transaction. It reports false when another instance got there first.
+func (c *Client) runMigration(ctx context.Context, m Migration, up bool) (bool, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+		return false, fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	var applied bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM caffeine_schema_migration WHERE version = $1)`, m.Version).Scan(&applied)
+	if err != nil {
+		return false, fmt.Errorf("failed to check migration %d: %w", m.Version, err)
+	}
+	if applied == up {
+		return false, nil
+	}
+
+	script, record := m.up, `INSERT INTO caffeine_schema_migration (version, name) VALUES ($1, $2)`
+	if !up {
+		script, record = m.down, `DELETE FROM caffeine_schema_migration WHERE version = $1 AND name = $2`
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return false, fmt.Errorf("failed to run migration %d %s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, m.Version, m.Name); err != nil {
+		return false, fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit migration %d: %w", m.Version, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,18 @@
+package database
+
+import "testing"
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("migration %s has version %d, want %d", m.Name, m.Version, i+1)
+		}
+	}
+	if migrations[0].down != "" {
+		t.Fatal("migration 1 adopts the original caffeine_event table and must not be reverted")
+	}
+}
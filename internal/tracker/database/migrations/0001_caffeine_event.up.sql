@@ -0,0 +1,7 @@
+-- Databases that predate migrations already have this table
+CREATE TABLE IF NOT EXISTS caffeine_event (
+	timestamp BIGINT NOT NULL,
+	description TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	cost INTEGER NOT NULL DEFAULT 0
+);
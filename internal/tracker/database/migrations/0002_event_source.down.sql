@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS caffeine_event_source_idx;
+ALTER TABLE caffeine_event DROP COLUMN IF EXISTS edited;
+ALTER TABLE caffeine_event DROP COLUMN IF EXISTS for_someone_else;
+ALTER TABLE caffeine_event DROP COLUMN IF EXISTS flagged;
+ALTER TABLE caffeine_event DROP COLUMN IF EXISTS confidence;
+ALTER TABLE caffeine_event DROP COLUMN IF EXISTS source_item;
+ALTER TABLE caffeine_event DROP COLUMN IF EXISTS source_transaction_id;
@@ -0,0 +1,9 @@
+-- Events matched from Up transactions, one per drink, with how well they matched
+ALTER TABLE caffeine_event ADD COLUMN IF NOT EXISTS source_transaction_id TEXT;
+ALTER TABLE caffeine_event ADD COLUMN IF NOT EXISTS source_item INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE caffeine_event ADD COLUMN IF NOT EXISTS confidence DOUBLE PRECISION NOT NULL DEFAULT 1;
+ALTER TABLE caffeine_event ADD COLUMN IF NOT EXISTS flagged BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE caffeine_event ADD COLUMN IF NOT EXISTS for_someone_else BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE caffeine_event ADD COLUMN IF NOT EXISTS edited BOOLEAN NOT NULL DEFAULT false;
+DROP INDEX IF EXISTS caffeine_event_source_transaction_id_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS caffeine_event_source_idx ON caffeine_event (source_transaction_id, source_item);
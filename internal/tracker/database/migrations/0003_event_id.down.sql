@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS caffeine_event_timestamp_idx;
+ALTER TABLE caffeine_event DROP COLUMN IF EXISTS id;
@@ -0,0 +1,15 @@
+-- Stable ids for the events API, filled in for existing rows, and an index
+-- for the time range queries
+ALTER TABLE caffeine_event ADD COLUMN IF NOT EXISTS id BIGSERIAL;
+DROP INDEX IF EXISTS caffeine_event_id_idx;
+DO $$
+BEGIN
+	IF NOT EXISTS (
+		SELECT 1 FROM pg_constraint
+		WHERE conrelid = 'caffeine_event'::regclass AND contype = 'p'
+	) THEN
+		ALTER TABLE caffeine_event ADD CONSTRAINT caffeine_event_pkey PRIMARY KEY (id);
+	END IF;
+END
+$$;
+CREATE INDEX IF NOT EXISTS caffeine_event_timestamp_idx ON caffeine_event (timestamp);
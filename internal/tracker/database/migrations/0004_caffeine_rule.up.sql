@@ -0,0 +1,41 @@
+-- Rules are seeded with the café lookup and Woolworths Dock heuristic that used
+-- to be compiled in, but only when the table is first created
+DO $$
+BEGIN
+	IF to_regclass('caffeine_rule') IS NULL THEN
+		CREATE TABLE caffeine_rule (
+			id BIGSERIAL PRIMARY KEY,
+			name TEXT NOT NULL DEFAULT '',
+			priority INTEGER NOT NULL DEFAULT 100,
+			disabled BOOLEAN NOT NULL DEFAULT false,
+			merchant_match TEXT NOT NULL DEFAULT 'exact',
+			merchant TEXT NOT NULL DEFAULT '',
+			category TEXT NOT NULL DEFAULT '',
+			raw_text TEXT NOT NULL DEFAULT '',
+			price INTEGER,
+			min_price INTEGER,
+			max_price INTEGER,
+			drink TEXT NOT NULL DEFAULT '',
+			caffeine INTEGER NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+
+		INSERT INTO caffeine_rule (merchant, category, price, caffeine) VALUES
+			('Charlie Bit Me Cafe', 'restaurants-and-cafes', 680, 160),
+			('Charlie Bit Me Cafe', 'restaurants-and-cafes', 700, 160),
+			('Charlie Bit Me Cafe', 'restaurants-and-cafes', 580, 80),
+			('Georgie Boy Espresso', 'restaurants-and-cafes', 550, 160),
+			('Georgie Boy Espresso', 'restaurants-and-cafes', 600, 160),
+			('Chia Chia', 'restaurants-and-cafes', 550, 160),
+			('Chia Chia', 'restaurants-and-cafes', 540, 160),
+			('Chia Chia', 'restaurants-and-cafes', 500, 80),
+			('Chia Chia', 'restaurants-and-cafes', 590, 240),
+			('In a Rush', 'restaurants-and-cafes', 560, 160),
+			('Mr Summit', 'restaurants-and-cafes', 550, 160),
+			('The Other Brother', 'restaurants-and-cafes', 600, 160);
+		INSERT INTO caffeine_rule (name, category, raw_text, min_price, max_price, drink, caffeine) VALUES
+			('Woolworths Dock espresso', 'groceries', 'WOOLWORTHS.*DOCK', 200, 700, 'Dare NAS Intense Espresso', 260);
+	END IF;
+END
+$$;
@@ -0,0 +1,3 @@
+ALTER TABLE caffeine_rule DROP COLUMN IF EXISTS not_caffeine;
+ALTER TABLE caffeine_rule DROP COLUMN IF EXISTS surcharge;
+ALTER TABLE caffeine_rule DROP COLUMN IF EXISTS tolerance;
@@ -0,0 +1,4 @@
+-- Price tolerance and card surcharges, and rules for purchases that are not caffeine
+ALTER TABLE caffeine_rule ADD COLUMN IF NOT EXISTS tolerance INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE caffeine_rule ADD COLUMN IF NOT EXISTS surcharge DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE caffeine_rule ADD COLUMN IF NOT EXISTS not_caffeine BOOLEAN NOT NULL DEFAULT false;
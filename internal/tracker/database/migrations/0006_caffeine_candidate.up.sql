@@ -0,0 +1,17 @@
+-- Café purchases no rule matched, kept for review
+CREATE TABLE IF NOT EXISTS caffeine_candidate (
+	id BIGSERIAL PRIMARY KEY,
+	source_transaction_id TEXT NOT NULL UNIQUE,
+	merchant TEXT NOT NULL,
+	raw_text TEXT NOT NULL DEFAULT '',
+	category TEXT NOT NULL,
+	cost INTEGER NOT NULL,
+	timestamp TIMESTAMPTZ NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	drink TEXT NOT NULL DEFAULT '',
+	caffeine INTEGER NOT NULL DEFAULT 0,
+	rule_id BIGINT REFERENCES caffeine_rule (id) ON DELETE SET NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	reviewed_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS caffeine_candidate_status_idx ON caffeine_candidate (status, timestamp);
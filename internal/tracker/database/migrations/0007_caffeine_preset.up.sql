@@ -0,0 +1,21 @@
+-- Quick-add presets, seeded with the drinks the old predefined-event endpoint
+-- logged, but only when the table is first created
+DO $$
+BEGIN
+	IF to_regclass('caffeine_preset') IS NULL THEN
+		CREATE TABLE caffeine_preset (
+			id BIGSERIAL PRIMARY KEY,
+			slug TEXT NOT NULL UNIQUE,
+			description TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			cost INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+
+		INSERT INTO caffeine_preset (slug, description, amount, cost) VALUES
+			('homemade-double-oat-latte', 'Homemade Double Oat Latte', 160, 250),
+			('the-jolly-miller', 'The Jolly Miller', 80, 600);
+	END IF;
+END
+$$;
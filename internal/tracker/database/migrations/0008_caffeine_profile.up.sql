@@ -0,0 +1,13 @@
+-- The personal profile caffeine levels and limits are worked out from. There
+-- is only ever one row.
+CREATE TABLE IF NOT EXISTS caffeine_profile (
+	id INTEGER PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+	half_life DOUBLE PRECISION,
+	weight DOUBLE PRECISION,
+	daily_limit INTEGER,
+	bedtime TEXT NOT NULL,
+	smoker BOOLEAN NOT NULL DEFAULT false,
+	oral_contraceptives BOOLEAN NOT NULL DEFAULT false,
+	pregnant BOOLEAN NOT NULL DEFAULT false,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
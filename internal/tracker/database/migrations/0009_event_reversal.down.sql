@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS caffeine_event_reversed_by_idx;
+DELETE FROM caffeine_event WHERE reversed_by IS NOT NULL;
+ALTER TABLE caffeine_event DROP COLUMN IF EXISTS reversed_by_item;
+ALTER TABLE caffeine_event DROP COLUMN IF EXISTS reversed_by;
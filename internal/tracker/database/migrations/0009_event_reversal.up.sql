@@ -0,0 +1,5 @@
+-- Refunds mark the purchase they reverse instead of deleting it, so a
+-- replayed refund or backfill finds it already reversed
+ALTER TABLE caffeine_event ADD COLUMN IF NOT EXISTS reversed_by TEXT;
+ALTER TABLE caffeine_event ADD COLUMN IF NOT EXISTS reversed_by_item INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS caffeine_event_reversed_by_idx ON caffeine_event (reversed_by, reversed_by_item);
@@ -0,0 +1,2 @@
+DELETE FROM caffeine_event WHERE deleted;
+ALTER TABLE caffeine_event DROP COLUMN IF EXISTS deleted;
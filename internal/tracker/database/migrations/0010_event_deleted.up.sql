@@ -0,0 +1,3 @@
+-- Deleting an event from an Up transaction hides it instead, so a backfill
+-- or reprocess does not add it back
+ALTER TABLE caffeine_event ADD COLUMN IF NOT EXISTS deleted BOOLEAN NOT NULL DEFAULT FALSE;
@@ -1,13 +1,15 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
+	"github.com/baely/txn/internal/common/errors"
 	"github.com/baely/txn/internal/tracker/models"
 )
 
@@ -15,9 +17,16 @@ type Client struct {
 	db *sql.DB
 }
 
-func NewClient(user, password, host, port, db string) (*Client, error) {
+// Connect opens the tracker database without changing its schema
+func Connect(user, password, host, port, db string) (*Client, error) {
 	connString := fmt.Sprintf("user=%s password=%s host=%s port=%s dbname=%s sslmode=disable", user, password, host, port, db)
-	driver, err := sql.Open("postgres", connString)
+	return ConnectDSN(connString)
+}
+
+// ConnectDSN opens the tracker database from a lib/pq connection string
+// without changing its schema
+func ConnectDSN(dsn string) (*Client, error) {
+	driver, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -26,10 +35,59 @@ func NewClient(user, password, host, port, db string) (*Client, error) {
 	}, nil
 }
 
-func (c *Client) AddEvent(event models.CaffeineEvent) error {
+// Close closes the database connections
+func (c *Client) Close() error {
+	return c.db.Close()
+}
+
+// NewClient opens the tracker database and applies any pending migrations
+func NewClient(user, password, host, port, db string) (*Client, error) {
+	c, err := Connect(user, password, host, port, db)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.MigrateUp(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range applied {
+		slog.Info("Applied tracker migration", "version", m.Version, "name", m.Name)
+	}
+	return c, nil
+}
+
+const eventColumns = `timestamp, description, amount, cost, source_transaction_id, source_item, confidence, flagged, for_someone_else, edited`
+
+// eventSelectColumns are the columns scanEvent reads
+const eventSelectColumns = `id, ` + eventColumns + `, reversed_by, reversed_by_item, deleted`
+
+// counted selects the events that count towards intake, cost and levels
+const counted = `reversed_by IS NULL AND NOT deleted`
+
+// scanEvent reads a row selected with eventSelectColumns
+func scanEvent(row scanner) (models.CaffeineEvent, error) {
+	var event models.CaffeineRow
+	err := row.Scan(&event.ID, &event.Timestamp, &event.Description, &event.Amount, &event.Cost, &event.SourceTransactionID,
+		&event.SourceItem, &event.Confidence, &event.Flagged, &event.ForSomeoneElse, &event.Edited, &event.ReversedBy, &event.ReversedByItem,
+		&event.Deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.CaffeineEvent{}, err
+	}
+	if err != nil {
+		return models.CaffeineEvent{}, fmt.Errorf("failed to scan event: %w", err)
+	}
+	return models.ToEvent(event), nil
+}
+
+// AddEvent records a caffeine event. Events with a source transaction id are
+// only recorded once, so replaying a transaction is a no-op.
+func (c *Client) AddEvent(ctx context.Context, event models.CaffeineEvent) error {
 	t := event.Timestamp.Unix()
-	q := `INSERT INTO caffeine_event (timestamp, description, amount, cost) VALUES ($1, $2, $3, $4)`
-	_, err := c.db.Exec(q, t, event.Description, event.Amount, event.Cost)
+	q := `INSERT INTO caffeine_event (` + eventColumns + `)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10)
+		ON CONFLICT (source_transaction_id, source_item) DO NOTHING`
+	_, err := c.db.ExecContext(ctx, q, t, event.Description, event.Amount, event.Cost, event.SourceTransactionID, event.SourceItem,
+		event.Confidence, event.Flagged, event.ForSomeoneElse, event.Edited)
 	if err != nil {
 		slog.Error("Failed to add event", "error", err)
 		return fmt.Errorf("failed to add event: %w", err)
@@ -37,52 +95,205 @@ func (c *Client) AddEvent(event models.CaffeineEvent) error {
 	return nil
 }
 
-func (c *Client) GetEvents(start, end time.Time) []models.CaffeineEvent {
-	events := make([]models.CaffeineEvent, 0)
-	startSeconds := start.Unix()
-	endSeconds := end.Unix()
-	q := `SELECT * FROM caffeine_event WHERE timestamp > $1 AND timestamp < $2 ORDER BY timestamp ASC`
-	rows, err := c.db.Query(q, startSeconds, endSeconds)
+// DeleteEventsBySource removes the caffeine events recorded for an Up
+// transaction. If it was a refund, the purchases it reversed count again.
+func (c *Client) DeleteEventsBySource(ctx context.Context, transactionID string) (int64, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM caffeine_event WHERE source_transaction_id = $1`, transactionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete events: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE caffeine_event SET reversed_by = NULL, reversed_by_item = 0 WHERE reversed_by = $1`, transactionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to restore reversed events: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// ReverseRefundedEvent marks the most recent purchase from an Up transaction
+// matching a refunded drink as reversed by it. The refund's transaction and
+// item are recorded, so replaying the refund reverses nothing more.
+func (c *Client) ReverseRefundedEvent(ctx context.Context, refund models.CaffeineEvent) (int64, error) {
+	q := `UPDATE caffeine_event SET reversed_by = $4, reversed_by_item = $5 WHERE id = (
+		SELECT id FROM caffeine_event
+		WHERE source_transaction_id IS NOT NULL AND reversed_by IS NULL
+			AND description = $1 AND cost = $2 AND timestamp <= $3
+			AND NOT EXISTS (SELECT 1 FROM caffeine_event WHERE reversed_by = $4 AND reversed_by_item = $5)
+		ORDER BY timestamp DESC
+		LIMIT 1
+	)`
+	res, err := c.db.ExecContext(ctx, q, refund.Description, refund.Cost, refund.Timestamp.Unix(), refund.SourceTransactionID, refund.SourceItem)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reverse refunded event: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// GetEvents returns the caffeine events strictly between start and end, oldest first
+func (c *Client) GetEvents(ctx context.Context, start, end time.Time) ([]models.CaffeineEvent, error) {
+	q := `SELECT ` + eventSelectColumns + ` FROM caffeine_event WHERE timestamp > $1 AND timestamp < $2 AND ` + counted + ` ORDER BY timestamp ASC`
+	rows, err := c.db.QueryContext(ctx, q, start.Unix(), end.Unix())
 	if err != nil {
-		return events
+		return nil, fmt.Errorf("failed to query events: %w", err)
 	}
+	defer rows.Close()
+
+	events := make([]models.CaffeineEvent, 0)
 	for rows.Next() {
-		var event models.CaffeineRow
-		err = rows.Scan(&event.Timestamp, &event.Description, &event.Amount, &event.Cost)
+		event, err := scanEvent(rows)
 		if err != nil {
-			return events
+			return nil, err
 		}
-		events = append(events, models.ToEvent(event))
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
 	}
-	return events
+	return events, nil
 }
 
-func (c *Client) GetTotalCost(start, end time.Time) int {
-	cost := 0
-	startSeconds := start.Unix()
-	if startSeconds < 0 {
-		startSeconds = 0
+// GetTotalCost returns the cost in cents of the events between start and end
+func (c *Client) GetTotalCost(ctx context.Context, start, end time.Time) (int, error) {
+	var cost int
+	q := `SELECT COALESCE(SUM(cost), 0) FROM caffeine_event WHERE timestamp > $1 AND timestamp < $2 AND ` + counted
+	if err := c.db.QueryRowContext(ctx, q, max(start.Unix(), 0), end.Unix()).Scan(&cost); err != nil {
+		return 0, fmt.Errorf("failed to sum cost: %w", err)
 	}
-	endSeconds := end.Unix()
-	q := `SELECT SUM(cost) FROM caffeine_event WHERE timestamp > $1 AND timestamp < $2`
-	err := c.db.QueryRow(q, startSeconds, endSeconds).Scan(&cost)
+	return cost, nil
+}
+
+// GetTotalIntake returns the caffeine in mg of the events between start and
+// end, leaving out drinks bought for someone else
+func (c *Client) GetTotalIntake(ctx context.Context, start, end time.Time) (int, error) {
+	var intake int
+	q := `SELECT COALESCE(SUM(amount), 0) FROM caffeine_event
+		WHERE timestamp > $1 AND timestamp < $2 AND NOT for_someone_else AND ` + counted
+	if err := c.db.QueryRowContext(ctx, q, max(start.Unix(), 0), end.Unix()).Scan(&intake); err != nil {
+		return 0, fmt.Errorf("failed to sum intake: %w", err)
+	}
+	return intake, nil
+}
+
+// GetEventsBySource returns the caffeine events recorded for the given Up transactions
+func (c *Client) GetEventsBySource(ctx context.Context, transactionIDs []string) ([]models.CaffeineEvent, error) {
+	events := make([]models.CaffeineEvent, 0)
+	if len(transactionIDs) == 0 {
+		return events, nil
+	}
+
+	q := `SELECT ` + eventSelectColumns + ` FROM caffeine_event
+		WHERE source_transaction_id = ANY($1) ORDER BY timestamp ASC, source_item ASC`
+	rows, err := c.db.QueryContext(ctx, q, pq.Array(transactionIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+	return events, nil
+}
+
+// GetFlaggedEvents returns events matched with low confidence, oldest first
+func (c *Client) GetFlaggedEvents(ctx context.Context) ([]models.CaffeineEvent, error) {
+	q := `SELECT ` + eventSelectColumns + ` FROM caffeine_event
+		WHERE flagged AND ` + counted + ` ORDER BY timestamp ASC`
+	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		return 0
+		return nil, fmt.Errorf("failed to query flagged events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]models.CaffeineEvent, 0)
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
 	}
-	return cost
+	return events, nil
 }
 
-func (c *Client) GetTotalIntake(start, end time.Time) int {
-	intake := 0
-	startSeconds := start.Unix()
-	if startSeconds < 0 {
-		startSeconds = 0
+// SetForSomeoneElse marks whether a drink was bought for someone else
+func (c *Client) SetForSomeoneElse(ctx context.Context, transactionID string, item int, forSomeoneElse bool) error {
+	q := `UPDATE caffeine_event SET for_someone_else = $3 WHERE source_transaction_id = $1 AND source_item = $2`
+	res, err := c.db.ExecContext(ctx, q, transactionID, item, forSomeoneElse)
+	if err != nil {
+		return fmt.Errorf("failed to update event: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
 	}
-	endSeconds := end.Unix()
-	q := `SELECT SUM(amount) FROM caffeine_event WHERE timestamp > $1 AND timestamp < $2`
-	err := c.db.QueryRow(q, startSeconds, endSeconds).Scan(&intake)
+	if n == 0 {
+		return errors.Wrap(errors.ErrNotFound, "event for transaction %s item %d", transactionID, item)
+	}
+	return nil
+}
+
+// ApplyEventChanges applies a reprocessing diff in a single transaction
+func (c *Client) ApplyEventChanges(ctx context.Context, changes []models.EventChange) error {
+	tx, err := c.db.BeginTx(ctx, nil)
 	if err != nil {
-		return 0
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, change := range changes {
+		var err error
+		switch change.Action {
+		case models.ChangeAdd:
+			e := change.After
+			_, err = tx.ExecContext(ctx, `INSERT INTO caffeine_event (timestamp, description, amount, cost, source_transaction_id, source_item, confidence, flagged,
+					reversed_by, reversed_by_item)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10) ON CONFLICT (source_transaction_id, source_item) DO NOTHING`,
+				e.Timestamp.Unix(), e.Description, e.Amount, e.Cost, change.SourceTransactionID, change.SourceItem, e.Confidence, e.Flagged,
+				e.ReversedBy, e.ReversedByItem)
+			if err == nil {
+				// A rule now covers the purchase, so it no longer needs review
+				_, err = tx.ExecContext(ctx, `DELETE FROM caffeine_candidate WHERE source_transaction_id = $1 AND status = 'pending'`,
+					change.SourceTransactionID)
+			}
+		case models.ChangeUpdate:
+			e := change.After
+			_, err = tx.ExecContext(ctx, `UPDATE caffeine_event SET timestamp = $3, description = $4, amount = $5, cost = $6,
+				confidence = $7, flagged = $8, reversed_by = NULLIF($9, ''), reversed_by_item = $10
+				WHERE source_transaction_id = $1 AND source_item = $2`,
+				change.SourceTransactionID, change.SourceItem, e.Timestamp.Unix(), e.Description, e.Amount, e.Cost, e.Confidence, e.Flagged,
+				e.ReversedBy, e.ReversedByItem)
+		case models.ChangeRemove:
+			_, err = tx.ExecContext(ctx, `DELETE FROM caffeine_event WHERE source_transaction_id = $1 AND source_item = $2`,
+				change.SourceTransactionID, change.SourceItem)
+		default:
+			err = fmt.Errorf("unknown change action %q", change.Action)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply %s for transaction %s item %d: %w", change.Action, change.SourceTransactionID, change.SourceItem, err)
+		}
 	}
-	return intake
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit changes: %w", err)
+	}
+	return nil
 }
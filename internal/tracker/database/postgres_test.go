@@ -0,0 +1,64 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/baely/txn/internal/tracker/database"
+	"github.com/baely/txn/internal/tracker/database/storetest"
+)
+
+// testDSNEnv names a Postgres database the tests may create schemas in, for
+// example "postgres://postgres@localhost/txn_test?sslmode=disable"
+const testDSNEnv = "TRACKER_TEST_DSN"
+
+var schemaCount atomic.Int64
+
+func TestClient(t *testing.T) {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	storetest.Run(t, func(t *testing.T) database.Store {
+		// Each test migrates its own schema from scratch
+		schema := fmt.Sprintf("storetest_%d_%d", os.Getpid(), schemaCount.Add(1))
+		if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+			t.Fatalf("failed to create schema: %v", err)
+		}
+		t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+		c, err := database.ConnectDSN(withSearchPath(dsn, schema))
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		t.Cleanup(func() { c.Close() })
+		if _, err := c.MigrateUp(context.Background()); err != nil {
+			t.Fatalf("failed to migrate: %v", err)
+		}
+		return c
+	})
+}
+
+// withSearchPath points a URL or key-value connection string at schema
+func withSearchPath(dsn, schema string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		return dsn + sep + "search_path=" + schema
+	}
+	return dsn + " search_path=" + schema
+}
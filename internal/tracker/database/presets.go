@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/baely/txn/internal/common/errors"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+const presetColumns = `id, slug, description, amount, cost, created_at, updated_at`
+
+// ListPresets returns every preset by slug
+func (c *Client) ListPresets(ctx context.Context) ([]models.Preset, error) {
+	q := `SELECT ` + presetColumns + ` FROM caffeine_preset ORDER BY slug`
+	rows, err := c.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query presets: %w", err)
+	}
+	defer rows.Close()
+
+	presets := make([]models.Preset, 0)
+	for rows.Next() {
+		preset, err := scanPreset(rows)
+		if err != nil {
+			return nil, err
+		}
+		presets = append(presets, preset)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read presets: %w", err)
+	}
+	return presets, nil
+}
+
+// GetPreset returns the preset with the given slug
+func (c *Client) GetPreset(ctx context.Context, slug string) (models.Preset, error) {
+	q := `SELECT ` + presetColumns + ` FROM caffeine_preset WHERE slug = $1`
+	preset, err := scanPreset(c.db.QueryRowContext(ctx, q, slug))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Preset{}, errors.Wrap(errors.ErrNotFound, "preset %s", slug)
+	}
+	return preset, err
+}
+
+// CreatePreset adds a preset and returns it as stored
+func (c *Client) CreatePreset(ctx context.Context, preset models.Preset) (models.Preset, error) {
+	q := `INSERT INTO caffeine_preset (slug, description, amount, cost) VALUES ($1, $2, $3, $4)
+		RETURNING ` + presetColumns
+	created, err := scanPreset(c.db.QueryRowContext(ctx, q, preset.Slug, preset.Description, preset.Amount, preset.Cost))
+	if isUniqueViolation(err) {
+		return models.Preset{}, errors.Wrap(errors.ErrAlreadyExists, "preset %s", preset.Slug)
+	}
+	return created, err
+}
+
+// UpdatePreset replaces the preset with the given slug, which may be renamed
+func (c *Client) UpdatePreset(ctx context.Context, slug string, preset models.Preset) (models.Preset, error) {
+	q := `UPDATE caffeine_preset SET slug = $2, description = $3, amount = $4, cost = $5, updated_at = now()
+		WHERE slug = $1
+		RETURNING ` + presetColumns
+	updated, err := scanPreset(c.db.QueryRowContext(ctx, q, slug, preset.Slug, preset.Description, preset.Amount, preset.Cost))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return models.Preset{}, errors.Wrap(errors.ErrNotFound, "preset %s", slug)
+	case isUniqueViolation(err):
+		return models.Preset{}, errors.Wrap(errors.ErrAlreadyExists, "preset %s", preset.Slug)
+	}
+	return updated, err
+}
+
+// DeletePreset removes a preset. Events logged from it are kept.
+func (c *Client) DeletePreset(ctx context.Context, slug string) error {
+	res, err := c.db.ExecContext(ctx, `DELETE FROM caffeine_preset WHERE slug = $1`, slug)
+	if err != nil {
+		return fmt.Errorf("failed to delete preset: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.Wrap(errors.ErrNotFound, "preset %s", slug)
+	}
+	return nil
+}
+
+func scanPreset(row scanner) (models.Preset, error) {
+	var preset models.Preset
+	err := row.Scan(&preset.ID, &preset.Slug, &preset.Description, &preset.Amount, &preset.Cost, &preset.CreatedAt, &preset.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) || isUniqueViolation(err) {
+		return preset, err
+	}
+	if err != nil {
+		return preset, fmt.Errorf("failed to scan preset: %w", err)
+	}
+	return preset, nil
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/baely/txn/internal/common/errors"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+const profileColumns = `half_life, weight, daily_limit, bedtime, smoker, oral_contraceptives, pregnant, updated_at`
+
+// GetProfile returns the saved profile, or DefaultProfile if there is none
+func (c *Client) GetProfile(ctx context.Context) (models.Profile, error) {
+	q := `SELECT ` + profileColumns + ` FROM caffeine_profile WHERE id = 1`
+	profile, err := scanProfile(c.db.QueryRowContext(ctx, q))
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultProfile, nil
+	}
+	return profile, err
+}
+
+// UpdateProfile saves the profile and returns it as stored
+func (c *Client) UpdateProfile(ctx context.Context, profile models.Profile) (models.Profile, error) {
+	q := `INSERT INTO caffeine_profile (id, half_life, weight, daily_limit, bedtime, smoker, oral_contraceptives, pregnant)
+		VALUES (1, $1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET half_life = $1, weight = $2, daily_limit = $3, bedtime = $4,
+			smoker = $5, oral_contraceptives = $6, pregnant = $7, updated_at = now()
+		RETURNING ` + profileColumns
+	return scanProfile(c.db.QueryRowContext(ctx, q, profile.HalfLife, profile.Weight, profile.DailyLimit, profile.Bedtime,
+		profile.Smoker, profile.OralContraceptives, profile.Pregnant))
+}
+
+func scanProfile(row scanner) (models.Profile, error) {
+	var profile models.Profile
+	var halfLife, weight sql.NullFloat64
+	var dailyLimit sql.NullInt64
+	err := row.Scan(&halfLife, &weight, &dailyLimit, &profile.Bedtime, &profile.Smoker, &profile.OralContraceptives,
+		&profile.Pregnant, &profile.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Profile{}, err
+	}
+	if err != nil {
+		return models.Profile{}, fmt.Errorf("failed to scan profile: %w", err)
+	}
+	if halfLife.Valid {
+		profile.HalfLife = &halfLife.Float64
+	}
+	if weight.Valid {
+		profile.Weight = &weight.Float64
+	}
+	profile.DailyLimit = nullInt(dailyLimit)
+	return profile, nil
+}
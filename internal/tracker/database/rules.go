@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/baely/txn/internal/common/errors"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+const ruleColumns = `id, name, priority, disabled, merchant_match, merchant, category, raw_text,
+	price, min_price, max_price, tolerance, surcharge, drink, caffeine, not_caffeine, created_at, updated_at`
+
+func intPtr(v int) *int {
+	return &v
+}
+
+// ListRules returns every matching rule in evaluation order
+func (c *Client) ListRules(ctx context.Context) ([]models.Rule, error) {
+	q := `SELECT ` + ruleColumns + ` FROM caffeine_rule ORDER BY priority, id`
+	rows, err := c.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := make([]models.Rule, 0)
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+	return rules, nil
+}
+
+// GetRule returns a single rule
+func (c *Client) GetRule(ctx context.Context, id int64) (models.Rule, error) {
+	q := `SELECT ` + ruleColumns + ` FROM caffeine_rule WHERE id = $1`
+	rule, err := scanRule(c.db.QueryRowContext(ctx, q, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Rule{}, errors.Wrap(errors.ErrNotFound, "rule %d", id)
+	}
+	return rule, err
+}
+
+// CreateRule adds a rule and returns it as stored
+func (c *Client) CreateRule(ctx context.Context, rule models.Rule) (models.Rule, error) {
+	return insertRule(ctx, c.db, rule)
+}
+
+// UpdateRule replaces a rule and returns it as stored
+func (c *Client) UpdateRule(ctx context.Context, rule models.Rule) (models.Rule, error) {
+	q := `UPDATE caffeine_rule SET name = $2, priority = $3, disabled = $4, merchant_match = $5, merchant = $6,
+			category = $7, raw_text = $8, price = $9, min_price = $10, max_price = $11, tolerance = $12, surcharge = $13,
+			drink = $14, caffeine = $15, not_caffeine = $16, updated_at = now()
+		WHERE id = $1
+		RETURNING ` + ruleColumns
+	updated, err := scanRule(c.db.QueryRowContext(ctx, q, rule.ID, rule.Name, rule.Priority, rule.Disabled, rule.MerchantMatch,
+		rule.Merchant, rule.Category, rule.RawText, rule.Price, rule.MinPrice, rule.MaxPrice, rule.Tolerance, rule.Surcharge, rule.Drink, rule.Caffeine, rule.NotCaffeine))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Rule{}, errors.Wrap(errors.ErrNotFound, "rule %d", rule.ID)
+	}
+	return updated, err
+}
+
+// DeleteRule removes a rule
+func (c *Client) DeleteRule(ctx context.Context, id int64) error {
+	res, err := c.db.ExecContext(ctx, `DELETE FROM caffeine_rule WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete rule: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.Wrap(errors.ErrNotFound, "rule %d", id)
+	}
+	return nil
+}
+
+// queryRower is satisfied by *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func insertRule(ctx context.Context, db queryRower, rule models.Rule) (models.Rule, error) {
+	if rule.MerchantMatch == "" {
+		rule.MerchantMatch = models.MatchExact
+	}
+	q := `INSERT INTO caffeine_rule (name, priority, disabled, merchant_match, merchant, category, raw_text,
+			price, min_price, max_price, tolerance, surcharge, drink, caffeine, not_caffeine)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING ` + ruleColumns
+	created, err := scanRule(db.QueryRowContext(ctx, q, rule.Name, rule.Priority, rule.Disabled, rule.MerchantMatch,
+		rule.Merchant, rule.Category, rule.RawText, rule.Price, rule.MinPrice, rule.MaxPrice, rule.Tolerance, rule.Surcharge, rule.Drink, rule.Caffeine, rule.NotCaffeine))
+	if err != nil {
+		return models.Rule{}, fmt.Errorf("failed to insert rule: %w", err)
+	}
+	return created, nil
+}
+
+// scanner is satisfied by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRule(row scanner) (models.Rule, error) {
+	var rule models.Rule
+	var price, minPrice, maxPrice sql.NullInt64
+	err := row.Scan(&rule.ID, &rule.Name, &rule.Priority, &rule.Disabled, &rule.MerchantMatch, &rule.Merchant,
+		&rule.Category, &rule.RawText, &price, &minPrice, &maxPrice, &rule.Tolerance, &rule.Surcharge, &rule.Drink, &rule.Caffeine, &rule.NotCaffeine, &rule.CreatedAt, &rule.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rule, err
+	}
+	if err != nil {
+		return rule, fmt.Errorf("failed to scan rule: %w", err)
+	}
+	rule.Price = nullInt(price)
+	rule.MinPrice = nullInt(minPrice)
+	rule.MaxPrice = nullInt(maxPrice)
+	return rule, nil
+}
+
+func nullInt(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	return intPtr(int(v.Int64))
+}
@@ -0,0 +1,55 @@
+package database
+
+import "github.com/baely/txn/internal/tracker/models"
+
+// DefaultRules are the rules a new store starts with: the café lookup and
+// Woolworths Dock heuristic that used to be compiled in. Postgres seeds the
+// same rules in migration 0004.
+var DefaultRules = []models.Rule{
+	cafeRule("Charlie Bit Me Cafe", 680, 160),
+	cafeRule("Charlie Bit Me Cafe", 700, 160),
+	cafeRule("Charlie Bit Me Cafe", 580, 80),
+	cafeRule("Georgie Boy Espresso", 550, 160),
+	cafeRule("Georgie Boy Espresso", 600, 160),
+	cafeRule("Chia Chia", 550, 160),
+	cafeRule("Chia Chia", 540, 160),
+	cafeRule("Chia Chia", 500, 80),
+	cafeRule("Chia Chia", 590, 240),
+	cafeRule("In a Rush", 560, 160),
+	cafeRule("Mr Summit", 550, 160),
+	cafeRule("The Other Brother", 600, 160),
+	{
+		Name:          "Woolworths Dock espresso",
+		Priority:      100,
+		MerchantMatch: models.MatchExact,
+		Category:      "groceries",
+		RawText:       "WOOLWORTHS.*DOCK",
+		MinPrice:      intPtr(200),
+		MaxPrice:      intPtr(700),
+		Drink:         "Dare NAS Intense Espresso",
+		Caffeine:      260,
+	},
+}
+
+// DefaultPresets are the presets a new store starts with, the drinks the old
+// predefined-event endpoint logged. Postgres seeds them in migration 0007.
+var DefaultPresets = []models.Preset{
+	{Slug: "homemade-double-oat-latte", Description: "Homemade Double Oat Latte", Amount: 160, Cost: 250},
+	{Slug: "the-jolly-miller", Description: "The Jolly Miller", Amount: 80, Cost: 600},
+}
+
+// DefaultProfile is the profile a store returns until one is saved
+var DefaultProfile = models.Profile{
+	Bedtime: "22:00",
+}
+
+func cafeRule(merchant string, price, caffeine int) models.Rule {
+	return models.Rule{
+		Priority:      100,
+		MerchantMatch: models.MatchExact,
+		Merchant:      merchant,
+		Category:      "restaurants-and-cafes",
+		Price:         intPtr(price),
+		Caffeine:      caffeine,
+	}
+}
@@ -0,0 +1,80 @@
+-- Tracker schema for SQLite. Times are unix seconds.
+CREATE TABLE IF NOT EXISTS caffeine_event (
+	id INTEGER PRIMARY KEY,
+	timestamp INTEGER NOT NULL,
+	description TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	cost INTEGER NOT NULL DEFAULT 0,
+	source_transaction_id TEXT,
+	source_item INTEGER NOT NULL DEFAULT 0,
+	confidence REAL NOT NULL DEFAULT 1,
+	flagged INTEGER NOT NULL DEFAULT 0,
+	for_someone_else INTEGER NOT NULL DEFAULT 0,
+	edited INTEGER NOT NULL DEFAULT 0,
+	reversed_by TEXT,
+	reversed_by_item INTEGER NOT NULL DEFAULT 0,
+	deleted INTEGER NOT NULL DEFAULT 0
+);
+CREATE UNIQUE INDEX IF NOT EXISTS caffeine_event_source_idx ON caffeine_event (source_transaction_id, source_item);
+CREATE INDEX IF NOT EXISTS caffeine_event_timestamp_idx ON caffeine_event (timestamp);
+CREATE INDEX IF NOT EXISTS caffeine_event_reversed_by_idx ON caffeine_event (reversed_by, reversed_by_item);
+
+CREATE TABLE IF NOT EXISTS caffeine_rule (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL DEFAULT '',
+	priority INTEGER NOT NULL DEFAULT 100,
+	disabled INTEGER NOT NULL DEFAULT 0,
+	merchant_match TEXT NOT NULL DEFAULT 'exact',
+	merchant TEXT NOT NULL DEFAULT '',
+	category TEXT NOT NULL DEFAULT '',
+	raw_text TEXT NOT NULL DEFAULT '',
+	price INTEGER,
+	min_price INTEGER,
+	max_price INTEGER,
+	tolerance INTEGER NOT NULL DEFAULT 0,
+	surcharge REAL NOT NULL DEFAULT 0,
+	drink TEXT NOT NULL DEFAULT '',
+	caffeine INTEGER NOT NULL,
+	not_caffeine INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS caffeine_candidate (
+	id INTEGER PRIMARY KEY,
+	source_transaction_id TEXT NOT NULL UNIQUE,
+	merchant TEXT NOT NULL,
+	raw_text TEXT NOT NULL DEFAULT '',
+	category TEXT NOT NULL,
+	cost INTEGER NOT NULL,
+	timestamp INTEGER NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	drink TEXT NOT NULL DEFAULT '',
+	caffeine INTEGER NOT NULL DEFAULT 0,
+	rule_id INTEGER REFERENCES caffeine_rule (id) ON DELETE SET NULL,
+	created_at INTEGER NOT NULL,
+	reviewed_at INTEGER
+);
+CREATE INDEX IF NOT EXISTS caffeine_candidate_status_idx ON caffeine_candidate (status, timestamp);
+
+CREATE TABLE IF NOT EXISTS caffeine_preset (
+	id INTEGER PRIMARY KEY,
+	slug TEXT NOT NULL UNIQUE,
+	description TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	cost INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS caffeine_profile (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	half_life REAL,
+	weight REAL,
+	daily_limit INTEGER,
+	bedtime TEXT NOT NULL,
+	smoker INTEGER NOT NULL DEFAULT 0,
+	oral_contraceptives INTEGER NOT NULL DEFAULT 0,
+	pregnant INTEGER NOT NULL DEFAULT 0,
+	updated_at INTEGER NOT NULL
+);
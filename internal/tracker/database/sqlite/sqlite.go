@@ -0,0 +1,792 @@
+// Package sqlite is a tracker store in a single SQLite file, for running the
+// tracker without Postgres. It uses the pure-Go modernc.org/sqlite driver, so
+// it needs no cgo.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/baely/txn/internal/common/errors"
+	"github.com/baely/txn/internal/tracker/database"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+//go:embed schema.sql
+var schema string
+
+// schemaVersion is recorded in PRAGMA user_version once the schema is created.
+// Version 2 added caffeine_profile, version 3 the caffeine_event reversal
+// columns and version 4 caffeine_event.deleted.
+const schemaVersion = 4
+
+// columnUpgrades add the columns each version introduced to tables created by
+// older versions. CREATE TABLE IF NOT EXISTS leaves existing tables alone, so
+// new columns have to be added separately.
+var columnUpgrades = map[int][]string{
+	3: {
+		`ALTER TABLE caffeine_event ADD COLUMN reversed_by TEXT`,
+		`ALTER TABLE caffeine_event ADD COLUMN reversed_by_item INTEGER NOT NULL DEFAULT 0`,
+	},
+	4: {
+		`ALTER TABLE caffeine_event ADD COLUMN deleted INTEGER NOT NULL DEFAULT 0`,
+	},
+}
+
+// Store keeps tracker data in a SQLite database
+type Store struct {
+	db *sql.DB
+}
+
+var _ database.Store = (*Store)(nil)
+
+// Open opens the database at path, creating it and seeding the default rules
+// and presets if it is new. A path of ":memory:" gives a throwaway database.
+func Open(path string) (database.Store, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time, and every connection to an
+	// in-memory database would get its own empty database
+	db.SetMaxOpenConns(1)
+
+	s := &Store{db: db}
+	if err := s.ensureSchema(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// ensureSchema creates and seeds the tables the first time the database is
+// opened, and adds tables and columns that are missing from older databases
+func (s *Store) ensureSchema(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version >= schemaVersion {
+		return nil
+	}
+
+	for v := version + 1; version > 0 && v <= schemaVersion; v++ {
+		for _, q := range columnUpgrades[v] {
+			if _, err := tx.ExecContext(ctx, q); err != nil {
+				return fmt.Errorf("failed to upgrade schema to version %d: %w", v, err)
+			}
+		}
+	}
+	if _, err := tx.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+	if version == 0 {
+		for _, rule := range database.DefaultRules {
+			if _, err := insertRule(ctx, tx, rule); err != nil {
+				return err
+			}
+		}
+		for _, preset := range database.DefaultPresets {
+			if _, err := insertPreset(ctx, tx, preset); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, schemaVersion)); err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+	return tx.Commit()
+}
+
+const eventColumns = `timestamp, description, amount, cost, source_transaction_id, source_item, confidence, flagged, for_someone_else, edited`
+
+// eventSelectColumns are the columns scanEvent reads
+const eventSelectColumns = `id, ` + eventColumns + `, reversed_by, reversed_by_item, deleted`
+
+// counted selects the events that count towards intake, cost and levels
+const counted = `reversed_by IS NULL AND NOT deleted`
+
+// scanner is satisfied by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryRower is satisfied by *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func scanEvent(row scanner) (models.CaffeineEvent, error) {
+	var event models.CaffeineRow
+	err := row.Scan(&event.ID, &event.Timestamp, &event.Description, &event.Amount, &event.Cost, &event.SourceTransactionID,
+		&event.SourceItem, &event.Confidence, &event.Flagged, &event.ForSomeoneElse, &event.Edited, &event.ReversedBy, &event.ReversedByItem,
+		&event.Deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.CaffeineEvent{}, err
+	}
+	if err != nil {
+		return models.CaffeineEvent{}, fmt.Errorf("failed to scan event: %w", err)
+	}
+	return models.ToEvent(event), nil
+}
+
+// queryEvents runs a query selecting eventSelectColumns
+func (s *Store) queryEvents(ctx context.Context, q string, args ...interface{}) ([]models.CaffeineEvent, error) {
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]models.CaffeineEvent, 0)
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+	return events, nil
+}
+
+// AddEvent records a caffeine event. Events with a source transaction id are
+// only recorded once, so replaying a transaction is a no-op.
+func (s *Store) AddEvent(ctx context.Context, event models.CaffeineEvent) error {
+	q := `INSERT INTO caffeine_event (` + eventColumns + `)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?)
+		ON CONFLICT (source_transaction_id, source_item) DO NOTHING`
+	_, err := s.db.ExecContext(ctx, q, event.Timestamp.Unix(), event.Description, event.Amount, event.Cost, event.SourceTransactionID,
+		event.SourceItem, event.Confidence, event.Flagged, event.ForSomeoneElse, event.Edited)
+	if err != nil {
+		return fmt.Errorf("failed to add event: %w", err)
+	}
+	return nil
+}
+
+// GetEvents returns the caffeine events strictly between start and end, oldest first
+func (s *Store) GetEvents(ctx context.Context, start, end time.Time) ([]models.CaffeineEvent, error) {
+	q := `SELECT ` + eventSelectColumns + ` FROM caffeine_event WHERE timestamp > ? AND timestamp < ? AND ` + counted + ` ORDER BY timestamp ASC`
+	return s.queryEvents(ctx, q, start.Unix(), end.Unix())
+}
+
+// GetTotalCost returns the cost in cents of the events between start and end
+func (s *Store) GetTotalCost(ctx context.Context, start, end time.Time) (int, error) {
+	var cost int
+	q := `SELECT COALESCE(SUM(cost), 0) FROM caffeine_event WHERE timestamp > ? AND timestamp < ? AND ` + counted
+	if err := s.db.QueryRowContext(ctx, q, max(start.Unix(), 0), end.Unix()).Scan(&cost); err != nil {
+		return 0, fmt.Errorf("failed to sum cost: %w", err)
+	}
+	return cost, nil
+}
+
+// GetTotalIntake returns the caffeine in mg of the events between start and
+// end, leaving out drinks bought for someone else
+func (s *Store) GetTotalIntake(ctx context.Context, start, end time.Time) (int, error) {
+	var intake int
+	q := `SELECT COALESCE(SUM(amount), 0) FROM caffeine_event
+		WHERE timestamp > ? AND timestamp < ? AND NOT for_someone_else AND ` + counted
+	if err := s.db.QueryRowContext(ctx, q, max(start.Unix(), 0), end.Unix()).Scan(&intake); err != nil {
+		return 0, fmt.Errorf("failed to sum intake: %w", err)
+	}
+	return intake, nil
+}
+
+// GetEvent returns a single caffeine event that has not been deleted
+func (s *Store) GetEvent(ctx context.Context, id int64) (models.CaffeineEvent, error) {
+	q := `SELECT ` + eventSelectColumns + ` FROM caffeine_event WHERE id = ? AND NOT deleted`
+	event, err := scanEvent(s.db.QueryRowContext(ctx, q, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.CaffeineEvent{}, errors.Wrap(errors.ErrNotFound, "event %d", id)
+	}
+	return event, err
+}
+
+// CreateEvent records a manually logged caffeine event and returns it as stored
+func (s *Store) CreateEvent(ctx context.Context, event models.CaffeineEvent) (models.CaffeineEvent, error) {
+	q := `INSERT INTO caffeine_event (` + eventColumns + `)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?)
+		RETURNING ` + eventSelectColumns
+	created, err := scanEvent(s.db.QueryRowContext(ctx, q, event.Timestamp.Unix(), event.Description, event.Amount, event.Cost,
+		event.SourceTransactionID, event.SourceItem, event.Confidence, event.Flagged, event.ForSomeoneElse, event.Edited))
+	if isUniqueViolation(err) {
+		return models.CaffeineEvent{}, errors.Wrap(errors.ErrAlreadyExists, "event for transaction %s item %d", event.SourceTransactionID, event.SourceItem)
+	}
+	if err != nil {
+		return models.CaffeineEvent{}, fmt.Errorf("failed to create event: %w", err)
+	}
+	return created, nil
+}
+
+// UpdateEvent replaces the editable fields of an event and returns it as stored
+func (s *Store) UpdateEvent(ctx context.Context, event models.CaffeineEvent) (models.CaffeineEvent, error) {
+	q := `UPDATE caffeine_event SET timestamp = ?, description = ?, amount = ?, cost = ?, flagged = ?,
+			for_someone_else = ?, edited = ?
+		WHERE id = ? AND NOT deleted
+		RETURNING ` + eventSelectColumns
+	updated, err := scanEvent(s.db.QueryRowContext(ctx, q, event.Timestamp.Unix(), event.Description, event.Amount,
+		event.Cost, event.Flagged, event.ForSomeoneElse, event.Edited, event.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.CaffeineEvent{}, errors.Wrap(errors.ErrNotFound, "event %d", event.ID)
+	}
+	return updated, err
+}
+
+// DeleteEvent removes a manually logged caffeine event. Events from Up
+// transactions are marked deleted and edited instead, so backfills and
+// reprocessing do not add them back.
+func (s *Store) DeleteEvent(ctx context.Context, id int64) error {
+	q := `UPDATE caffeine_event SET deleted = 1, edited = 1 WHERE id = ? AND source_transaction_id IS NOT NULL AND NOT deleted`
+	res, err := s.db.ExecContext(ctx, q, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	res, err = s.db.ExecContext(ctx, `DELETE FROM caffeine_event WHERE id = ? AND source_transaction_id IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+	return requireRow(res, errors.Wrap(errors.ErrNotFound, "event %d", id))
+}
+
+// GetEventsBySource returns the caffeine events recorded for the given Up transactions
+func (s *Store) GetEventsBySource(ctx context.Context, transactionIDs []string) ([]models.CaffeineEvent, error) {
+	if len(transactionIDs) == 0 {
+		return make([]models.CaffeineEvent, 0), nil
+	}
+	args := make([]interface{}, len(transactionIDs))
+	for i, id := range transactionIDs {
+		args[i] = id
+	}
+	q := `SELECT ` + eventSelectColumns + ` FROM caffeine_event
+		WHERE source_transaction_id IN (?` + strings.Repeat(", ?", len(args)-1) + `)
+		ORDER BY timestamp ASC, source_item ASC`
+	return s.queryEvents(ctx, q, args...)
+}
+
+// GetFlaggedEvents returns events matched with low confidence, oldest first
+func (s *Store) GetFlaggedEvents(ctx context.Context) ([]models.CaffeineEvent, error) {
+	q := `SELECT ` + eventSelectColumns + ` FROM caffeine_event WHERE flagged AND ` + counted + ` ORDER BY timestamp ASC`
+	return s.queryEvents(ctx, q)
+}
+
+// DeleteEventsBySource removes the caffeine events recorded for an Up
+// transaction. If it was a refund, the purchases it reversed count again.
+func (s *Store) DeleteEventsBySource(ctx context.Context, transactionID string) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM caffeine_event WHERE source_transaction_id = ?`, transactionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete events: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE caffeine_event SET reversed_by = NULL, reversed_by_item = 0 WHERE reversed_by = ?`, transactionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to restore reversed events: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// ReverseRefundedEvent marks the most recent purchase from an Up transaction
+// matching a refunded drink as reversed by it. The refund's transaction and
+// item are recorded, so replaying the refund reverses nothing more.
+func (s *Store) ReverseRefundedEvent(ctx context.Context, refund models.CaffeineEvent) (int64, error) {
+	q := `UPDATE caffeine_event SET reversed_by = ?4, reversed_by_item = ?5 WHERE id = (
+		SELECT id FROM caffeine_event
+		WHERE source_transaction_id IS NOT NULL AND reversed_by IS NULL
+			AND description = ?1 AND cost = ?2 AND timestamp <= ?3
+			AND NOT EXISTS (SELECT 1 FROM caffeine_event WHERE reversed_by = ?4 AND reversed_by_item = ?5)
+		ORDER BY timestamp DESC
+		LIMIT 1
+	)`
+	res, err := s.db.ExecContext(ctx, q, refund.Description, refund.Cost, refund.Timestamp.Unix(), refund.SourceTransactionID, refund.SourceItem)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reverse refunded event: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// SetForSomeoneElse marks whether a drink was bought for someone else
+func (s *Store) SetForSomeoneElse(ctx context.Context, transactionID string, item int, forSomeoneElse bool) error {
+	q := `UPDATE caffeine_event SET for_someone_else = ? WHERE source_transaction_id = ? AND source_item = ?`
+	res, err := s.db.ExecContext(ctx, q, forSomeoneElse, transactionID, item)
+	if err != nil {
+		return fmt.Errorf("failed to update event: %w", err)
+	}
+	return requireRow(res, errors.Wrap(errors.ErrNotFound, "event for transaction %s item %d", transactionID, item))
+}
+
+// ApplyEventChanges applies a reprocessing diff in a single transaction
+func (s *Store) ApplyEventChanges(ctx context.Context, changes []models.EventChange) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, change := range changes {
+		var err error
+		switch change.Action {
+		case models.ChangeAdd:
+			e := change.After
+			_, err = tx.ExecContext(ctx, `INSERT INTO caffeine_event (timestamp, description, amount, cost, source_transaction_id, source_item, confidence, flagged,
+					reversed_by, reversed_by_item)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?) ON CONFLICT (source_transaction_id, source_item) DO NOTHING`,
+				e.Timestamp.Unix(), e.Description, e.Amount, e.Cost, change.SourceTransactionID, change.SourceItem, e.Confidence, e.Flagged,
+				e.ReversedBy, e.ReversedByItem)
+			if err == nil {
+				// A rule now covers the purchase, so it no longer needs review
+				_, err = tx.ExecContext(ctx, `DELETE FROM caffeine_candidate WHERE source_transaction_id = ? AND status = 'pending'`,
+					change.SourceTransactionID)
+			}
+		case models.ChangeUpdate:
+			e := change.After
+			_, err = tx.ExecContext(ctx, `UPDATE caffeine_event SET timestamp = ?, description = ?, amount = ?, cost = ?,
+				confidence = ?, flagged = ?, reversed_by = NULLIF(?, ''), reversed_by_item = ?
+				WHERE source_transaction_id = ? AND source_item = ?`,
+				e.Timestamp.Unix(), e.Description, e.Amount, e.Cost, e.Confidence, e.Flagged, e.ReversedBy, e.ReversedByItem,
+				change.SourceTransactionID, change.SourceItem)
+		case models.ChangeRemove:
+			_, err = tx.ExecContext(ctx, `DELETE FROM caffeine_event WHERE source_transaction_id = ? AND source_item = ?`,
+				change.SourceTransactionID, change.SourceItem)
+		default:
+			err = fmt.Errorf("unknown change action %q", change.Action)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply %s for transaction %s item %d: %w", change.Action, change.SourceTransactionID, change.SourceItem, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit changes: %w", err)
+	}
+	return nil
+}
+
+const ruleColumns = `id, name, priority, disabled, merchant_match, merchant, category, raw_text,
+	price, min_price, max_price, tolerance, surcharge, drink, caffeine, not_caffeine, created_at, updated_at`
+
+// ListRules returns every matching rule in evaluation order
+func (s *Store) ListRules(ctx context.Context) ([]models.Rule, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+ruleColumns+` FROM caffeine_rule ORDER BY priority, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := make([]models.Rule, 0)
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+	return rules, nil
+}
+
+// GetRule returns a single rule
+func (s *Store) GetRule(ctx context.Context, id int64) (models.Rule, error) {
+	rule, err := scanRule(s.db.QueryRowContext(ctx, `SELECT `+ruleColumns+` FROM caffeine_rule WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Rule{}, errors.Wrap(errors.ErrNotFound, "rule %d", id)
+	}
+	return rule, err
+}
+
+// CreateRule adds a rule and returns it as stored
+func (s *Store) CreateRule(ctx context.Context, rule models.Rule) (models.Rule, error) {
+	return insertRule(ctx, s.db, rule)
+}
+
+// UpdateRule replaces a rule and returns it as stored
+func (s *Store) UpdateRule(ctx context.Context, rule models.Rule) (models.Rule, error) {
+	q := `UPDATE caffeine_rule SET name = ?, priority = ?, disabled = ?, merchant_match = ?, merchant = ?,
+			category = ?, raw_text = ?, price = ?, min_price = ?, max_price = ?, tolerance = ?, surcharge = ?,
+			drink = ?, caffeine = ?, not_caffeine = ?, updated_at = ?
+		WHERE id = ?
+		RETURNING ` + ruleColumns
+	updated, err := scanRule(s.db.QueryRowContext(ctx, q, rule.Name, rule.Priority, rule.Disabled, rule.MerchantMatch,
+		rule.Merchant, rule.Category, rule.RawText, rule.Price, rule.MinPrice, rule.MaxPrice, rule.Tolerance, rule.Surcharge,
+		rule.Drink, rule.Caffeine, rule.NotCaffeine, time.Now().Unix(), rule.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Rule{}, errors.Wrap(errors.ErrNotFound, "rule %d", rule.ID)
+	}
+	return updated, err
+}
+
+// DeleteRule removes a rule
+func (s *Store) DeleteRule(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM caffeine_rule WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete rule: %w", err)
+	}
+	return requireRow(res, errors.Wrap(errors.ErrNotFound, "rule %d", id))
+}
+
+func insertRule(ctx context.Context, db queryRower, rule models.Rule) (models.Rule, error) {
+	if rule.MerchantMatch == "" {
+		rule.MerchantMatch = models.MatchExact
+	}
+	now := time.Now().Unix()
+	q := `INSERT INTO caffeine_rule (name, priority, disabled, merchant_match, merchant, category, raw_text,
+			price, min_price, max_price, tolerance, surcharge, drink, caffeine, not_caffeine, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING ` + ruleColumns
+	created, err := scanRule(db.QueryRowContext(ctx, q, rule.Name, rule.Priority, rule.Disabled, rule.MerchantMatch,
+		rule.Merchant, rule.Category, rule.RawText, rule.Price, rule.MinPrice, rule.MaxPrice, rule.Tolerance, rule.Surcharge,
+		rule.Drink, rule.Caffeine, rule.NotCaffeine, now, now))
+	if err != nil {
+		return models.Rule{}, fmt.Errorf("failed to insert rule: %w", err)
+	}
+	return created, nil
+}
+
+func scanRule(row scanner) (models.Rule, error) {
+	var rule models.Rule
+	var price, minPrice, maxPrice sql.NullInt64
+	var createdAt, updatedAt int64
+	err := row.Scan(&rule.ID, &rule.Name, &rule.Priority, &rule.Disabled, &rule.MerchantMatch, &rule.Merchant,
+		&rule.Category, &rule.RawText, &price, &minPrice, &maxPrice, &rule.Tolerance, &rule.Surcharge, &rule.Drink,
+		&rule.Caffeine, &rule.NotCaffeine, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rule, err
+	}
+	if err != nil {
+		return rule, fmt.Errorf("failed to scan rule: %w", err)
+	}
+	rule.Price = nullInt(price)
+	rule.MinPrice = nullInt(minPrice)
+	rule.MaxPrice = nullInt(maxPrice)
+	rule.CreatedAt = time.Unix(createdAt, 0)
+	rule.UpdatedAt = time.Unix(updatedAt, 0)
+	return rule, nil
+}
+
+func nullInt(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
+
+const candidateColumns = `id, source_transaction_id, merchant, raw_text, category, cost, timestamp, status,
+	drink, caffeine, rule_id, created_at, reviewed_at`
+
+// AddCandidate queues an unmatched purchase for review. A transaction is only
+// queued once, so replays do not undo an earlier review.
+func (s *Store) AddCandidate(ctx context.Context, candidate models.Candidate) error {
+	q := `INSERT INTO caffeine_candidate (source_transaction_id, merchant, raw_text, category, cost, timestamp, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (source_transaction_id) DO NOTHING`
+	_, err := s.db.ExecContext(ctx, q, candidate.SourceTransactionID, candidate.Merchant, candidate.RawText,
+		candidate.Category, candidate.Cost, candidate.Timestamp.Unix(), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to add candidate: %w", err)
+	}
+	return nil
+}
+
+// DeletePendingCandidate removes an unreviewed candidate, when its transaction
+// is deleted or a rule now matches it
+func (s *Store) DeletePendingCandidate(ctx context.Context, transactionID string) error {
+	q := `DELETE FROM caffeine_candidate WHERE source_transaction_id = ? AND status = ?`
+	if _, err := s.db.ExecContext(ctx, q, transactionID, models.CandidatePending); err != nil {
+		return fmt.Errorf("failed to delete candidate: %w", err)
+	}
+	return nil
+}
+
+// ListCandidates returns candidates with the given status, oldest first
+func (s *Store) ListCandidates(ctx context.Context, status models.CandidateStatus) ([]models.Candidate, error) {
+	q := `SELECT ` + candidateColumns + ` FROM caffeine_candidate WHERE status = ? ORDER BY timestamp, id`
+	rows, err := s.db.QueryContext(ctx, q, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query candidates: %w", err)
+	}
+	defer rows.Close()
+
+	candidates := make([]models.Candidate, 0)
+	for rows.Next() {
+		candidate, err := scanCandidate(rows)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read candidates: %w", err)
+	}
+	return candidates, nil
+}
+
+// GetCandidate returns a single candidate
+func (s *Store) GetCandidate(ctx context.Context, id int64) (models.Candidate, error) {
+	q := `SELECT ` + candidateColumns + ` FROM caffeine_candidate WHERE id = ?`
+	candidate, err := scanCandidate(s.db.QueryRowContext(ctx, q, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Candidate{}, errors.Wrap(errors.ErrNotFound, "candidate %d", id)
+	}
+	return candidate, err
+}
+
+// ResolveCandidate records a review in a single transaction: the optional rule
+// is created, the optional event recorded, and the candidate marked reviewed.
+// The event is recorded as edited so reprocessing keeps it. Candidates can
+// only be reviewed once.
+func (s *Store) ResolveCandidate(ctx context.Context, id int64, status models.CandidateStatus, event *models.CaffeineEvent, rule *models.Rule) (models.Candidate, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Candidate{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current models.CandidateStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM caffeine_candidate WHERE id = ?`, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Candidate{}, errors.Wrap(errors.ErrNotFound, "candidate %d", id)
+	}
+	if err != nil {
+		return models.Candidate{}, fmt.Errorf("failed to read candidate: %w", err)
+	}
+	if current != models.CandidatePending {
+		return models.Candidate{}, errors.Wrap(errors.ErrAlreadyExists, "candidate %d was already classified as %s", id, current)
+	}
+
+	var ruleID *int64
+	if rule != nil {
+		created, err := insertRule(ctx, tx, *rule)
+		if err != nil {
+			return models.Candidate{}, err
+		}
+		ruleID = &created.ID
+	}
+
+	drink, caffeine := "", 0
+	if event != nil {
+		q := `INSERT INTO caffeine_event (timestamp, description, amount, cost, source_transaction_id, confidence, flagged, edited)
+			VALUES (?, ?, ?, ?, ?, ?, ?, 1) ON CONFLICT (source_transaction_id, source_item) DO NOTHING`
+		_, err := tx.ExecContext(ctx, q, event.Timestamp.Unix(), event.Description, event.Amount, event.Cost,
+			event.SourceTransactionID, event.Confidence, event.Flagged)
+		if err != nil {
+			return models.Candidate{}, fmt.Errorf("failed to add event: %w", err)
+		}
+		drink, caffeine = event.Description, event.Amount
+	}
+
+	q := `UPDATE caffeine_candidate SET status = ?, drink = ?, caffeine = ?, rule_id = ?, reviewed_at = ?
+		WHERE id = ?
+		RETURNING ` + candidateColumns
+	candidate, err := scanCandidate(tx.QueryRowContext(ctx, q, status, drink, caffeine, ruleID, time.Now().Unix(), id))
+	if err != nil {
+		return models.Candidate{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Candidate{}, fmt.Errorf("failed to commit review: %w", err)
+	}
+	return candidate, nil
+}
+
+func scanCandidate(row scanner) (models.Candidate, error) {
+	var candidate models.Candidate
+	var timestamp, createdAt int64
+	var ruleID, reviewedAt sql.NullInt64
+	err := row.Scan(&candidate.ID, &candidate.SourceTransactionID, &candidate.Merchant, &candidate.RawText, &candidate.Category,
+		&candidate.Cost, &timestamp, &candidate.Status, &candidate.Drink, &candidate.Caffeine, &ruleID,
+		&createdAt, &reviewedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return candidate, err
+	}
+	if err != nil {
+		return candidate, fmt.Errorf("failed to scan candidate: %w", err)
+	}
+	candidate.Timestamp = time.Unix(timestamp, 0)
+	candidate.CreatedAt = time.Unix(createdAt, 0)
+	if ruleID.Valid {
+		candidate.RuleID = &ruleID.Int64
+	}
+	if reviewedAt.Valid {
+		t := time.Unix(reviewedAt.Int64, 0)
+		candidate.ReviewedAt = &t
+	}
+	return candidate, nil
+}
+
+const presetColumns = `id, slug, description, amount, cost, created_at, updated_at`
+
+// ListPresets returns every preset by slug
+func (s *Store) ListPresets(ctx context.Context) ([]models.Preset, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+presetColumns+` FROM caffeine_preset ORDER BY slug`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query presets: %w", err)
+	}
+	defer rows.Close()
+
+	presets := make([]models.Preset, 0)
+	for rows.Next() {
+		preset, err := scanPreset(rows)
+		if err != nil {
+			return nil, err
+		}
+		presets = append(presets, preset)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read presets: %w", err)
+	}
+	return presets, nil
+}
+
+// GetPreset returns the preset with the given slug
+func (s *Store) GetPreset(ctx context.Context, slug string) (models.Preset, error) {
+	preset, err := scanPreset(s.db.QueryRowContext(ctx, `SELECT `+presetColumns+` FROM caffeine_preset WHERE slug = ?`, slug))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Preset{}, errors.Wrap(errors.ErrNotFound, "preset %s", slug)
+	}
+	return preset, err
+}
+
+// CreatePreset adds a preset and returns it as stored
+func (s *Store) CreatePreset(ctx context.Context, preset models.Preset) (models.Preset, error) {
+	created, err := insertPreset(ctx, s.db, preset)
+	if isUniqueViolation(err) {
+		return models.Preset{}, errors.Wrap(errors.ErrAlreadyExists, "preset %s", preset.Slug)
+	}
+	return created, err
+}
+
+// UpdatePreset replaces the preset with the given slug, which may be renamed
+func (s *Store) UpdatePreset(ctx context.Context, slug string, preset models.Preset) (models.Preset, error) {
+	q := `UPDATE caffeine_preset SET slug = ?, description = ?, amount = ?, cost = ?, updated_at = ?
+		WHERE slug = ?
+		RETURNING ` + presetColumns
+	updated, err := scanPreset(s.db.QueryRowContext(ctx, q, preset.Slug, preset.Description, preset.Amount, preset.Cost,
+		time.Now().Unix(), slug))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return models.Preset{}, errors.Wrap(errors.ErrNotFound, "preset %s", slug)
+	case isUniqueViolation(err):
+		return models.Preset{}, errors.Wrap(errors.ErrAlreadyExists, "preset %s", preset.Slug)
+	}
+	return updated, err
+}
+
+// DeletePreset removes a preset. Events logged from it are kept.
+func (s *Store) DeletePreset(ctx context.Context, slug string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM caffeine_preset WHERE slug = ?`, slug)
+	if err != nil {
+		return fmt.Errorf("failed to delete preset: %w", err)
+	}
+	return requireRow(res, errors.Wrap(errors.ErrNotFound, "preset %s", slug))
+}
+
+func insertPreset(ctx context.Context, db queryRower, preset models.Preset) (models.Preset, error) {
+	now := time.Now().Unix()
+	q := `INSERT INTO caffeine_preset (slug, description, amount, cost, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING ` + presetColumns
+	return scanPreset(db.QueryRowContext(ctx, q, preset.Slug, preset.Description, preset.Amount, preset.Cost, now, now))
+}
+
+func scanPreset(row scanner) (models.Preset, error) {
+	var preset models.Preset
+	var createdAt, updatedAt int64
+	err := row.Scan(&preset.ID, &preset.Slug, &preset.Description, &preset.Amount, &preset.Cost, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) || isUniqueViolation(err) {
+		return preset, err
+	}
+	if err != nil {
+		return preset, fmt.Errorf("failed to scan preset: %w", err)
+	}
+	preset.CreatedAt = time.Unix(createdAt, 0)
+	preset.UpdatedAt = time.Unix(updatedAt, 0)
+	return preset, nil
+}
+
+// requireRow returns notFound if a statement changed no rows
+func requireRow(res sql.Result, notFound error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is a SQLite unique constraint violation
+func isUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+const profileColumns = `half_life, weight, daily_limit, bedtime, smoker, oral_contraceptives, pregnant, updated_at`
+
+// GetProfile returns the saved profile, or database.DefaultProfile if there is none
+func (s *Store) GetProfile(ctx context.Context) (models.Profile, error) {
+	profile, err := scanProfile(s.db.QueryRowContext(ctx, `SELECT `+profileColumns+` FROM caffeine_profile WHERE id = 1`))
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.DefaultProfile, nil
+	}
+	return profile, err
+}
+
+// UpdateProfile saves the profile and returns it as stored
+func (s *Store) UpdateProfile(ctx context.Context, profile models.Profile) (models.Profile, error) {
+	q := `INSERT INTO caffeine_profile (id, ` + profileColumns + `) VALUES (1, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET half_life = excluded.half_life, weight = excluded.weight,
+			daily_limit = excluded.daily_limit, bedtime = excluded.bedtime, smoker = excluded.smoker,
+			oral_contraceptives = excluded.oral_contraceptives, pregnant = excluded.pregnant, updated_at = excluded.updated_at
+		RETURNING ` + profileColumns
+	return scanProfile(s.db.QueryRowContext(ctx, q, profile.HalfLife, profile.Weight, profile.DailyLimit, profile.Bedtime,
+		profile.Smoker, profile.OralContraceptives, profile.Pregnant, time.Now().Unix()))
+}
+
+func scanProfile(row scanner) (models.Profile, error) {
+	var profile models.Profile
+	var halfLife, weight sql.NullFloat64
+	var dailyLimit sql.NullInt64
+	var updatedAt int64
+	err := row.Scan(&halfLife, &weight, &dailyLimit, &profile.Bedtime, &profile.Smoker, &profile.OralContraceptives,
+		&profile.Pregnant, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Profile{}, err
+	}
+	if err != nil {
+		return models.Profile{}, fmt.Errorf("failed to scan profile: %w", err)
+	}
+	if halfLife.Valid {
+		profile.HalfLife = &halfLife.Float64
+	}
+	if weight.Valid {
+		profile.Weight = &weight.Float64
+	}
+	profile.DailyLimit = nullInt(dailyLimit)
+	profile.UpdatedAt = time.Unix(updatedAt, 0)
+	return profile, nil
+}
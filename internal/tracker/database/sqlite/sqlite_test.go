@@ -0,0 +1,81 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baely/txn/internal/tracker/database"
+	"github.com/baely/txn/internal/tracker/database/storetest"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Store {
+		s, err := Open(filepath.Join(t.TempDir(), "tracker.db"))
+		if err != nil {
+			t.Fatalf("failed to open store: %v", err)
+		}
+		return s
+	})
+}
+
+// TestReopen checks that opening an existing database keeps its data and does
+// not seed the defaults a second time
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tracker.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	ctx := context.Background()
+	if err := s.DeletePreset(ctx, database.DefaultPresets[0].Slug); err != nil {
+		t.Fatalf("failed to delete preset: %v", err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	presets, err := s.ListPresets(ctx)
+	if err != nil {
+		t.Fatalf("failed to list presets: %v", err)
+	}
+	if len(presets) != len(database.DefaultPresets)-1 {
+		t.Fatalf("got %d presets, want the deleted default to stay deleted", len(presets))
+	}
+}
+
+// TestUpgrade checks that a version 2 database gains the columns added since
+func TestUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tracker.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	ctx := context.Background()
+	for _, q := range []string{
+		`DROP INDEX caffeine_event_reversed_by_idx`,
+		`ALTER TABLE caffeine_event DROP COLUMN reversed_by_item`,
+		`ALTER TABLE caffeine_event DROP COLUMN reversed_by`,
+		`ALTER TABLE caffeine_event DROP COLUMN deleted`,
+		`PRAGMA user_version = 2`,
+	} {
+		if _, err := s.(*Store).db.ExecContext(ctx, q); err != nil {
+			t.Fatalf("failed to downgrade schema: %v", err)
+		}
+	}
+	s.(*Store).db.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	if _, err := s.ReverseRefundedEvent(ctx, models.CaffeineEvent{Description: "Flat white", SourceTransactionID: "tx-1"}); err != nil {
+		t.Fatalf("failed to reverse after upgrade: %v", err)
+	}
+	if _, err := s.GetEvents(ctx, time.Unix(0, 0), time.Now()); err != nil {
+		t.Fatalf("failed to read events after upgrade: %v", err)
+	}
+}
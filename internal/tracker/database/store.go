@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+// Store is the storage the tracker runs on. Client stores in Postgres, and
+// the memory and sqlite packages provide backends for local development.
+// Every backend passes the storetest conformance suite.
+type Store interface {
+	// Caffeine events
+	AddEvent(ctx context.Context, event models.CaffeineEvent) error
+	GetEvents(ctx context.Context, start, end time.Time) ([]models.CaffeineEvent, error)
+	GetTotalCost(ctx context.Context, start, end time.Time) (int, error)
+	GetTotalIntake(ctx context.Context, start, end time.Time) (int, error)
+	GetEvent(ctx context.Context, id int64) (models.CaffeineEvent, error)
+	CreateEvent(ctx context.Context, event models.CaffeineEvent) (models.CaffeineEvent, error)
+	UpdateEvent(ctx context.Context, event models.CaffeineEvent) (models.CaffeineEvent, error)
+	DeleteEvent(ctx context.Context, id int64) error
+	GetEventsBySource(ctx context.Context, transactionIDs []string) ([]models.CaffeineEvent, error)
+	GetFlaggedEvents(ctx context.Context) ([]models.CaffeineEvent, error)
+	DeleteEventsBySource(ctx context.Context, transactionID string) (int64, error)
+	ReverseRefundedEvent(ctx context.Context, refund models.CaffeineEvent) (int64, error)
+	SetForSomeoneElse(ctx context.Context, transactionID string, item int, forSomeoneElse bool) error
+	ApplyEventChanges(ctx context.Context, changes []models.EventChange) error
+
+	// Matching rules
+	ListRules(ctx context.Context) ([]models.Rule, error)
+	GetRule(ctx context.Context, id int64) (models.Rule, error)
+	CreateRule(ctx context.Context, rule models.Rule) (models.Rule, error)
+	UpdateRule(ctx context.Context, rule models.Rule) (models.Rule, error)
+	DeleteRule(ctx context.Context, id int64) error
+
+	// Unmatched purchases awaiting review
+	AddCandidate(ctx context.Context, candidate models.Candidate) error
+	DeletePendingCandidate(ctx context.Context, transactionID string) error
+	ListCandidates(ctx context.Context, status models.CandidateStatus) ([]models.Candidate, error)
+	GetCandidate(ctx context.Context, id int64) (models.Candidate, error)
+	ResolveCandidate(ctx context.Context, id int64, status models.CandidateStatus, event *models.CaffeineEvent, rule *models.Rule) (models.Candidate, error)
+
+	// Quick-add presets
+	ListPresets(ctx context.Context) ([]models.Preset, error)
+	GetPreset(ctx context.Context, slug string) (models.Preset, error)
+	CreatePreset(ctx context.Context, preset models.Preset) (models.Preset, error)
+	UpdatePreset(ctx context.Context, slug string, preset models.Preset) (models.Preset, error)
+	DeletePreset(ctx context.Context, slug string) error
+
+	// Personal profile
+	GetProfile(ctx context.Context) (models.Profile, error)
+	UpdateProfile(ctx context.Context, profile models.Profile) (models.Profile, error)
+}
+
+var _ Store = (*Client)(nil)
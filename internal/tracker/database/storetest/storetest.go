@@ -0,0 +1,552 @@
+// Package storetest is the conformance suite every tracker store must pass.
+// A backend's tests call Run with a function opening an empty store.
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/baely/txn/internal/common/errors"
+	"github.com/baely/txn/internal/tracker/database"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+// Open returns a new, freshly seeded store. It is called once per test.
+type Open func(t *testing.T) database.Store
+
+// Run runs the conformance suite against the stores open returns
+func Run(t *testing.T, open Open) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s database.Store)
+	}{
+		{"Seeds", testSeeds},
+		{"AddEventOnce", testAddEventOnce},
+		{"EventRange", testEventRange},
+		{"EventCRUD", testEventCRUD},
+		{"DeleteSourcedEvent", testDeleteSourcedEvent},
+		{"EventsBySource", testEventsBySource},
+		{"ReverseRefundedEvent", testReverseRefundedEvent},
+		{"ForSomeoneElse", testForSomeoneElse},
+		{"ApplyEventChanges", testApplyEventChanges},
+		{"Rules", testRules},
+		{"Candidates", testCandidates},
+		{"ResolveCandidate", testResolveCandidate},
+		{"Presets", testPresets},
+		{"Profile", testProfile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, open(t))
+		})
+	}
+}
+
+// base is a fixed time the tests build event times from
+var base = time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+
+func at(minutes int) time.Time {
+	return base.Add(time.Duration(minutes) * time.Minute)
+}
+
+func sourced(transactionID string, item, minutes int) models.CaffeineEvent {
+	return models.CaffeineEvent{
+		Timestamp:           at(minutes),
+		Description:         "Flat white " + transactionID,
+		Amount:              160,
+		Cost:                550,
+		SourceTransactionID: transactionID,
+		SourceItem:          item,
+		Confidence:          1,
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func wantErr(t *testing.T, err, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("got error %v, want %v", err, target)
+	}
+}
+
+func testSeeds(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	rules, err := s.ListRules(ctx)
+	must(t, err)
+	if len(rules) != len(database.DefaultRules) {
+		t.Fatalf("got %d seeded rules, want %d", len(rules), len(database.DefaultRules))
+	}
+	presets, err := s.ListPresets(ctx)
+	must(t, err)
+	if len(presets) != len(database.DefaultPresets) {
+		t.Fatalf("got %d seeded presets, want %d", len(presets), len(database.DefaultPresets))
+	}
+}
+
+func testAddEventOnce(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	must(t, s.AddEvent(ctx, sourced("tx-1", 0, 0)))
+	must(t, s.AddEvent(ctx, sourced("tx-1", 0, 0)))
+	must(t, s.AddEvent(ctx, sourced("tx-1", 1, 0)))
+
+	// Manual events have no source and are never deduplicated
+	manual := models.CaffeineEvent{Timestamp: at(5), Description: "Espresso", Amount: 80, Confidence: 1}
+	must(t, s.AddEvent(ctx, manual))
+	must(t, s.AddEvent(ctx, manual))
+
+	events, err := s.GetEvents(ctx, at(-1), at(10))
+	must(t, err)
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4", len(events))
+	}
+	if events[0].ID == 0 || events[0].ID == events[1].ID {
+		t.Fatalf("events were not given distinct ids: %d, %d", events[0].ID, events[1].ID)
+	}
+}
+
+func testEventRange(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	must(t, s.AddEvent(ctx, sourced("tx-1", 0, 0)))
+	must(t, s.AddEvent(ctx, sourced("tx-2", 0, 10)))
+	other := sourced("tx-3", 0, 20)
+	other.ForSomeoneElse = true
+	must(t, s.AddEvent(ctx, other))
+
+	events, err := s.GetEvents(ctx, at(0), at(30))
+	must(t, err)
+	if len(events) != 2 || events[0].SourceTransactionID != "tx-2" {
+		t.Fatalf("got %+v, want tx-2 and tx-3 since the range is exclusive", events)
+	}
+	if !events[0].Timestamp.Equal(at(10)) {
+		t.Fatalf("got timestamp %v, want %v", events[0].Timestamp, at(10))
+	}
+
+	total := func(sum func(context.Context, time.Time, time.Time) (int, error), start, end time.Time) int {
+		t.Helper()
+		got, err := sum(ctx, start, end)
+		must(t, err)
+		return got
+	}
+	if got := total(s.GetTotalCost, at(-1), at(30)); got != 3*550 {
+		t.Fatalf("got total cost %d, want %d", got, 3*550)
+	}
+	if got := total(s.GetTotalIntake, at(-1), at(30)); got != 2*160 {
+		t.Fatalf("got total intake %d, want %d excluding drinks for someone else", got, 2*160)
+	}
+	if got := total(s.GetTotalIntake, time.Unix(0, 0).Add(-time.Hour), at(5)); got != 160 {
+		t.Fatalf("got total intake %d before the epoch, want 160", got)
+	}
+	if got := total(s.GetTotalCost, at(40), at(50)); got != 0 {
+		t.Fatalf("got total cost %d for an empty range, want 0", got)
+	}
+}
+
+func testEventCRUD(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	created, err := s.CreateEvent(ctx, models.CaffeineEvent{Timestamp: at(0), Description: "Cold brew", Amount: 200, Cost: 700, Confidence: 1})
+	must(t, err)
+	got, err := s.GetEvent(ctx, created.ID)
+	must(t, err)
+	if got.Description != "Cold brew" || got.Amount != 200 || got.Cost != 700 || !got.Timestamp.Equal(at(0)) {
+		t.Fatalf("got %+v, want the created event", got)
+	}
+
+	got.Description, got.Amount, got.Edited = "Iced latte", 150, true
+	updated, err := s.UpdateEvent(ctx, got)
+	must(t, err)
+	if updated.Description != "Iced latte" || updated.Amount != 150 || !updated.Edited {
+		t.Fatalf("got %+v, want the updated event", updated)
+	}
+
+	must(t, s.DeleteEvent(ctx, created.ID))
+	_, err = s.GetEvent(ctx, created.ID)
+	wantErr(t, err, errors.ErrNotFound)
+	wantErr(t, s.DeleteEvent(ctx, created.ID), errors.ErrNotFound)
+	_, err = s.UpdateEvent(ctx, got)
+	wantErr(t, err, errors.ErrNotFound)
+}
+
+func testDeleteSourcedEvent(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	flagged := sourced("tx-1", 0, 0)
+	flagged.Flagged = true
+	must(t, s.AddEvent(ctx, flagged))
+	events, err := s.GetEventsBySource(ctx, []string{"tx-1"})
+	must(t, err)
+	id := events[0].ID
+
+	must(t, s.DeleteEvent(ctx, id))
+	_, err = s.GetEvent(ctx, id)
+	wantErr(t, err, errors.ErrNotFound)
+	wantErr(t, s.DeleteEvent(ctx, id), errors.ErrNotFound)
+	_, err = s.UpdateEvent(ctx, events[0])
+	wantErr(t, err, errors.ErrNotFound)
+
+	// A backfill of the same transaction does not add it back
+	must(t, s.AddEvent(ctx, sourced("tx-1", 0, 0)))
+	events, err = s.GetEvents(ctx, at(-1), at(1))
+	must(t, err)
+	if len(events) != 0 {
+		t.Fatalf("got %+v, want the deleted event left out", events)
+	}
+	intake, err := s.GetTotalIntake(ctx, at(-1), at(1))
+	must(t, err)
+	if intake != 0 {
+		t.Fatalf("got intake %d, want 0", intake)
+	}
+	events, err = s.GetFlaggedEvents(ctx)
+	must(t, err)
+	if len(events) != 0 {
+		t.Fatalf("got %d flagged events, want the deleted event left out", len(events))
+	}
+
+	// Reprocessing still sees it, as edited by hand
+	events, err = s.GetEventsBySource(ctx, []string{"tx-1"})
+	must(t, err)
+	if len(events) != 1 || !events[0].Deleted || !events[0].Edited {
+		t.Fatalf("got %+v, want the event marked deleted and edited", events)
+	}
+}
+
+func testEventsBySource(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	must(t, s.AddEvent(ctx, sourced("tx-1", 1, 0)))
+	must(t, s.AddEvent(ctx, sourced("tx-1", 0, 0)))
+	flagged := sourced("tx-2", 0, 5)
+	flagged.Flagged, flagged.Confidence = true, 0.6
+	must(t, s.AddEvent(ctx, flagged))
+
+	events, err := s.GetEventsBySource(ctx, []string{"tx-1"})
+	must(t, err)
+	if len(events) != 2 || events[0].SourceItem != 0 || events[1].SourceItem != 1 {
+		t.Fatalf("got %+v, want tx-1 items 0 and 1", events)
+	}
+	events, err = s.GetEventsBySource(ctx, nil)
+	must(t, err)
+	if len(events) != 0 {
+		t.Fatalf("got %d events for no transactions, want 0", len(events))
+	}
+
+	events, err = s.GetFlaggedEvents(ctx)
+	must(t, err)
+	if len(events) != 1 || events[0].SourceTransactionID != "tx-2" || events[0].Confidence != 0.6 {
+		t.Fatalf("got %+v, want the flagged tx-2 event", events)
+	}
+
+	removed, err := s.DeleteEventsBySource(ctx, "tx-1")
+	must(t, err)
+	if removed != 2 {
+		t.Fatalf("removed %d events, want 2", removed)
+	}
+}
+
+func testReverseRefundedEvent(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	must(t, s.AddEvent(ctx, sourced("tx-1", 0, 0)))
+	second := sourced("tx-2", 0, 10)
+	second.Description = "Flat white tx-1"
+	must(t, s.AddEvent(ctx, second))
+	manual := second
+	manual.Timestamp, manual.SourceTransactionID = at(15), ""
+	must(t, s.AddEvent(ctx, manual))
+
+	refund := models.CaffeineEvent{Timestamp: at(20), Description: "Flat white tx-1", Cost: 550, SourceTransactionID: "tx-3"}
+	reversed, err := s.ReverseRefundedEvent(ctx, refund)
+	must(t, err)
+	if reversed != 1 {
+		t.Fatalf("reversed %d events, want 1", reversed)
+	}
+	events, err := s.GetEventsBySource(ctx, []string{"tx-1", "tx-2"})
+	must(t, err)
+	if len(events) != 2 || events[0].ReversedBy != "" || events[1].ReversedBy != "tx-3" {
+		t.Fatalf("got %+v, want the later Up purchase reversed by tx-3", events)
+	}
+
+	// Replaying the refund reverses nothing more
+	reversed, err = s.ReverseRefundedEvent(ctx, refund)
+	must(t, err)
+	if reversed != 0 {
+		t.Fatalf("reversed %d events replaying the refund, want 0", reversed)
+	}
+
+	events, err = s.GetEvents(ctx, at(-1), at(30))
+	must(t, err)
+	if len(events) != 2 || events[0].SourceTransactionID != "tx-1" || events[1].SourceTransactionID != "" {
+		t.Fatalf("got %+v, want the earlier purchase and the manual event", events)
+	}
+	cost, err := s.GetTotalCost(ctx, at(-1), at(30))
+	must(t, err)
+	if cost != 1100 {
+		t.Fatalf("got cost %d, want 1100", cost)
+	}
+	intake, err := s.GetTotalIntake(ctx, at(-1), at(30))
+	must(t, err)
+	if intake != 320 {
+		t.Fatalf("got intake %d, want 320", intake)
+	}
+
+	refund.SourceTransactionID, refund.Timestamp = "tx-4", at(-5)
+	reversed, err = s.ReverseRefundedEvent(ctx, refund)
+	must(t, err)
+	if reversed != 0 {
+		t.Fatalf("reversed %d events refunded before the purchase, want 0", reversed)
+	}
+
+	// Removing the refund makes the purchase count again
+	_, err = s.DeleteEventsBySource(ctx, "tx-3")
+	must(t, err)
+	events, err = s.GetEvents(ctx, at(-1), at(30))
+	must(t, err)
+	if len(events) != 3 {
+		t.Fatalf("got %d events after removing the refund, want 3", len(events))
+	}
+}
+
+func testForSomeoneElse(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	must(t, s.AddEvent(ctx, sourced("tx-1", 0, 0)))
+	must(t, s.SetForSomeoneElse(ctx, "tx-1", 0, true))
+	events, err := s.GetEventsBySource(ctx, []string{"tx-1"})
+	must(t, err)
+	if !events[0].ForSomeoneElse {
+		t.Fatalf("event was not marked for someone else")
+	}
+	wantErr(t, s.SetForSomeoneElse(ctx, "tx-1", 1, true), errors.ErrNotFound)
+}
+
+func testApplyEventChanges(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	must(t, s.AddEvent(ctx, sourced("tx-1", 0, 0)))
+	must(t, s.AddEvent(ctx, sourced("tx-2", 0, 5)))
+	must(t, s.AddCandidate(ctx, models.Candidate{SourceTransactionID: "tx-3", Merchant: "Cafe", Category: "restaurants-and-cafes", Cost: 600, Timestamp: at(10)}))
+
+	updated := sourced("tx-1", 0, 0)
+	updated.Amount, updated.Flagged, updated.Confidence = 80, true, 0.7
+	updated.ReversedBy, updated.ReversedByItem = "tx-9", 1
+	added := sourced("tx-3", 0, 10)
+	must(t, s.ApplyEventChanges(ctx, []models.EventChange{
+		{Action: models.ChangeUpdate, SourceTransactionID: "tx-1", After: &updated},
+		{Action: models.ChangeRemove, SourceTransactionID: "tx-2"},
+		{Action: models.ChangeAdd, SourceTransactionID: "tx-3", After: &added},
+	}))
+
+	events, err := s.GetEventsBySource(ctx, []string{"tx-1", "tx-2", "tx-3"})
+	must(t, err)
+	if len(events) != 2 || events[0].Amount != 80 || !events[0].Flagged || events[0].ReversedBy != "tx-9" || events[0].ReversedByItem != 1 ||
+		events[1].SourceTransactionID != "tx-3" {
+		t.Fatalf("got %+v, want tx-1 updated, tx-2 removed and tx-3 added", events)
+	}
+	candidates, err := s.ListCandidates(ctx, models.CandidatePending)
+	must(t, err)
+	if len(candidates) != 0 {
+		t.Fatalf("got %d pending candidates, want the added transaction's candidate removed", len(candidates))
+	}
+
+	// A bad change leaves everything as it was
+	err = s.ApplyEventChanges(ctx, []models.EventChange{
+		{Action: models.ChangeRemove, SourceTransactionID: "tx-1"},
+		{Action: "rename", SourceTransactionID: "tx-3"},
+	})
+	if err == nil {
+		t.Fatalf("applied an unknown change action")
+	}
+	events, err = s.GetEventsBySource(ctx, []string{"tx-1"})
+	must(t, err)
+	if len(events) != 1 {
+		t.Fatalf("a failed apply removed tx-1")
+	}
+}
+
+func testRules(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	price := 450
+	created, err := s.CreateRule(ctx, models.Rule{
+		Name:     "Early espresso",
+		Priority: 1,
+		Merchant: "Corner Espresso",
+		Price:    &price,
+		Drink:    "Espresso",
+		Caffeine: 80,
+	})
+	must(t, err)
+	if created.ID == 0 || created.MerchantMatch != models.MatchExact || created.CreatedAt.IsZero() {
+		t.Fatalf("got %+v, want an id, exact matching and a creation time", created)
+	}
+
+	rules, err := s.ListRules(ctx)
+	must(t, err)
+	if rules[0].ID != created.ID {
+		t.Fatalf("got %q first, want the lowest priority rule first", rules[0].Name)
+	}
+
+	got, err := s.GetRule(ctx, created.ID)
+	must(t, err)
+	if got.Price == nil || *got.Price != 450 || got.MinPrice != nil {
+		t.Fatalf("got prices %v %v, want price 450 and no range", got.Price, got.MinPrice)
+	}
+
+	got.Price, got.MinPrice, got.MaxPrice, got.Tolerance, got.Surcharge = nil, &price, nil, 20, 1.5
+	updated, err := s.UpdateRule(ctx, got)
+	must(t, err)
+	if updated.Price != nil || updated.MinPrice == nil || *updated.MinPrice != 450 || updated.Tolerance != 20 || updated.Surcharge != 1.5 {
+		t.Fatalf("got %+v, want the updated prices", updated)
+	}
+
+	must(t, s.DeleteRule(ctx, created.ID))
+	_, err = s.GetRule(ctx, created.ID)
+	wantErr(t, err, errors.ErrNotFound)
+	wantErr(t, s.DeleteRule(ctx, created.ID), errors.ErrNotFound)
+	_, err = s.UpdateRule(ctx, got)
+	wantErr(t, err, errors.ErrNotFound)
+}
+
+func testCandidates(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	candidate := models.Candidate{SourceTransactionID: "tx-1", Merchant: "New Cafe", RawText: "SQ *NEW CAFE", Category: "restaurants-and-cafes", Cost: 620, Timestamp: at(0)}
+	must(t, s.AddCandidate(ctx, candidate))
+	candidate.Cost = 999
+	must(t, s.AddCandidate(ctx, candidate))
+	must(t, s.AddCandidate(ctx, models.Candidate{SourceTransactionID: "tx-2", Merchant: "Other Cafe", Category: "restaurants-and-cafes", Cost: 500, Timestamp: at(-10)}))
+
+	pending, err := s.ListCandidates(ctx, models.CandidatePending)
+	must(t, err)
+	if len(pending) != 2 || pending[0].SourceTransactionID != "tx-2" {
+		t.Fatalf("got %+v, want two pending candidates, oldest first", pending)
+	}
+	got, err := s.GetCandidate(ctx, pending[1].ID)
+	must(t, err)
+	if got.Cost != 620 || got.RawText != "SQ *NEW CAFE" || got.Status != models.CandidatePending || got.ReviewedAt != nil {
+		t.Fatalf("got %+v, want the first queued purchase, unreviewed", got)
+	}
+
+	must(t, s.DeletePendingCandidate(ctx, "tx-2"))
+	_, err = s.GetCandidate(ctx, pending[0].ID)
+	wantErr(t, err, errors.ErrNotFound)
+}
+
+func testResolveCandidate(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	must(t, s.AddCandidate(ctx, models.Candidate{SourceTransactionID: "tx-1", Merchant: "New Cafe", Category: "restaurants-and-cafes", Cost: 620, Timestamp: at(0)}))
+	must(t, s.AddCandidate(ctx, models.Candidate{SourceTransactionID: "tx-2", Merchant: "Bakery", Category: "restaurants-and-cafes", Cost: 400, Timestamp: at(5)}))
+	pending, err := s.ListCandidates(ctx, models.CandidatePending)
+	must(t, err)
+
+	event := models.CaffeineEvent{Timestamp: at(0), Description: "Long black", Amount: 160, Cost: 620, SourceTransactionID: "tx-1", Confidence: 1}
+	rule := models.Rule{Name: "Reviewed New Cafe", Priority: 100, Merchant: "New Cafe", Price: &event.Cost, Drink: "Long black", Caffeine: 160}
+	resolved, err := s.ResolveCandidate(ctx, pending[0].ID, models.CandidateDrink, &event, &rule)
+	must(t, err)
+	if resolved.Status != models.CandidateDrink || resolved.Drink != "Long black" || resolved.Caffeine != 160 || resolved.RuleID == nil || resolved.ReviewedAt == nil {
+		t.Fatalf("got %+v, want a reviewed drink with its rule", resolved)
+	}
+	ruleID := *resolved.RuleID
+	if _, err := s.GetRule(ctx, ruleID); err != nil {
+		t.Fatalf("rule created in review was not stored: %v", err)
+	}
+	events, err := s.GetEventsBySource(ctx, []string{"tx-1"})
+	must(t, err)
+	if len(events) != 1 || events[0].Amount != 160 || !events[0].Edited {
+		t.Fatalf("got %+v, want the reviewed drink recorded as edited", events)
+	}
+
+	_, err = s.ResolveCandidate(ctx, pending[0].ID, models.CandidateNotCaffeine, nil, nil)
+	wantErr(t, err, errors.ErrAlreadyExists)
+	_, err = s.ResolveCandidate(ctx, 1<<40, models.CandidateNotCaffeine, nil, nil)
+	wantErr(t, err, errors.ErrNotFound)
+
+	resolved, err = s.ResolveCandidate(ctx, pending[1].ID, models.CandidateNotCaffeine, nil, nil)
+	must(t, err)
+	if resolved.RuleID != nil || resolved.Drink != "" {
+		t.Fatalf("got %+v, want no rule or drink", resolved)
+	}
+	reviewed, err := s.ListCandidates(ctx, models.CandidateNotCaffeine)
+	must(t, err)
+	if len(reviewed) != 1 {
+		t.Fatalf("got %d not_caffeine candidates, want 1", len(reviewed))
+	}
+
+	// Deleting the rule keeps the review
+	must(t, s.DeleteRule(ctx, ruleID))
+	resolved, err = s.GetCandidate(ctx, pending[0].ID)
+	must(t, err)
+	if resolved.Status != models.CandidateDrink || resolved.RuleID != nil {
+		t.Fatalf("got %+v, want the review kept without its rule", resolved)
+	}
+}
+
+func testPresets(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	created, err := s.CreatePreset(ctx, models.Preset{Slug: "aeropress", Description: "AeroPress", Amount: 120, Cost: 100})
+	must(t, err)
+	if created.ID == 0 || created.CreatedAt.IsZero() {
+		t.Fatalf("got %+v, want an id and creation time", created)
+	}
+	_, err = s.CreatePreset(ctx, models.Preset{Slug: "aeropress", Description: "Again", Amount: 1})
+	wantErr(t, err, errors.ErrAlreadyExists)
+
+	got, err := s.GetPreset(ctx, "aeropress")
+	must(t, err)
+	if got.Amount != 120 || got.Description != "AeroPress" {
+		t.Fatalf("got %+v, want the created preset", got)
+	}
+
+	renamed, err := s.UpdatePreset(ctx, "aeropress", models.Preset{Slug: "aeropress-double", Description: "Double AeroPress", Amount: 240, Cost: 200})
+	must(t, err)
+	if renamed.ID != created.ID || renamed.Slug != "aeropress-double" {
+		t.Fatalf("got %+v, want the preset renamed in place", renamed)
+	}
+	_, err = s.GetPreset(ctx, "aeropress")
+	wantErr(t, err, errors.ErrNotFound)
+	_, err = s.UpdatePreset(ctx, "aeropress-double", models.Preset{Slug: database.DefaultPresets[0].Slug, Description: "Clash", Amount: 1})
+	wantErr(t, err, errors.ErrAlreadyExists)
+	_, err = s.UpdatePreset(ctx, "missing", models.Preset{Slug: "missing", Description: "Missing", Amount: 1})
+	wantErr(t, err, errors.ErrNotFound)
+
+	presets, err := s.ListPresets(ctx)
+	must(t, err)
+	for i := 1; i < len(presets); i++ {
+		if presets[i-1].Slug > presets[i].Slug {
+			t.Fatalf("presets are not ordered by slug: %s before %s", presets[i-1].Slug, presets[i].Slug)
+		}
+	}
+
+	must(t, s.DeletePreset(ctx, "aeropress-double"))
+	wantErr(t, s.DeletePreset(ctx, "aeropress-double"), errors.ErrNotFound)
+}
+
+func testProfile(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	got, err := s.GetProfile(ctx)
+	must(t, err)
+	if got.Bedtime != database.DefaultProfile.Bedtime || got.HalfLife != nil || !got.UpdatedAt.IsZero() {
+		t.Fatalf("got %+v, want the default profile", got)
+	}
+
+	halfLife, weight, limit := 5.5, 72.5, 300
+	saved, err := s.UpdateProfile(ctx, models.Profile{HalfLife: &halfLife, Weight: &weight, DailyLimit: &limit, Bedtime: "23:15", Smoker: true})
+	must(t, err)
+	if saved.UpdatedAt.IsZero() {
+		t.Fatalf("got %+v, want an update time", saved)
+	}
+
+	got, err = s.GetProfile(ctx)
+	must(t, err)
+	if got.HalfLife == nil || *got.HalfLife != halfLife || got.Weight == nil || *got.Weight != weight ||
+		got.DailyLimit == nil || *got.DailyLimit != limit || got.Bedtime != "23:15" || !got.Smoker || got.Pregnant {
+		t.Fatalf("got %+v, want the saved profile", got)
+	}
+
+	_, err = s.UpdateProfile(ctx, models.Profile{Bedtime: "21:00", Pregnant: true})
+	must(t, err)
+	got, err = s.GetProfile(ctx)
+	must(t, err)
+	if got.HalfLife != nil || got.Weight != nil || got.DailyLimit != nil || got.Smoker || !got.Pregnant {
+		t.Fatalf("got %+v, want unset fields cleared", got)
+	}
+}
@@ -0,0 +1,125 @@
+// Package kinetics models how much caffeine is left in the body after a drink
+package kinetics
+
+import (
+	"math"
+	"time"
+
+	"github.com/baely/txn/internal/common/errors"
+)
+
+// Model names accepted by New
+const (
+	ModelExponential = "exponential"
+	ModelAbsorption  = "absorption"
+)
+
+// DefaultModel is the model used when none is asked for
+const DefaultModel = ModelAbsorption
+
+// Model gives the caffeine in the body over time after a single dose
+type Model interface {
+	// Amount returns the mg of caffeine in the body elapsed after a dose of mg
+	Amount(dose float64, elapsed time.Duration) float64
+	// Peak returns how long after a dose the amount is highest
+	Peak() time.Duration
+}
+
+// Params are the inputs shared by the models
+type Params struct {
+	HalfLife        time.Duration // Elimination half-life
+	AbsorptionRate  float64       // First-order absorption rate constant (ka) per hour
+	Bioavailability float64       // Fraction of the dose that reaches the bloodstream, 0 to 1
+}
+
+// DefaultParams returns parameters for a typical healthy adult
+func DefaultParams() Params {
+	return Params{
+		HalfLife:        4 * time.Hour,
+		AbsorptionRate:  4,
+		Bioavailability: 0.99,
+	}
+}
+
+// New returns the named model. An empty name returns the DefaultModel.
+func New(name string, p Params) (Model, error) {
+	if p.HalfLife <= 0 {
+		return nil, errors.Wrap(errors.ErrInvalidInput, "half-life must be positive")
+	}
+
+	switch name {
+	case ModelAbsorption, "":
+		if p.AbsorptionRate <= 0 {
+			return nil, errors.Wrap(errors.ErrInvalidInput, "absorption rate must be positive")
+		}
+		if p.Bioavailability <= 0 || p.Bioavailability > 1 {
+			return nil, errors.Wrap(errors.ErrInvalidInput, "bioavailability must be between 0 and 1")
+		}
+		return Absorption{
+			HalfLife:        p.HalfLife,
+			AbsorptionRate:  p.AbsorptionRate,
+			Bioavailability: p.Bioavailability,
+		}, nil
+	case ModelExponential:
+		return Exponential{HalfLife: p.HalfLife}, nil
+	default:
+		return nil, errors.Wrap(errors.ErrInvalidInput, "unknown model %q", name)
+	}
+}
+
+// Exponential puts the whole dose in the bloodstream at once and decays it
+// with the half-life
+type Exponential struct {
+	HalfLife time.Duration
+}
+
+// Amount implements Model
+func (m Exponential) Amount(dose float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		return 0
+	}
+	return dose * math.Pow(0.5, elapsed.Hours()/m.HalfLife.Hours())
+}
+
+// Peak implements Model. The whole dose is there at once.
+func (m Exponential) Peak() time.Duration {
+	return 0
+}
+
+// Absorption is a one-compartment model with first-order absorption. The dose
+// rises to a peak as it is absorbed from the gut, then decays with the half-life.
+type Absorption struct {
+	HalfLife        time.Duration
+	AbsorptionRate  float64 // ka per hour
+	Bioavailability float64
+}
+
+// Amount implements Model
+func (m Absorption) Amount(dose float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		return 0
+	}
+	t := elapsed.Hours()
+	ka := m.AbsorptionRate
+	ke := math.Ln2 / m.HalfLife.Hours()
+	absorbed := dose * m.Bioavailability
+
+	// The general solution divides by zero when absorption and elimination
+	// run at the same rate, so use its limit instead
+	if math.Abs(ka-ke) < 1e-9 {
+		return absorbed * ke * t * math.Exp(-ke*t)
+	}
+	return absorbed * ka / (ka - ke) * (math.Exp(-ke*t) - math.Exp(-ka*t))
+}
+
+// Peak implements Model. The amount peaks at ln(ka/ke)/(ka−ke) hours, or 1/ke
+// when the rates are equal.
+func (m Absorption) Peak() time.Duration {
+	ka := m.AbsorptionRate
+	ke := math.Ln2 / m.HalfLife.Hours()
+	hours := 1 / ke
+	if math.Abs(ka-ke) >= 1e-9 {
+		hours = math.Log(ka/ke) / (ka - ke)
+	}
+	return time.Duration(hours * float64(time.Hour))
+}
@@ -0,0 +1,120 @@
+package kinetics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/baely/txn/internal/common/errors"
+)
+
+func hours(h float64) time.Duration {
+	return time.Duration(h * float64(time.Hour))
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name   string
+		model  string
+		change func(p *Params)
+		want   Model
+	}{
+		{"default", "", func(p *Params) {}, Absorption{HalfLife: 4 * time.Hour, AbsorptionRate: 4, Bioavailability: 0.99}},
+		{"exponential", ModelExponential, func(p *Params) {}, Exponential{HalfLife: 4 * time.Hour}},
+		{"exponential ignores absorption", ModelExponential, func(p *Params) { p.AbsorptionRate = 0 }, Exponential{HalfLife: 4 * time.Hour}},
+		{"unknown model", "two-compartment", func(p *Params) {}, nil},
+		{"zero half-life", ModelExponential, func(p *Params) { p.HalfLife = 0 }, nil},
+		{"negative half-life", ModelAbsorption, func(p *Params) { p.HalfLife = -time.Hour }, nil},
+		{"zero absorption rate", ModelAbsorption, func(p *Params) { p.AbsorptionRate = 0 }, nil},
+		{"zero bioavailability", ModelAbsorption, func(p *Params) { p.Bioavailability = 0 }, nil},
+		{"bioavailability over 1", ModelAbsorption, func(p *Params) { p.Bioavailability = 1.01 }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := DefaultParams()
+			tt.change(&p)
+			got, err := New(tt.model, p)
+			if tt.want == nil {
+				if !errors.Is(err, errors.ErrInvalidInput) {
+					t.Fatalf("got %v, want ErrInvalidInput", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("got %#v, %v, want %#v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmount(t *testing.T) {
+	ke := math.Ln2 / 4
+	absorption := Absorption{HalfLife: 4 * time.Hour, AbsorptionRate: 4, Bioavailability: 0.99}
+	// With equal rates the amount is F·D·ke·t·e^(−ke·t)
+	equal := Absorption{HalfLife: 4 * time.Hour, AbsorptionRate: ke, Bioavailability: 1}
+	nearlyEqual := equal
+	nearlyEqual.AbsorptionRate = ke * (1 + 1e-6)
+
+	tests := []struct {
+		name    string
+		model   Model
+		elapsed time.Duration
+		want    float64
+	}{
+		{"exponential at the dose", Exponential{HalfLife: 4 * time.Hour}, 0, 100},
+		{"exponential after a half-life", Exponential{HalfLife: 4 * time.Hour}, 4 * time.Hour, 50},
+		{"exponential after two half-lives", Exponential{HalfLife: 4 * time.Hour}, 8 * time.Hour, 25},
+		{"exponential before the dose", Exponential{HalfLife: 4 * time.Hour}, -time.Minute, 0},
+		{"absorption at the dose", absorption, 0, 0},
+		{"absorption before the dose", absorption, -time.Minute, 0},
+		{"absorption once absorbed", absorption, 12 * time.Hour, 99 * 4 / (4 - ke) * (math.Exp(-ke*12) - math.Exp(-4*12))},
+		{"equal rates", equal, 2 * time.Hour, 100 * ke * 2 * math.Exp(-ke*2)},
+		{"equal rates at the peak", equal, hours(1 / ke), 100 / math.E},
+		{"nearly equal rates", nearlyEqual, 2 * time.Hour, 100 * ke * 2 * math.Exp(-ke*2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.model.Amount(100, tt.elapsed); math.Abs(got-tt.want) > 1e-4 {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPeak checks that the absorption model peaks at ln(ka/ke)/(ka−ke) and
+// stays below the dose, and that Peak reports when
+func TestPeak(t *testing.T) {
+	tests := []struct {
+		halfLife time.Duration
+		ka       float64
+	}{
+		{4 * time.Hour, 4},
+		{4 * time.Hour, 1},
+		{12 * time.Hour, 4},    // Pregnancy
+		{150 * time.Minute, 2}, // Smoker
+	}
+	for _, tt := range tests {
+		m := Absorption{HalfLife: tt.halfLife, AbsorptionRate: tt.ka, Bioavailability: 0.99}
+		ke := math.Ln2 / tt.halfLife.Hours()
+		peak := hours(math.Log(tt.ka/ke) / (tt.ka - ke))
+		if got := m.Peak(); (got - peak).Abs() > time.Second {
+			t.Errorf("half-life %v, ka %v: got a peak at %v, want %v", tt.halfLife, tt.ka, got, peak)
+		}
+
+		at := m.Amount(100, peak)
+		if before, after := m.Amount(100, peak-time.Minute), m.Amount(100, peak+time.Minute); before >= at || after >= at {
+			t.Errorf("half-life %v, ka %v: got %v at %v, want more than %v before and %v after", tt.halfLife, tt.ka, at, peak, before, after)
+		}
+		if at >= 99 {
+			t.Errorf("half-life %v, ka %v: got a peak of %v, want less than the absorbed dose", tt.halfLife, tt.ka, at)
+		}
+	}
+
+	ke := math.Ln2 / 4
+	if got, want := (Absorption{HalfLife: 4 * time.Hour, AbsorptionRate: ke, Bioavailability: 1}).Peak(), hours(1/ke); (got - want).Abs() > time.Second {
+		t.Errorf("equal rates: got a peak at %v, want %v", got, want)
+	}
+	if got := (Exponential{HalfLife: 4 * time.Hour}).Peak(); got != 0 {
+		t.Errorf("exponential: got a peak at %v, want the dose", got)
+	}
+}
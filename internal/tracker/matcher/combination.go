@@ -0,0 +1,120 @@
+package matcher
+
+import (
+	"slices"
+
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+// maxDrinks is the most drinks a transaction is split into
+const maxDrinks = 4
+
+// Multi-drink confidences
+const (
+	multipleConfidence    = 0.9  // Several of the same drink
+	combinationConfidence = 0.85 // A mix of drinks from one merchant
+	ambiguousConfidence   = 0.6  // More than one mix of drinks adds up to the price
+)
+
+// merchantDrinks are the priced drinks of one merchant that fit a transaction
+type merchantDrinks struct {
+	merchant float64
+	drinks   []*models.Rule
+}
+
+// matchCombination finds the fewest drinks from a single merchant whose prices
+// add up exactly to the transaction, trying each merchant the transaction
+// matches and keeping the most confident result
+func (m *Matcher) matchCombination(t transaction) ([]*models.Rule, float64) {
+	merchants := make(map[string]*merchantDrinks)
+	var order []string
+	for i := range m.rules {
+		c := &m.rules[i]
+		rule := &c.rule
+		if rule.NotCaffeine || rule.Price == nil || *rule.Price <= 0 || c.merchant == nil || !c.applies(t) {
+			continue
+		}
+		confidence := c.merchant(t.description)
+		if confidence == 0 {
+			continue
+		}
+
+		key := Normalize(rule.Merchant)
+		md, ok := merchants[key]
+		if !ok {
+			md = &merchantDrinks{merchant: confidence}
+			merchants[key] = md
+			order = append(order, key)
+		}
+		// Rules are in priority order, so the first rule for a price wins
+		if !slices.ContainsFunc(md.drinks, func(d *models.Rule) bool { return *d.Price == *rule.Price }) {
+			md.drinks = append(md.drinks, rule)
+		}
+	}
+
+	var best []*models.Rule
+	bestConfidence := 0.0
+	for _, key := range order {
+		md := merchants[key]
+		drinks, ambiguous := fewestDrinks(md.drinks, t.cost)
+		if drinks == nil {
+			continue
+		}
+
+		confidence := combinationConfidence
+		switch {
+		case ambiguous:
+			confidence = ambiguousConfidence
+		case allSame(drinks):
+			confidence = multipleConfidence
+		}
+		confidence *= md.merchant
+		if confidence > bestConfidence {
+			best = drinks
+			bestConfidence = confidence
+		}
+	}
+	return best, bestConfidence
+}
+
+// fewestDrinks returns the smallest multiset of at least two drinks whose
+// prices sum to cost, and whether another multiset of that size also does
+func fewestDrinks(drinks []*models.Rule, cost int) ([]*models.Rule, bool) {
+	for n := 2; n <= maxDrinks; n++ {
+		var found []*models.Rule
+		solutions := 0
+		var search func(start, remaining int, chosen []*models.Rule)
+		search = func(start, remaining int, chosen []*models.Rule) {
+			if len(chosen) == n {
+				if remaining == 0 {
+					solutions++
+					if found == nil {
+						found = slices.Clone(chosen)
+					}
+				}
+				return
+			}
+			for i := start; i < len(drinks); i++ {
+				if price := *drinks[i].Price; price <= remaining {
+					search(i, remaining-price, append(chosen, drinks[i]))
+				}
+			}
+		}
+		search(0, cost, make([]*models.Rule, 0, n))
+
+		if found != nil {
+			return found, solutions > 1
+		}
+	}
+	return nil, false
+}
+
+// allSame reports whether every drink comes from the same rule
+func allSame(drinks []*models.Rule) bool {
+	for _, d := range drinks[1:] {
+		if d != drinks[0] {
+			return false
+		}
+	}
+	return true
+}
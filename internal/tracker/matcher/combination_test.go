@@ -0,0 +1,111 @@
+package matcher
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+func TestFewestDrinks(t *testing.T) {
+	prices := func(prices ...int) []*models.Rule {
+		drinks := make([]*models.Rule, 0, len(prices))
+		for _, p := range prices {
+			drinks = append(drinks, &models.Rule{Price: intPtr(p)})
+		}
+		return drinks
+	}
+	charlie := prices(680, 700, 580)
+	chia := prices(550, 540, 500, 590)
+
+	tests := []struct {
+		name      string
+		drinks    []*models.Rule
+		cost      int
+		want      []int
+		ambiguous bool
+	}{
+		{"two of a kind", charlie, 1360, []int{680, 680}, false},
+		{"a mix", charlie, 1260, []int{680, 580}, false},
+		{"three of a kind", charlie, 2040, []int{680, 680, 680}, false},
+		{"four drinks", charlie, 2720, []int{680, 680, 680, 680}, false},
+		{"more than four drinks", charlie, 3400, nil, false},
+		{"a single drink", charlie, 680, nil, false},
+		{"no sum", charlie, 1000, nil, false},
+		{"two mixes", chia, 1090, []int{550, 540}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drinks, ambiguous := fewestDrinks(tt.drinks, tt.cost)
+			var got []int
+			for _, d := range drinks {
+				got = append(got, *d.Price)
+			}
+			if !slices.Equal(got, tt.want) || ambiguous != tt.ambiguous {
+				t.Fatalf("got %v ambiguous %v, want %v ambiguous %v", got, ambiguous, tt.want, tt.ambiguous)
+			}
+		})
+	}
+}
+
+func TestMatchCombination(t *testing.T) {
+	flatWhite := cafe("Charlie Bit Me Cafe", 680, 160)
+	flatWhite.Drink = "Flat white"
+	piccolo := cafe("Charlie Bit Me Cafe", 580, 80)
+	piccolo.Drink = "Piccolo"
+	m, err := New([]models.Rule{
+		flatWhite,
+		cafe("Charlie Bit Me Cafe", 700, 160),
+		piccolo,
+		cafe("Chia Chia", 550, 160),
+		cafe("Chia Chia", 540, 160),
+		cafe("Chia Chia", 500, 80),
+		cafe("Chia Chia", 590, 240),
+	})
+	if err != nil {
+		t.Fatalf("failed to compile rules: %v", err)
+	}
+
+	type drink struct {
+		description string
+		amount      int
+		cost        int
+	}
+	tests := []struct {
+		name        string
+		description string
+		cost        int
+		want        []drink
+		confidence  float64
+		flagged     bool
+	}{
+		{"a single drink", "Charlie Bit Me Cafe", 700, []drink{{"Charlie Bit Me Cafe", 160, 700}}, 1, false},
+		{"two flat whites", "Charlie Bit Me Cafe", 1360, []drink{{"Flat white", 160, 680}, {"Flat white", 160, 680}}, multipleConfidence, false},
+		{"a flat white and a piccolo", "Charlie Bit Me Cafe", 1260, []drink{{"Flat white", 160, 680}, {"Piccolo", 80, 580}}, combinationConfidence, false},
+		{"two mixes add up", "Chia Chia Pty Ltd", 1090, []drink{{"Chia Chia Pty Ltd", 160, 550}, {"Chia Chia Pty Ltd", 160, 540}}, ambiguousConfidence, true},
+		{"no mix adds up", "Charlie Bit Me Cafe", 1000, nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, result := m.Match(purchase(tt.description, "", cafes, -tt.cost))
+			if tt.want == nil {
+				if result != Unmatched {
+					t.Fatalf("got result %d, want Unmatched", result)
+				}
+				return
+			}
+			if result != Matched || len(events) != len(tt.want) {
+				t.Fatalf("got result %d with %d events, want %d events", result, len(events), len(tt.want))
+			}
+			for i, e := range events {
+				got := drink{e.Description, e.Amount, e.Cost}
+				if got != tt.want[i] || e.SourceItem != i {
+					t.Fatalf("got item %d %+v, want item %d %+v", e.SourceItem, got, i, tt.want[i])
+				}
+				if e.Confidence != tt.confidence || e.Flagged != tt.flagged {
+					t.Fatalf("got confidence %v flagged %v, want %v flagged %v", e.Confidence, e.Flagged, tt.confidence, tt.flagged)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+// Package matcher turns transactions into caffeine events using configurable rules
+package matcher
+
+import (
+	"math"
+	"regexp"
+	"slices"
+
+	"github.com/baely/txn/internal/balance"
+	"github.com/baely/txn/internal/common/errors"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+// Match confidences
+const (
+	// FlagThreshold is the confidence below which caffeine events are flagged for review
+	FlagThreshold = 0.8
+
+	surchargeConfidence    = 0.95 // Price is within the rule's card surcharge
+	toleranceConfidenceMax = 0.9  // Price is just outside the rule's price
+	toleranceConfidenceMin = 0.6  // Price is at the edge of the rule's tolerance
+)
+
+// Result is the outcome of matching a transaction
+type Result int
+
+const (
+	Unmatched Result = iota // No rule matched
+	Matched                 // A caffeine rule matched
+	Ignored                 // A not_caffeine rule matched
+)
+
+// Matcher evaluates rules against transactions
+type Matcher struct {
+	rules []compiledRule
+}
+
+// compiledRule is a rule with its patterns compiled
+type compiledRule struct {
+	rule     models.Rule
+	merchant func(description string) float64
+	rawText  *regexp.Regexp
+}
+
+// New compiles the enabled rules into a Matcher
+func New(rules []models.Rule) (*Matcher, error) {
+	m := &Matcher{}
+	for _, rule := range rules {
+		if rule.Disabled {
+			continue
+		}
+		compiled, err := compile(rule)
+		if err != nil {
+			return nil, err
+		}
+		m.rules = append(m.rules, compiled)
+	}
+
+	slices.SortStableFunc(m.rules, func(a, b compiledRule) int {
+		if a.rule.Priority != b.rule.Priority {
+			return a.rule.Priority - b.rule.Priority
+		}
+		return int(a.rule.ID - b.rule.ID)
+	})
+	return m, nil
+}
+
+// Validate reports whether a rule is well formed
+func Validate(rule models.Rule) error {
+	if rule.NotCaffeine && rule.Caffeine != 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "not_caffeine rules cannot set caffeine")
+	}
+	if !rule.NotCaffeine && rule.Caffeine <= 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "caffeine must be positive")
+	}
+	if rule.Price != nil && (rule.MinPrice != nil || rule.MaxPrice != nil) {
+		return errors.Wrap(errors.ErrInvalidInput, "set either price or a price range, not both")
+	}
+	if rule.MinPrice != nil && rule.MaxPrice != nil && *rule.MinPrice > *rule.MaxPrice {
+		return errors.Wrap(errors.ErrInvalidInput, "min_price is greater than max_price")
+	}
+	if rule.Tolerance < 0 || rule.Surcharge < 0 {
+		return errors.Wrap(errors.ErrInvalidInput, "tolerance and surcharge cannot be negative")
+	}
+	if rule.Merchant == "" && rule.Category == "" && rule.RawText == "" {
+		return errors.Wrap(errors.ErrInvalidInput, "rule must match on merchant, category or raw_text")
+	}
+	_, err := compile(rule)
+	return err
+}
+
+// compile prepares a rule's patterns
+func compile(rule models.Rule) (compiledRule, error) {
+	c := compiledRule{rule: rule}
+
+	if rule.Merchant != "" {
+		switch rule.MerchantMatch {
+		case models.MatchExact, "":
+			want := Normalize(rule.Merchant)
+			c.merchant = func(description string) float64 {
+				if Normalize(description) == want {
+					return 1
+				}
+				return 0
+			}
+		case models.MatchRegex:
+			re, err := regexp.Compile("(?i)" + rule.Merchant)
+			if err != nil {
+				return c, errors.Wrap(errors.ErrInvalidInput, "invalid merchant pattern %q", rule.Merchant)
+			}
+			c.merchant = func(description string) float64 {
+				if re.MatchString(description) {
+					return 1
+				}
+				return 0
+			}
+		case models.MatchFuzzy:
+			want := Normalize(rule.Merchant)
+			c.merchant = func(description string) float64 {
+				return Similarity(want, Normalize(description))
+			}
+		default:
+			return c, errors.Wrap(errors.ErrInvalidInput, "unknown merchant_match %q", rule.MerchantMatch)
+		}
+	}
+
+	if rule.RawText != "" {
+		re, err := regexp.Compile("(?i)" + rule.RawText)
+		if err != nil {
+			return c, errors.Wrap(errors.ErrInvalidInput, "invalid raw_text pattern %q", rule.RawText)
+		}
+		c.rawText = re
+	}
+
+	return c, nil
+}
+
+// Match returns the caffeine events for a transaction. Usually that is one event
+// from the rule the transaction matches most confidently, with ties going to
+// the lowest priority. When no rule matches confidently, the price is also
+// tried as several drinks from one merchant, giving one event per drink.
+// If the best rule is a not_caffeine rule the result is Ignored and there are no events.
+// Refunds are matched like the purchase they reverse, and uncategorised refunds
+// ignore the rule's category since Up often leaves them uncategorised.
+func (m *Matcher) Match(event balance.TransactionEvent) ([]models.CaffeineEvent, Result) {
+	t := newTransaction(event)
+
+	var best *models.Rule
+	bestConfidence := 0.0
+	for i := range m.rules {
+		c := &m.rules[i]
+		if !c.applies(t) {
+			continue
+		}
+		confidence := priceConfidence(c.rule, t.cost) * c.merchantConfidence(t)
+		if confidence > bestConfidence {
+			best = &c.rule
+			bestConfidence = confidence
+		}
+	}
+
+	if bestConfidence < FlagThreshold {
+		if drinks, confidence := m.matchCombination(t); confidence > bestConfidence {
+			return t.events(drinks, confidence), Matched
+		}
+	}
+
+	if best == nil {
+		return nil, Unmatched
+	}
+	if best.NotCaffeine {
+		return nil, Ignored
+	}
+	return t.events([]*models.Rule{best}, bestConfidence), Matched
+}
+
+// transaction holds the fields of an event that rules match on
+type transaction struct {
+	id          string
+	description string
+	rawText     string
+	category    string
+	cost        int // Cents, always positive
+	refund      bool
+	event       balance.TransactionEvent
+}
+
+func newTransaction(event balance.TransactionEvent) transaction {
+	attributes := event.Transaction.Attributes
+	t := transaction{
+		id:          event.Transaction.Id,
+		description: attributes.Description,
+		category:    balance.Uncategorised,
+		cost:        attributes.Amount.ValueInBaseUnits,
+		refund:      attributes.Amount.ValueInBaseUnits > 0,
+		event:       event,
+	}
+	if t.cost < 0 {
+		t.cost = -t.cost
+	}
+	if event.Transaction.Relationships.Category.Data != nil {
+		t.category = event.Transaction.Relationships.Category.Data.Id
+	}
+	if attributes.RawText != nil {
+		t.rawText = *attributes.RawText
+	}
+	return t
+}
+
+// events builds one caffeine event per drink. A single drink costs the whole
+// transaction, and each of several drinks costs its rule's price.
+func (t transaction) events(drinks []*models.Rule, confidence float64) []models.CaffeineEvent {
+	events := make([]models.CaffeineEvent, 0, len(drinks))
+	for i, rule := range drinks {
+		description := rule.Drink
+		if description == "" {
+			description = t.description
+		}
+		cost := t.cost
+		if len(drinks) > 1 {
+			cost = *rule.Price
+		}
+		events = append(events, models.CaffeineEvent{
+			Timestamp:           t.event.Transaction.Attributes.CreatedAt,
+			Description:         description,
+			Amount:              rule.Caffeine,
+			Cost:                cost,
+			SourceTransactionID: t.id,
+			SourceItem:          i,
+			Confidence:          roundConfidence(confidence),
+			Flagged:             confidence < FlagThreshold,
+		})
+	}
+	return events
+}
+
+// applies reports whether a rule's category and raw text fit a transaction
+func (c *compiledRule) applies(t transaction) bool {
+	rule := c.rule
+	if rule.Category != "" && rule.Category != t.category && !(t.refund && t.category == balance.Uncategorised) {
+		return false
+	}
+	if c.rawText != nil && !c.rawText.MatchString(t.rawText) {
+		return false
+	}
+	return true
+}
+
+// merchantConfidence scores the transaction description against the rule's merchant
+func (c *compiledRule) merchantConfidence(t transaction) float64 {
+	if c.merchant == nil {
+		return 1
+	}
+	return c.merchant(t.description)
+}
+
+// priceConfidence scores how well cost fits a rule's price. Prices inside the
+// range score 1, within the card surcharge slightly less, and within the
+// tolerance less again the further they are from the range.
+func priceConfidence(rule models.Rule, cost int) float64 {
+	lo, hi := math.Inf(-1), math.Inf(1)
+	switch {
+	case rule.Price != nil:
+		lo, hi = float64(*rule.Price), float64(*rule.Price)
+	default:
+		if rule.MinPrice != nil {
+			lo = float64(*rule.MinPrice)
+		}
+		if rule.MaxPrice != nil {
+			hi = float64(*rule.MaxPrice)
+		}
+	}
+
+	c := float64(cost)
+	if c >= lo && c <= hi {
+		return 1
+	}
+
+	surcharged := math.Round(hi * (1 + rule.Surcharge/100))
+	if c > hi && c <= surcharged {
+		return surchargeConfidence
+	}
+
+	if rule.Tolerance == 0 {
+		return 0
+	}
+	distance := lo - c
+	if c > hi {
+		distance = c - surcharged
+	}
+	if distance > float64(rule.Tolerance) {
+		return 0
+	}
+	return toleranceConfidenceMax - (toleranceConfidenceMax-toleranceConfidenceMin)*distance/float64(rule.Tolerance)
+}
+
+// roundConfidence keeps confidences to two decimal places
+func roundConfidence(c float64) float64 {
+	return math.Round(c*100) / 100
+}
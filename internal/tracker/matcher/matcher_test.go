@@ -0,0 +1,242 @@
+package matcher
+
+import (
+	"math"
+	"testing"
+
+	"github.com/baely/txn/internal/balance"
+	"github.com/baely/txn/internal/balance/uptest"
+	"github.com/baely/txn/internal/common/errors"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+const cafes = "restaurants-and-cafes"
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func cafe(merchant string, price, caffeine int) models.Rule {
+	return models.Rule{
+		Priority: 100,
+		Merchant: merchant,
+		Category: cafes,
+		Price:    intPtr(price),
+		Caffeine: caffeine,
+	}
+}
+
+// purchase builds a transaction event. Amounts are in cents, negative for
+// purchases and positive for refunds.
+func purchase(description, rawText, category string, amount int) balance.TransactionEvent {
+	return balance.TransactionEvent{
+		Type: balance.EventTypeCreated,
+		Transaction: uptest.NewTransaction(uptest.Transaction{
+			ID:          "tx-1",
+			AccountID:   "acc-1",
+			Description: description,
+			RawText:     rawText,
+			Amount:      amount,
+			Category:    category,
+		}),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(r *models.Rule)
+		valid  bool
+	}{
+		{"cafe rule", func(r *models.Rule) {}, true},
+		{"regex merchant", func(r *models.Rule) { r.MerchantMatch, r.Merchant = models.MatchRegex, `^sq \*corner` }, true},
+		{"price range", func(r *models.Rule) { r.Price, r.MinPrice, r.MaxPrice = nil, intPtr(200), intPtr(700) }, true},
+		{"not caffeine", func(r *models.Rule) { r.NotCaffeine, r.Caffeine = true, 0 }, true},
+		{"not caffeine with caffeine", func(r *models.Rule) { r.NotCaffeine = true }, false},
+		{"no caffeine", func(r *models.Rule) { r.Caffeine = 0 }, false},
+		{"price and range", func(r *models.Rule) { r.MinPrice = intPtr(500) }, false},
+		{"inverted range", func(r *models.Rule) { r.Price, r.MinPrice, r.MaxPrice = nil, intPtr(700), intPtr(200) }, false},
+		{"negative tolerance", func(r *models.Rule) { r.Tolerance = -1 }, false},
+		{"negative surcharge", func(r *models.Rule) { r.Surcharge = -1 }, false},
+		{"matches everything", func(r *models.Rule) { r.Merchant, r.Category = "", "" }, false},
+		{"bad merchant pattern", func(r *models.Rule) { r.MerchantMatch, r.Merchant = models.MatchRegex, "(" }, false},
+		{"bad raw text pattern", func(r *models.Rule) { r.RawText = "[" }, false},
+		{"unknown merchant match", func(r *models.Rule) { r.MerchantMatch = "sounds-like" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := cafe("Charlie Bit Me Cafe", 680, 160)
+			tt.change(&rule)
+			err := Validate(rule)
+			if tt.valid && err != nil {
+				t.Fatalf("got %v, want the rule to be valid", err)
+			}
+			if !tt.valid && !errors.Is(err, errors.ErrInvalidInput) {
+				t.Fatalf("got %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidPattern(t *testing.T) {
+	rule := cafe("(", 680, 160)
+	rule.MerchantMatch = models.MatchRegex
+	if _, err := New([]models.Rule{rule}); !errors.Is(err, errors.ErrInvalidInput) {
+		t.Fatalf("got %v, want ErrInvalidInput", err)
+	}
+
+	// Disabled rules are not compiled
+	rule.Disabled = true
+	if _, err := New([]models.Rule{rule}); err != nil {
+		t.Fatalf("got %v compiling a disabled rule", err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	espresso := cafe(`^sq \*corner`, 450, 80)
+	espresso.MerchantMatch, espresso.Drink = models.MatchRegex, "Espresso"
+	lunch := cafe("Charlie Bit Me Cafe", 1200, 0)
+	lunch.NotCaffeine = true
+	piccolo := cafe("Georgie Boy Espresso", 550, 80)
+	piccolo.Priority, piccolo.Drink = 1, "Piccolo"
+	disabled := cafe("In a Rush", 560, 160)
+	disabled.Disabled = true
+
+	m, err := New([]models.Rule{
+		cafe("Charlie Bit Me Cafe", 680, 160),
+		cafe("Georgie Boy Espresso", 550, 160),
+		piccolo,
+		espresso,
+		lunch,
+		disabled,
+		{
+			Category: "groceries",
+			RawText:  "WOOLWORTHS.*DOCK",
+			MinPrice: intPtr(200),
+			MaxPrice: intPtr(700),
+			Drink:    "Dare NAS Intense Espresso",
+			Caffeine: 260,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to compile rules: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		event       balance.TransactionEvent
+		result      Result
+		description string
+		amount      int
+		cost        int
+	}{
+		{"exact merchant and price", purchase("Charlie Bit Me Cafe", "", cafes, -680), Matched, "Charlie Bit Me Cafe", 160, 680},
+		{"wrong price", purchase("Charlie Bit Me Cafe", "", cafes, -690), Unmatched, "", 0, 0},
+		{"wrong category", purchase("Charlie Bit Me Cafe", "", "groceries", -680), Unmatched, "", 0, 0},
+		{"regex merchant", purchase("SQ *Corner Espresso", "", cafes, -450), Matched, "Espresso", 80, 450},
+		{"raw text and price range", purchase("Woolworths", "WOOLWORTHS 3008 DOCKLANDS", "groceries", -500), Matched, "Dare NAS Intense Espresso", 260, 500},
+		{"raw text mismatch", purchase("Woolworths", "WOOLWORTHS 3000 MELBOURNE", "groceries", -500), Unmatched, "", 0, 0},
+		{"lowest priority wins a tie", purchase("Georgie Boy Espresso", "", cafes, -550), Matched, "Piccolo", 80, 550},
+		{"not caffeine", purchase("Charlie Bit Me Cafe", "", cafes, -1200), Ignored, "", 0, 0},
+		{"disabled rule", purchase("In a Rush", "", cafes, -560), Unmatched, "", 0, 0},
+		{"uncategorised refund", purchase("Charlie Bit Me Cafe", "", "", 680), Matched, "Charlie Bit Me Cafe", 160, 680},
+		{"uncategorised purchase", purchase("Charlie Bit Me Cafe", "", "", -680), Unmatched, "", 0, 0},
+		{"unknown merchant", purchase("The Other Brother", "", cafes, -600), Unmatched, "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, result := m.Match(tt.event)
+			if result != tt.result {
+				t.Fatalf("got result %d, want %d", result, tt.result)
+			}
+			if tt.result != Matched {
+				if len(events) != 0 {
+					t.Fatalf("got %d events, want none", len(events))
+				}
+				return
+			}
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+			e := events[0]
+			if e.Description != tt.description || e.Amount != tt.amount || e.Cost != tt.cost {
+				t.Fatalf("got %q %dmg for %d, want %q %dmg for %d", e.Description, e.Amount, e.Cost, tt.description, tt.amount, tt.cost)
+			}
+			if e.SourceTransactionID != "tx-1" || e.Confidence != 1 || e.Flagged {
+				t.Fatalf("got %+v, want a confident event for tx-1", e)
+			}
+		})
+	}
+}
+
+func TestPriceConfidence(t *testing.T) {
+	price := func(price int, surcharge float64, tolerance int) models.Rule {
+		return models.Rule{Price: intPtr(price), Surcharge: surcharge, Tolerance: tolerance}
+	}
+	between := models.Rule{MinPrice: intPtr(200), MaxPrice: intPtr(700)}
+
+	tests := []struct {
+		name string
+		rule models.Rule
+		cost int
+		want float64
+	}{
+		{"exact price", price(550, 0, 0), 550, 1},
+		{"off by a cent", price(550, 0, 0), 551, 0},
+		{"top of the surcharge", price(550, 2, 0), 561, surchargeConfidence},
+		{"past the surcharge", price(550, 2, 0), 562, 0},
+		{"surcharge rounds", price(680, 1.5, 0), 690, surchargeConfidence},
+		{"surcharge rounds down", price(680, 1.5, 0), 691, 0},
+		{"halfway past the surcharge", price(550, 2, 20), 571, 0.75},
+		{"edge of the tolerance above", price(550, 2, 20), 581, toleranceConfidenceMin},
+		{"past the tolerance above", price(550, 2, 20), 582, 0},
+		{"just under the price", price(550, 0, 20), 549, 0.885},
+		{"edge of the tolerance below", price(550, 0, 20), 530, toleranceConfidenceMin},
+		{"past the tolerance below", price(550, 0, 20), 529, 0},
+		{"bottom of a range", between, 200, 1},
+		{"top of a range", between, 700, 1},
+		{"under a range", between, 199, 0},
+		{"over a range", between, 701, 0},
+		{"open range", models.Rule{MinPrice: intPtr(500)}, 10000, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := priceConfidence(tt.rule, tt.cost); math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchConfidence(t *testing.T) {
+	fuzzy := cafe("Chia Chia", 550, 160)
+	fuzzy.MerchantMatch, fuzzy.Surcharge = models.MatchFuzzy, 2
+	m, err := New([]models.Rule{fuzzy})
+	if err != nil {
+		t.Fatalf("failed to compile rules: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		description string
+		cost        int
+		confidence  float64
+		flagged     bool
+	}{
+		{"company suffix", "Chia Chia Pty Ltd", 550, 1, false},
+		{"payment prefix and surcharge", "SQ *CHIA CHIA", 561, 0.95, false},
+		{"misspelt", "Chia Chai", 550, 0.68, true},
+		{"misspelt with surcharge", "Chia Chai Pty Ltd", 561, 0.64, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, result := m.Match(purchase(tt.description, "", cafes, -tt.cost))
+			if result != Matched || len(events) != 1 {
+				t.Fatalf("got result %d with %d events, want one match", result, len(events))
+			}
+			if e := events[0]; e.Confidence != tt.confidence || e.Flagged != tt.flagged || e.Cost != tt.cost {
+				t.Fatalf("got confidence %v flagged %v for %d, want %v flagged %v", e.Confidence, e.Flagged, e.Cost, tt.confidence, tt.flagged)
+			}
+		})
+	}
+}
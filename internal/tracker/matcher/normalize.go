@@ -0,0 +1,79 @@
+package matcher
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Fuzzy merchant confidences
+const (
+	prefixSimilarity = 0.9  // One normalized name starts with the other
+	minSimilarity    = 0.75 // Edit-distance similarity below this is not a match
+)
+
+// paymentPrefixes are prepended to merchant names by card terminal providers,
+// as in "SQ *CHIA CHIA" or "ZLR*Mr Summit"
+var paymentPrefixes = []string{"sq", "sumup", "zlr", "lsp", "tst"}
+
+// businessSuffixes are company designations that come and go from descriptions
+var businessSuffixes = []string{"pty", "ltd", "limited", "co", "inc"}
+
+// Normalize reduces a merchant name to lowercase letters and digits, without
+// payment provider prefixes or company suffixes, so "SQ *Chia Chia Pty. Ltd."
+// and "Chia Chia" compare equal
+func Normalize(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 && slices.Contains(paymentPrefixes, words[0]) {
+		words = words[1:]
+	}
+	for len(words) > 1 && slices.Contains(businessSuffixes, words[len(words)-1]) {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, "")
+}
+
+// Similarity scores two normalized merchant names from 0 to 1. Equal names
+// score 1, names where one is a prefix of the other score slightly less, and
+// otherwise names score by edit distance until they are too different to match.
+func Similarity(a, b string) float64 {
+	switch {
+	case a == "" || b == "":
+		return 0
+	case a == b:
+		return 1
+	case strings.HasPrefix(a, b) || strings.HasPrefix(b, a):
+		return prefixSimilarity
+	}
+
+	ra, rb := []rune(a), []rune(b)
+	similarity := 1 - float64(levenshtein(ra, rb))/float64(max(len(ra), len(rb)))
+	if similarity < minSimilarity {
+		return 0
+	}
+	// Never score a near miss as highly as a prefix
+	return min(similarity, prefixSimilarity) * prefixSimilarity
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,48 @@
+package matcher
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Chia Chia", "chiachia"},
+		{"Chia Chia Pty Ltd", "chiachia"},
+		{"SQ *Chia Chia Pty. Ltd.", "chiachia"},
+		{"ZLR*Mr Summit", "mrsummit"},
+		{"The Other Brother", "theotherbrother"},
+		{"SumUp", "sumup"}, // A lone prefix is the name
+		{"Co.", "co"},      // As is a lone suffix
+		{"Café 21", "café21"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"chiachia", "chiachia", 1},
+		{"", "chiachia", 0},
+		{"charliebitme", "charliebitmecafe", prefixSimilarity},
+		{"chiachia", "chiachai", 0.75 * prefixSimilarity},                                // Two edits in eight
+		{"georgieboyespresso", "georgeboyespresso", prefixSimilarity * prefixSimilarity}, // Capped below a prefix
+		{"mrsummit", "inarush", 0},
+	}
+	for _, tt := range tests {
+		if got := Similarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := Similarity(tt.b, tt.a); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Similarity(%q, %q) = %v, want it symmetric", tt.b, tt.a, got)
+		}
+	}
+}
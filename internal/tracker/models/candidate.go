@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// CandidateStatus is where a candidate is in review
+type CandidateStatus string
+
+const (
+	CandidatePending     CandidateStatus = "pending"
+	CandidateDrink       CandidateStatus = "drink"
+	CandidateNotCaffeine CandidateStatus = "not_caffeine"
+)
+
+// Candidate is a café purchase no rule matched, kept for review
+type Candidate struct {
+	ID                  int64           `json:"id"`
+	SourceTransactionID string          `json:"source_transaction_id"`
+	Merchant            string          `json:"merchant"`
+	RawText             string          `json:"raw_text,omitempty"`
+	Category            string          `json:"category"`
+	Cost                int             `json:"cost"` // Cents
+	Timestamp           time.Time       `json:"timestamp"`
+	Status              CandidateStatus `json:"status"`
+	Drink               string          `json:"drink,omitempty"`
+	Caffeine            int             `json:"caffeine,omitempty"`
+	RuleID              *int64          `json:"rule_id,omitempty"` // Rule created when the candidate was classified
+	CreatedAt           time.Time       `json:"created_at"`
+	ReviewedAt          *time.Time      `json:"reviewed_at,omitempty"`
+}
+
+// Classification is a review decision for a candidate
+type Classification struct {
+	NotCaffeine bool   `json:"not_caffeine"`
+	Drink       string `json:"drink,omitempty"`    // Recorded description; the merchant if empty
+	Caffeine    int    `json:"caffeine,omitempty"` // Caffeine in mg, required unless not_caffeine
+	CreateRule  bool   `json:"create_rule"`        // Add a rule for the merchant and price
+}
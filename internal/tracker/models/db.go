@@ -3,24 +3,59 @@ package models
 import "time"
 
 type CaffeineEvent struct {
-	Timestamp   time.Time `json:"timestamp"`
-	Description string    `json:"description"`
-	Amount      int       `json:"amount"`
-	Cost        int       `json:"cost"`
+	ID                  int64     `json:"id"`
+	Timestamp           time.Time `json:"timestamp"`
+	Description         string    `json:"description"`
+	Amount              int       `json:"amount"`
+	Cost                int       `json:"cost"`
+	SourceTransactionID string    `json:"source_transaction_id,omitempty"`
+	SourceItem          int       `json:"source_item,omitempty"`      // Which drink of a multi-drink transaction
+	Confidence          float64   `json:"confidence"`                 // How well the transaction matched its rule, 1 for manual events
+	Flagged             bool      `json:"flagged,omitempty"`          // Matched with low confidence and worth reviewing
+	ForSomeoneElse      bool      `json:"for_someone_else,omitempty"` // Bought for someone else, so not part of intake
+	Edited              bool      `json:"edited,omitempty"`           // Changed by hand, so reprocessing leaves it alone
+	ReversedBy          string    `json:"reversed_by,omitempty"`      // Refund transaction that reversed the purchase, which then no longer counts
+	ReversedByItem      int       `json:"-"`                          // Which drink of the refund reversed it
+	Deleted             bool      `json:"deleted,omitempty"`          // Deleted by hand, kept so reprocessing does not add it back
 }
 
 type CaffeineRow struct {
-	Timestamp   int     `json:"timestamp"`
-	Description string  `json:"description"`
-	Amount      float64 `json:"amount"`
-	Cost        int     `json:"cost"`
+	ID                  int64   `json:"id"`
+	Timestamp           int     `json:"timestamp"`
+	Description         string  `json:"description"`
+	Amount              float64 `json:"amount"`
+	Cost                int     `json:"cost"`
+	SourceTransactionID *string `json:"source_transaction_id"`
+	SourceItem          int     `json:"source_item"`
+	Confidence          float64 `json:"confidence"`
+	Flagged             bool    `json:"flagged"`
+	ForSomeoneElse      bool    `json:"for_someone_else"`
+	Edited              bool    `json:"edited"`
+	ReversedBy          *string `json:"reversed_by"`
+	ReversedByItem      int     `json:"reversed_by_item"`
+	Deleted             bool    `json:"deleted"`
 }
 
 func ToEvent(row CaffeineRow) CaffeineEvent {
-	return CaffeineEvent{
-		Timestamp:   time.Unix(int64(row.Timestamp), 0),
-		Description: row.Description,
-		Amount:      int(row.Amount),
-		Cost:        row.Cost,
+	event := CaffeineEvent{
+		ID:             row.ID,
+		Timestamp:      time.Unix(int64(row.Timestamp), 0),
+		Description:    row.Description,
+		Amount:         int(row.Amount),
+		Cost:           row.Cost,
+		SourceItem:     row.SourceItem,
+		Confidence:     row.Confidence,
+		Flagged:        row.Flagged,
+		ForSomeoneElse: row.ForSomeoneElse,
+		Edited:         row.Edited,
+		ReversedByItem: row.ReversedByItem,
+		Deleted:        row.Deleted,
 	}
+	if row.SourceTransactionID != nil {
+		event.SourceTransactionID = *row.SourceTransactionID
+	}
+	if row.ReversedBy != nil {
+		event.ReversedBy = *row.ReversedBy
+	}
+	return event
 }
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Preset is a drink that can be logged in one step
+type Preset struct {
+	ID          int64     `json:"id"`
+	Slug        string    `json:"slug"` // Used in quick-log URLs
+	Description string    `json:"description"`
+	Amount      int       `json:"amount"` // Caffeine in mg
+	Cost        int       `json:"cost"`   // Cents
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
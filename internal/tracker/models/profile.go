@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Profile holds the personal details caffeine levels and limits are worked
+// out from. Unset fields fall back to values for a typical adult.
+type Profile struct {
+	HalfLife   *float64 `json:"half_life,omitempty"`   // Hours, overrides the half-life derived from the fields below
+	Weight     *float64 `json:"weight,omitempty"`      // kg
+	DailyLimit *int     `json:"daily_limit,omitempty"` // Caffeine in mg, derived from weight when unset
+	Bedtime    string   `json:"bedtime"`               // HH:MM, local time
+
+	// Half-life factors
+	Smoker             bool `json:"smoker"`
+	OralContraceptives bool `json:"oral_contraceptives"`
+	Pregnant           bool `json:"pregnant"`
+
+	UpdatedAt time.Time `json:"updated_at"` // Zero until the profile is first saved
+}
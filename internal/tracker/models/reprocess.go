@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// ChangeAction is what reprocessing does to a caffeine event
+type ChangeAction string
+
+const (
+	ChangeAdd    ChangeAction = "add"
+	ChangeUpdate ChangeAction = "change"
+	ChangeRemove ChangeAction = "remove"
+)
+
+// EventChange is a difference between the recorded caffeine events and those
+// the current rules produce for the same transaction
+type EventChange struct {
+	Action              ChangeAction   `json:"action"`
+	SourceTransactionID string         `json:"source_transaction_id"`
+	SourceItem          int            `json:"source_item,omitempty"`
+	Before              *CaffeineEvent `json:"before,omitempty"`
+	After               *CaffeineEvent `json:"after,omitempty"`
+}
+
+// Time returns when the event the change refers to happened
+func (c EventChange) Time() time.Time {
+	if c.After != nil {
+		return c.After.Timestamp
+	}
+	return c.Before.Timestamp
+}
+
+// ReprocessResult summarises a reprocessing run
+type ReprocessResult struct {
+	Since        time.Time     `json:"since,omitempty"`
+	Until        time.Time     `json:"until,omitempty"`
+	DryRun       bool          `json:"dry_run"`
+	Transactions int           `json:"transactions"`
+	Added        int           `json:"added"`
+	Changed      int           `json:"changed"`
+	Removed      int           `json:"removed"`
+	Unchanged    int           `json:"unchanged"`
+	Changes      []EventChange `json:"changes"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// MatchType is how a rule's merchant is compared with a transaction description
+type MatchType string
+
+const (
+	MatchExact MatchType = "exact" // Equal once both names are normalized
+	MatchRegex MatchType = "regex" // Case-insensitive regular expression
+	MatchFuzzy MatchType = "fuzzy" // Normalized names that share a prefix or are similar
+)
+
+// Rule maps matching transactions to a caffeinated drink.
+// Empty match fields match every transaction.
+type Rule struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name,omitempty"`
+	Priority      int       `json:"priority"` // Breaks ties between equally confident matches, lowest first
+	Disabled      bool      `json:"disabled,omitempty"`
+	MerchantMatch MatchType `json:"merchant_match,omitempty"`
+	Merchant      string    `json:"merchant,omitempty"`  // Compared with the transaction description
+	Category      string    `json:"category,omitempty"`  // Up category id, or uncategorised
+	RawText       string    `json:"raw_text,omitempty"`  // Case-insensitive regular expression on the raw text
+	Price         *int      `json:"price,omitempty"`     // Exact price in cents
+	MinPrice      *int      `json:"min_price,omitempty"` // Inclusive price range in cents
+	MaxPrice      *int      `json:"max_price,omitempty"`
+	Tolerance     int       `json:"tolerance,omitempty"`    // Cents either side of the price that still match, at lower confidence
+	Surcharge     float64   `json:"surcharge,omitempty"`    // Card surcharge allowed on top of the price, in percent
+	Drink         string    `json:"drink,omitempty"`        // Recorded description; the transaction description if empty
+	Caffeine      int       `json:"caffeine"`               // Caffeine in mg
+	NotCaffeine   bool      `json:"not_caffeine,omitempty"` // Matching purchases are known not to be caffeine
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
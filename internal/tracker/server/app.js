@@ -234,9 +234,12 @@ function updateDashboard() {
     const { start, end } = currentTimeRange;
     const queryParams = `?start=${toRFC3339(start)}&end=${toRFC3339(end)}`;
     const summaryQueryParams = timeEdited ? queryParams : '';
+    // Pass ?model= through so curves from different models can be compared
+    const model = new URLSearchParams(window.location.search).get('model');
+    const levelQueryParams = model ? `${queryParams}&model=${encodeURIComponent(model)}` : queryParams;
 
     Promise.all([
-        fetch('/api/levels' + queryParams),
+        fetch('/api/levels' + levelQueryParams),
         fetch('/api/events' + queryParams),
         fetch('/api/events/summary' + summaryQueryParams)
     ])
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/baely/txn/internal/common/errors"
+	commonHttp "github.com/baely/txn/internal/common/http"
+	"github.com/baely/txn/internal/tracker/matcher"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+// ListCandidates returns unmatched purchases, pending review unless status is given
+func (s *Server) ListCandidates(w http.ResponseWriter, r *http.Request) {
+	status := models.CandidatePending
+	if v := r.URL.Query().Get("status"); v != "" {
+		status = models.CandidateStatus(v)
+		switch status {
+		case models.CandidatePending, models.CandidateDrink, models.CandidateNotCaffeine:
+		default:
+			commonHttp.HandleError(w, errors.Wrap(errors.ErrInvalidInput, "invalid status %q", v))
+			return
+		}
+	}
+
+	candidates, err := s.db.ListCandidates(r.Context(), status)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, candidates)
+}
+
+// GetCandidate returns a single candidate
+func (s *Server) GetCandidate(w http.ResponseWriter, r *http.Request) {
+	id, err := candidateID(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	candidate, err := s.db.GetCandidate(r.Context(), id)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, candidate)
+}
+
+// ClassifyCandidate records a candidate as a drink, adding its caffeine event,
+// or as not caffeine. With create_rule a rule for the merchant and price is
+// added so the same purchase is matched automatically next time.
+func (s *Server) ClassifyCandidate(w http.ResponseWriter, r *http.Request) {
+	id, err := candidateID(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	var classification models.Classification
+	if err := json.NewDecoder(r.Body).Decode(&classification); err != nil {
+		commonHttp.HandleError(w, errors.Wrap(errors.ErrInvalidInput, "invalid request body"))
+		return
+	}
+	switch {
+	case classification.NotCaffeine && (classification.Drink != "" || classification.Caffeine != 0):
+		commonHttp.HandleError(w, errors.Wrap(errors.ErrInvalidInput, "not_caffeine cannot set drink or caffeine"))
+		return
+	case !classification.NotCaffeine && classification.Caffeine <= 0:
+		commonHttp.HandleError(w, errors.Wrap(errors.ErrInvalidInput, "caffeine must be positive"))
+		return
+	}
+
+	candidate, err := s.db.GetCandidate(r.Context(), id)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	status := models.CandidateNotCaffeine
+	var event *models.CaffeineEvent
+	if !classification.NotCaffeine {
+		status = models.CandidateDrink
+		description := classification.Drink
+		if description == "" {
+			description = candidate.Merchant
+		}
+		event = &models.CaffeineEvent{
+			Timestamp:           candidate.Timestamp,
+			Description:         description,
+			Amount:              classification.Caffeine,
+			Cost:                candidate.Cost,
+			SourceTransactionID: candidate.SourceTransactionID,
+			Confidence:          1,
+		}
+	}
+
+	var rule *models.Rule
+	if classification.CreateRule {
+		rule = &models.Rule{
+			Name:          "Reviewed " + candidate.Merchant,
+			Priority:      100,
+			MerchantMatch: models.MatchExact,
+			Merchant:      candidate.Merchant,
+			Category:      candidate.Category,
+			Price:         &candidate.Cost,
+			Drink:         classification.Drink,
+			Caffeine:      classification.Caffeine,
+			NotCaffeine:   classification.NotCaffeine,
+		}
+		if err := matcher.Validate(*rule); err != nil {
+			commonHttp.HandleError(w, err)
+			return
+		}
+	}
+
+	candidate, err = s.db.ResolveCandidate(r.Context(), id, status, event, rule)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	slog.Info("Classified candidate", "id", candidate.ID, "merchant", candidate.Merchant, "status", candidate.Status, "rule_id", candidate.RuleID)
+	commonHttp.Success(w, candidate)
+}
+
+// candidateID reads the candidate id from the URL
+func candidateID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(errors.ErrInvalidInput, "invalid candidate id")
+	}
+	return id, nil
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/baely/txn/internal/common/errors"
+	commonHttp "github.com/baely/txn/internal/common/http"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+// Event validation limits
+const (
+	maxEventCaffeine = 1000            // mg in a single drink
+	maxClockSkew     = 5 * time.Minute // How far in the future an event may be logged
+)
+
+// createEventRequest is the body of a request to log a drink
+type createEventRequest struct {
+	Timestamp      *time.Time `json:"timestamp"` // Now if omitted
+	Description    string     `json:"description"`
+	Amount         int        `json:"amount"` // Caffeine in mg
+	Cost           int        `json:"cost"`   // Cents
+	ForSomeoneElse bool       `json:"for_someone_else"`
+}
+
+// patchEventRequest changes the fields that are set
+type patchEventRequest struct {
+	Timestamp      *time.Time `json:"timestamp"`
+	Description    *string    `json:"description"`
+	Amount         *int       `json:"amount"`
+	Cost           *int       `json:"cost"`
+	Flagged        *bool      `json:"flagged"`
+	ForSomeoneElse *bool      `json:"for_someone_else"`
+}
+
+// GetEvent returns a single caffeine event
+func (s *Server) GetEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := eventID(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	event, err := s.db.GetEvent(r.Context(), id)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, event)
+}
+
+// CreateEvent logs a drink by hand
+func (s *Server) CreateEvent(w http.ResponseWriter, r *http.Request) {
+	var req createEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		commonHttp.HandleError(w, errors.Wrap(errors.ErrInvalidInput, "invalid request body"))
+		return
+	}
+
+	event := models.CaffeineEvent{
+		Timestamp:      time.Now(),
+		Description:    strings.TrimSpace(req.Description),
+		Amount:         req.Amount,
+		Cost:           req.Cost,
+		Confidence:     1,
+		ForSomeoneElse: req.ForSomeoneElse,
+	}
+	if req.Timestamp != nil {
+		event.Timestamp = *req.Timestamp
+	}
+	if err := validateEvent(event); err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	event, err := s.db.CreateEvent(r.Context(), event)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	slog.Info("Logged caffeine event", "id", event.ID, "description", event.Description, "amount", event.Amount)
+	commonHttp.JSON(w, http.StatusCreated, commonHttp.Response{Success: true, Data: event})
+}
+
+// PatchEvent changes an event. Events from Up transactions that are changed
+// by hand are marked edited so reprocessing does not undo the fix.
+func (s *Server) PatchEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := eventID(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	var req patchEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		commonHttp.HandleError(w, errors.Wrap(errors.ErrInvalidInput, "invalid request body"))
+		return
+	}
+
+	event, err := s.db.GetEvent(r.Context(), id)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	edited := false
+	if req.Timestamp != nil {
+		event.Timestamp, edited = *req.Timestamp, true
+	}
+	if req.Description != nil {
+		event.Description, edited = strings.TrimSpace(*req.Description), true
+	}
+	if req.Amount != nil {
+		event.Amount, edited = *req.Amount, true
+	}
+	if req.Cost != nil {
+		event.Cost, edited = *req.Cost, true
+	}
+	if req.Flagged != nil {
+		event.Flagged, edited = *req.Flagged, true
+	}
+	if req.ForSomeoneElse != nil {
+		event.ForSomeoneElse = *req.ForSomeoneElse
+	}
+	if edited && event.SourceTransactionID != "" {
+		event.Edited = true
+	}
+	if err := validateEvent(event); err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	event, err = s.db.UpdateEvent(r.Context(), event)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	slog.Info("Updated caffeine event", "id", event.ID)
+	commonHttp.Success(w, event)
+}
+
+// DeleteEvent removes an event. Events from Up transactions are kept as
+// deleted so backfills and reprocessing do not add them back.
+func (s *Server) DeleteEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := eventID(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	if err := s.db.DeleteEvent(r.Context(), id); err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	slog.Info("Deleted caffeine event", "id", id)
+	commonHttp.Success(w, map[string]string{"status": "deleted"})
+}
+
+// validateEvent checks the fields a person can set on an event
+func validateEvent(event models.CaffeineEvent) error {
+	switch {
+	case event.Description == "":
+		return errors.Wrap(errors.ErrInvalidInput, "description is required")
+	case event.Amount <= 0 || event.Amount > maxEventCaffeine:
+		return errors.Wrap(errors.ErrInvalidInput, "amount must be between 1 and %d mg", maxEventCaffeine)
+	case event.Cost < 0:
+		return errors.Wrap(errors.ErrInvalidInput, "cost cannot be negative")
+	case event.Timestamp.IsZero():
+		return errors.Wrap(errors.ErrInvalidInput, "timestamp is required")
+	case event.Timestamp.After(time.Now().Add(maxClockSkew)):
+		return errors.Wrap(errors.ErrInvalidInput, "timestamp is in the future")
+	}
+	return nil
+}
+
+// eventID reads the event id from the URL
+func eventID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(errors.ErrInvalidInput, "invalid event id")
+	}
+	return id, nil
+}
+
+// eventRecipientRequest is the body of a request to mark who a drink was for
+type eventRecipientRequest struct {
+	ForSomeoneElse bool `json:"for_someone_else"`
+}
+
+// PatchEventRecipient marks whether a drink from a transaction was bought for
+// someone else. Those drinks stay in the event list but not in intake or levels.
+func (s *Server) PatchEventRecipient(w http.ResponseWriter, r *http.Request) {
+	transactionID := chi.URLParam(r, "transactionID")
+	item, err := strconv.Atoi(chi.URLParam(r, "item"))
+	if err != nil || item < 0 {
+		commonHttp.HandleError(w, errors.Wrap(errors.ErrInvalidInput, "invalid item"))
+		return
+	}
+
+	var req eventRecipientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		commonHttp.HandleError(w, errors.Wrap(errors.ErrInvalidInput, "invalid request body"))
+		return
+	}
+
+	if err := s.db.SetForSomeoneElse(r.Context(), transactionID, item, req.ForSomeoneElse); err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	slog.Info("Updated caffeine event recipient", "transaction_id", transactionID, "item", item, "for_someone_else", req.ForSomeoneElse)
+	commonHttp.Success(w, map[string]any{
+		"source_transaction_id": transactionID,
+		"source_item":           item,
+		"for_someone_else":      req.ForSomeoneElse,
+	})
+}
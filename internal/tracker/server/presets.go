@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/baely/txn/internal/common/errors"
+	commonHttp "github.com/baely/txn/internal/common/http"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+// slugPattern is lowercase words joined by hyphens
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// quickLogResponse is the result of logging a preset
+type quickLogResponse struct {
+	Event   models.CaffeineEvent `json:"event"`
+	Level   *float64             `json:"level,omitempty"`    // Caffeine in mg once the drink peaks, if it could be worked out
+	LevelAt *time.Time           `json:"level_at,omitempty"` // When the drink peaks: straight away under the exponential model, later once absorbed
+}
+
+// ListPresets returns every preset
+func (s *Server) ListPresets(w http.ResponseWriter, r *http.Request) {
+	presets, err := s.db.ListPresets(r.Context())
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, presets)
+}
+
+// GetPreset returns a single preset
+func (s *Server) GetPreset(w http.ResponseWriter, r *http.Request) {
+	preset, err := s.db.GetPreset(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, preset)
+}
+
+// CreatePreset adds a preset
+func (s *Server) CreatePreset(w http.ResponseWriter, r *http.Request) {
+	preset, err := decodePreset(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	preset, err = s.db.CreatePreset(r.Context(), preset)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	slog.Info("Created preset", "slug", preset.Slug)
+	commonHttp.JSON(w, http.StatusCreated, commonHttp.Response{Success: true, Data: preset})
+}
+
+// UpdatePreset replaces a preset
+func (s *Server) UpdatePreset(w http.ResponseWriter, r *http.Request) {
+	preset, err := decodePreset(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	preset, err = s.db.UpdatePreset(r.Context(), chi.URLParam(r, "slug"), preset)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	slog.Info("Updated preset", "slug", preset.Slug)
+	commonHttp.Success(w, preset)
+}
+
+// DeletePreset removes a preset
+func (s *Server) DeletePreset(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	if err := s.db.DeletePreset(r.Context(), slug); err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	slog.Info("Deleted preset", "slug", slug)
+	commonHttp.Success(w, map[string]string{"status": "deleted"})
+}
+
+// QuickLog logs a preset now and returns the caffeine level once the drink
+// peaks, which includes earlier drinks as they will have decayed by then.
+// It is meant for shortcuts and NFC tags, so it takes its own token.
+func (s *Server) QuickLog(w http.ResponseWriter, r *http.Request) {
+	preset, err := s.db.GetPreset(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	now := time.Now()
+	event, err := s.db.CreateEvent(r.Context(), models.CaffeineEvent{
+		Timestamp:   now,
+		Description: preset.Description,
+		Amount:      preset.Amount,
+		Cost:        preset.Cost,
+		Confidence:  1,
+	})
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	resp := quickLogResponse{Event: event}
+	level, at, err := s.peakLevel(r.Context(), now)
+	if err != nil {
+		// The drink is logged either way, so a failure here only leaves out the level
+		slog.Error("Failed to calculate caffeine level", "slug", preset.Slug, "event_id", event.ID, "error", err)
+	} else {
+		resp.Level, resp.LevelAt = &level, &at
+	}
+	slog.Info("Quick logged preset", "slug", preset.Slug, "event_id", event.ID, "level", level)
+	commonHttp.JSON(w, http.StatusCreated, commonHttp.Response{Success: true, Data: resp})
+}
+
+// decodePreset reads and validates a preset from the request body
+func decodePreset(r *http.Request) (models.Preset, error) {
+	var preset models.Preset
+	if err := json.NewDecoder(r.Body).Decode(&preset); err != nil {
+		return preset, errors.Wrap(errors.ErrInvalidInput, "invalid request body")
+	}
+	preset.Description = strings.TrimSpace(preset.Description)
+
+	switch {
+	case !slugPattern.MatchString(preset.Slug):
+		return preset, errors.Wrap(errors.ErrInvalidInput, "slug must be lowercase letters and digits separated by hyphens")
+	case preset.Description == "":
+		return preset, errors.Wrap(errors.ErrInvalidInput, "description is required")
+	case preset.Amount <= 0 || preset.Amount > maxEventCaffeine:
+		return preset, errors.Wrap(errors.ErrInvalidInput, "amount must be between 1 and %d mg", maxEventCaffeine)
+	case preset.Cost < 0:
+		return preset, errors.Wrap(errors.ErrInvalidInput, "cost cannot be negative")
+	}
+	return preset, nil
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/baely/txn/internal/tracker/database/memory"
+	"github.com/baely/txn/internal/tracker/kinetics"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+// TestQuickLogLevel checks that quick logging reports the level once the new
+// drink peaks, with an earlier drink decayed to then
+func TestQuickLogLevel(t *testing.T) {
+	absorption := kinetics.Absorption{HalfLife: 4 * time.Hour, AbsorptionRate: 4, Bioavailability: 0.99}
+	tests := []struct {
+		model string
+		peak  time.Duration
+		want  float64
+	}{
+		{kinetics.ModelExponential, 0, 160 + 40},
+		{kinetics.ModelAbsorption, absorption.Peak(), absorption.Amount(160, absorption.Peak()) + absorption.Amount(80, 4*time.Hour+absorption.Peak())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			db := memory.New()
+			earlier := models.CaffeineEvent{Timestamp: time.Now().Add(-4 * time.Hour), Description: "The Jolly Miller", Amount: 80, Confidence: 1}
+			if _, err := db.CreateEvent(context.Background(), earlier); err != nil {
+				t.Fatalf("failed to create event: %v", err)
+			}
+			srv := NewServer(db, Config{QuickLogToken: "quick", Model: tt.model})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/quick-log/homemade-double-oat-latte", nil)
+			req.Header.Set("Authorization", "Bearer quick")
+			rec := httptest.NewRecorder()
+			start := time.Now()
+			srv.ServeHTTP(rec, req)
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+			}
+
+			var resp struct {
+				Data quickLogResponse `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Data.Level == nil || resp.Data.LevelAt == nil {
+				t.Fatalf("got %+v, want a level", resp.Data)
+			}
+			if got := *resp.Data.Level; math.Abs(got-tt.want) > 0.1 {
+				t.Fatalf("got a level of %v, want %v", got, tt.want)
+			}
+			if got := resp.Data.LevelAt.Sub(start); (got - tt.peak).Abs() > time.Second {
+				t.Fatalf("got the level %v after logging, want %v", got, tt.peak)
+			}
+		})
+	}
+}
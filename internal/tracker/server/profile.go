@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/baely/txn/internal/common/errors"
+	commonHttp "github.com/baely/txn/internal/common/http"
+	"github.com/baely/txn/internal/tracker/database"
+	"github.com/baely/txn/internal/tracker/kinetics"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+// Half-life factors, applied to the configured half-life when the profile
+// does not set one
+const (
+	smokerFactor            = 0.6 // Smoking speeds up clearance by around half
+	oralContraceptiveFactor = 2.0 // Oral contraceptives roughly double the half-life
+	pregnancyFactor         = 3.0 // Up to three times longer by the third trimester
+)
+
+// Daily limits in mg, used when the profile does not set one
+const (
+	defaultDailyLimit  = 400
+	pregnantDailyLimit = 200
+	limitPerKg         = 5.7 // 400mg for a 70kg adult
+)
+
+// Profile validation limits
+const (
+	maxHalfLife   = 48  // Hours
+	maxWeight     = 400 // kg
+	maxDailyLimit = 2000
+)
+
+// bedtimeLayout is the format of Profile.Bedtime
+const bedtimeLayout = "15:04"
+
+// profileResponse is a profile along with the values worked out from it
+type profileResponse struct {
+	models.Profile
+	Derived derivedProfile `json:"derived"`
+}
+
+// derivedProfile is what the calculations use
+type derivedProfile struct {
+	HalfLife   float64 `json:"half_life"`   // Hours
+	DailyLimit int     `json:"daily_limit"` // Caffeine in mg
+}
+
+// forecastResponse is where the day's caffeine is heading
+type forecastResponse struct {
+	Level        float64     `json:"level"` // Caffeine in mg now
+	Bedtime      TimeWrapper `json:"bedtime"`
+	BedtimeLevel float64     `json:"bedtime_level"` // Caffeine in mg at bedtime if nothing else is drunk
+	Intake       int         `json:"intake"`        // Caffeine in mg drunk today
+	DailyLimit   int         `json:"daily_limit"`
+	Remaining    int         `json:"remaining"` // Caffeine in mg left of the daily limit, 0 once it is reached
+}
+
+// GetProfile returns the profile
+func (s *Server) GetProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := s.db.GetProfile(r.Context())
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, s.describeProfile(profile))
+}
+
+// UpdateProfile replaces the profile
+func (s *Server) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := decodeProfile(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	profile, err = s.db.UpdateProfile(r.Context(), profile)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	slog.Info("Updated profile")
+	commonHttp.Success(w, s.describeProfile(profile))
+}
+
+// GetForecast returns the caffeine level now and at bedtime, and how much of
+// the daily limit is left
+func (s *Server) GetForecast(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	profile, err := s.db.GetProfile(ctx)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	model, err := s.levelModel(profile, r.URL.Query().Get("model"))
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	now := time.Now()
+	bedtime := nextBedtime(profile, now)
+	events, err := s.db.GetEvents(ctx, now.Add(-72*time.Hour), now.Add(time.Second))
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	y, m, d := now.In(loc).Date()
+	intake, err := s.db.GetTotalIntake(ctx, time.Date(y, m, d, 0, 0, 0, 0, loc), now.Add(time.Second))
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	limit := dailyLimit(profile)
+	resp := forecastResponse{
+		Level:        calculateSumCaffeineLevel(model, now, events),
+		Bedtime:      TimeWrapper{bedtime},
+		BedtimeLevel: calculateSumCaffeineLevel(model, bedtime, events),
+		Intake:       intake,
+		DailyLimit:   limit,
+		Remaining:    max(limit-intake, 0),
+	}
+	commonHttp.Success(w, resp)
+}
+
+// levelModel returns the named model, or the configured one when name is
+// empty, using the half-life from the profile
+func (s *Server) levelModel(profile models.Profile, name string) (kinetics.Model, error) {
+	if name == "" {
+		name = s.model
+	}
+	params := s.params
+	params.HalfLife = s.halfLife(profile)
+	return kinetics.New(name, params)
+}
+
+// profileModel loads the profile and returns the configured model for it
+func (s *Server) profileModel(ctx context.Context) (kinetics.Model, error) {
+	profile, err := s.db.GetProfile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.levelModel(profile, "")
+}
+
+// halfLife returns the profile's half-life, or the configured half-life
+// adjusted for the factors the profile has
+func (s *Server) halfLife(p models.Profile) time.Duration {
+	if p.HalfLife != nil {
+		return time.Duration(*p.HalfLife * float64(time.Hour))
+	}
+	factor := 1.0
+	if p.Smoker {
+		factor *= smokerFactor
+	}
+	if p.OralContraceptives {
+		factor *= oralContraceptiveFactor
+	}
+	if p.Pregnant {
+		factor *= pregnancyFactor
+	}
+	return time.Duration(float64(s.params.HalfLife) * factor)
+}
+
+// dailyLimit returns the profile's daily limit, or one worked out from its
+// weight, never above the general adult limit
+func dailyLimit(p models.Profile) int {
+	switch {
+	case p.DailyLimit != nil:
+		return *p.DailyLimit
+	case p.Pregnant:
+		return pregnantDailyLimit
+	case p.Weight != nil:
+		return min(int(math.Round(*p.Weight*limitPerKg)), defaultDailyLimit)
+	default:
+		return defaultDailyLimit
+	}
+}
+
+// nextBedtime returns the first bedtime after now
+func nextBedtime(p models.Profile, now time.Time) time.Time {
+	bedtime, err := time.Parse(bedtimeLayout, p.Bedtime)
+	if err != nil {
+		bedtime, _ = time.Parse(bedtimeLayout, database.DefaultProfile.Bedtime)
+	}
+	local := now.In(loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), bedtime.Hour(), bedtime.Minute(), 0, 0, loc)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// describeProfile adds the derived values to a profile
+func (s *Server) describeProfile(p models.Profile) profileResponse {
+	return profileResponse{
+		Profile: p,
+		Derived: derivedProfile{
+			HalfLife:   s.halfLife(p).Hours(),
+			DailyLimit: dailyLimit(p),
+		},
+	}
+}
+
+func decodeProfile(r *http.Request) (models.Profile, error) {
+	var profile models.Profile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		return profile, errors.Wrap(errors.ErrInvalidInput, "invalid request body")
+	}
+	if profile.Bedtime == "" {
+		profile.Bedtime = database.DefaultProfile.Bedtime
+	}
+
+	switch {
+	case profile.HalfLife != nil && (*profile.HalfLife <= 0 || *profile.HalfLife > maxHalfLife):
+		return profile, errors.Wrap(errors.ErrInvalidInput, "half_life must be between 0 and %d hours", maxHalfLife)
+	case profile.Weight != nil && (*profile.Weight <= 0 || *profile.Weight > maxWeight):
+		return profile, errors.Wrap(errors.ErrInvalidInput, "weight must be between 0 and %d kg", maxWeight)
+	case profile.DailyLimit != nil && (*profile.DailyLimit <= 0 || *profile.DailyLimit > maxDailyLimit):
+		return profile, errors.Wrap(errors.ErrInvalidInput, "daily_limit must be between 1 and %d mg", maxDailyLimit)
+	}
+	if _, err := time.Parse(bedtimeLayout, profile.Bedtime); err != nil {
+		return profile, errors.Wrap(errors.ErrInvalidInput, "bedtime must be HH:MM")
+	}
+	return profile, nil
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baely/txn/internal/common/errors"
+	"github.com/baely/txn/internal/tracker/kinetics"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestHalfLife(t *testing.T) {
+	s := &Server{params: kinetics.DefaultParams()}
+	tests := []struct {
+		name    string
+		profile models.Profile
+		want    time.Duration
+	}{
+		{"default", models.Profile{}, 4 * time.Hour},
+		{"set", models.Profile{HalfLife: ptr(6.5)}, 6*time.Hour + 30*time.Minute},
+		{"set overrides the factors", models.Profile{HalfLife: ptr(3.0), Smoker: true, Pregnant: true}, 3 * time.Hour},
+		{"smoker", models.Profile{Smoker: true}, 2*time.Hour + 24*time.Minute},
+		{"oral contraceptives", models.Profile{OralContraceptives: true}, 8 * time.Hour},
+		{"pregnant", models.Profile{Pregnant: true}, 12 * time.Hour},
+		{"smoker on oral contraceptives", models.Profile{Smoker: true, OralContraceptives: true}, 4*time.Hour + 48*time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.halfLife(tt.profile); got.Round(time.Second) != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDailyLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile models.Profile
+		want    int
+	}{
+		{"default", models.Profile{}, defaultDailyLimit},
+		{"set", models.Profile{DailyLimit: ptr(300)}, 300},
+		{"set above the default", models.Profile{DailyLimit: ptr(600)}, 600},
+		{"set overrides pregnancy", models.Profile{DailyLimit: ptr(100), Pregnant: true}, 100},
+		{"pregnant", models.Profile{Pregnant: true}, pregnantDailyLimit},
+		{"pregnant overrides weight", models.Profile{Pregnant: true, Weight: ptr(100.0)}, pregnantDailyLimit},
+		{"light", models.Profile{Weight: ptr(50.0)}, 285},
+		{"typical", models.Profile{Weight: ptr(70.0)}, 399},
+		{"heavy is capped", models.Profile{Weight: ptr(120.0)}, defaultDailyLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dailyLimit(tt.profile); got != tt.want {
+				t.Fatalf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextBedtime(t *testing.T) {
+	// Melbourne wall-clock time, resolved with the offsets in force at the time
+	melbourne := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, loc)
+	}
+	// Wanted bedtimes are in UTC, so a wrong offset is caught
+	utc := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name    string
+		bedtime string
+		now     time.Time
+		want    time.Time
+	}{
+		{"before bedtime", "22:00", melbourne(time.May, 1, 20, 0), utc(time.May, 1, 12, 0)},
+		{"at bedtime", "22:00", melbourne(time.May, 1, 22, 0), utc(time.May, 2, 12, 0)},
+		{"after bedtime", "22:00", melbourne(time.May, 1, 23, 30), utc(time.May, 2, 12, 0)},
+		{"now in utc", "22:00", utc(time.May, 1, 13, 0), utc(time.May, 2, 12, 0)},
+		{"after midnight", "22:00", melbourne(time.May, 2, 0, 30), utc(time.May, 2, 12, 0)},
+		{"bedtime after midnight, before it", "00:30", melbourne(time.May, 2, 0, 10), utc(time.May, 1, 14, 30)},
+		{"bedtime after midnight, the evening before", "00:30", melbourne(time.May, 1, 23, 0), utc(time.May, 1, 14, 30)},
+		{"invalid bedtime uses the default", "10pm", melbourne(time.May, 1, 20, 0), utc(time.May, 1, 12, 0)},
+		// Daylight saving ends at 3am on 7 April 2024, going from +11 to +10
+		{"the night before daylight saving ends", "22:00", melbourne(time.April, 6, 21, 0), utc(time.April, 6, 11, 0)},
+		{"across the end of daylight saving", "22:00", melbourne(time.April, 6, 23, 0), utc(time.April, 7, 12, 0)},
+		{"after daylight saving ends", "22:00", melbourne(time.April, 7, 2, 30), utc(time.April, 7, 12, 0)},
+		{"bedtime after midnight as daylight saving ends", "00:30", melbourne(time.April, 6, 23, 0), utc(time.April, 6, 13, 30)},
+		// Daylight saving starts at 2am on 6 October 2024, going from +10 to +11
+		{"the night before daylight saving starts", "22:00", melbourne(time.October, 5, 21, 0), utc(time.October, 5, 12, 0)},
+		{"across the start of daylight saving", "22:00", melbourne(time.October, 5, 23, 0), utc(time.October, 6, 11, 0)},
+		{"after daylight saving starts", "22:00", melbourne(time.October, 6, 3, 30), utc(time.October, 6, 11, 0)},
+		{"bedtime after midnight as daylight saving starts", "00:30", melbourne(time.October, 5, 23, 0), utc(time.October, 5, 14, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextBedtime(models.Profile{Bedtime: tt.bedtime}, tt.now)
+			if !got.Equal(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want.In(loc))
+			}
+		})
+	}
+}
+
+func TestDecodeProfile(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error // Nil for a valid profile
+	}{
+		{"empty", `{}`, nil},
+		{"every field", `{"half_life": 5.5, "weight": 70, "daily_limit": 300, "bedtime": "23:30", "smoker": true}`, nil},
+		{"at the limits", fmt.Sprintf(`{"half_life": %d, "weight": %d, "daily_limit": %d}`, maxHalfLife, maxWeight, maxDailyLimit), nil},
+		{"not json", `bedtime=22:00`, errors.ErrInvalidInput},
+		{"truncated", `{"bedtime": "22:00"`, errors.ErrInvalidInput},
+		{"wrong type", `{"weight": "70kg"}`, errors.ErrInvalidInput},
+		{"zero half-life", `{"half_life": 0}`, errors.ErrInvalidInput},
+		{"half-life too long", `{"half_life": 48.5}`, errors.ErrInvalidInput},
+		{"negative weight", `{"weight": -70}`, errors.ErrInvalidInput},
+		{"weight too high", `{"weight": 401}`, errors.ErrInvalidInput},
+		{"zero daily limit", `{"daily_limit": 0}`, errors.ErrInvalidInput},
+		{"daily limit too high", `{"daily_limit": 2001}`, errors.ErrInvalidInput},
+		{"fractional daily limit", `{"daily_limit": 300.5}`, errors.ErrInvalidInput},
+		{"bedtime out of range", `{"bedtime": "25:00"}`, errors.ErrInvalidInput},
+		{"bedtime not hh:mm", `{"bedtime": "10pm"}`, errors.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/admin/profile", strings.NewReader(tt.body))
+			profile, err := decodeProfile(r)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("got %v, want %v", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to decode profile: %v", err)
+			}
+			if profile.Bedtime == "" {
+				t.Fatal("got no bedtime, want the default")
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/baely/txn/internal/balance"
+	"github.com/baely/txn/internal/common/errors"
+	commonHttp "github.com/baely/txn/internal/common/http"
+	"github.com/baely/txn/internal/tracker/database"
+	"github.com/baely/txn/internal/tracker/matcher"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+// History provides previously seen transactions so they can be reprocessed
+type History interface {
+	ArchivedEvents(ctx context.Context, since, until time.Time) ([]balance.TransactionEvent, error)
+}
+
+// Reprocess runs archived transactions in [since, until) through the current
+// rules and diffs the result against the recorded caffeine events. Unless dryRun
+// is set the diff is applied in a single database transaction.
+// Events for transactions that are not in the archive are left alone.
+func Reprocess(ctx context.Context, db database.Store, history History, since, until time.Time, dryRun bool) (models.ReprocessResult, error) {
+	result := models.ReprocessResult{
+		Since:  since,
+		Until:  until,
+		DryRun: dryRun,
+	}
+
+	events, err := history.ArchivedEvents(ctx, since, until)
+	if err != nil {
+		return result, err
+	}
+	result.Transactions = len(events)
+
+	ids := make([]string, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.Transaction.Id)
+	}
+	existing, err := db.GetEventsBySource(ctx, ids)
+	if err != nil {
+		return result, err
+	}
+
+	m, err := loadMatcher(ctx, db)
+	if err != nil {
+		return result, err
+	}
+
+	planned := planEvents(m, events)
+	keepReversals(existing, planned, ids)
+	changes, unchanged := diffEvents(existing, planned)
+	result.Changes = changes
+	result.Unchanged = unchanged
+	for _, change := range changes {
+		switch change.Action {
+		case models.ChangeAdd:
+			result.Added++
+		case models.ChangeUpdate:
+			result.Changed++
+		case models.ChangeRemove:
+			result.Removed++
+		}
+	}
+
+	if dryRun || len(changes) == 0 {
+		return result, nil
+	}
+	if err := db.ApplyEventChanges(ctx, changes); err != nil {
+		return result, err
+	}
+	slog.Info("Reprocessed caffeine events", "added", result.Added, "changed", result.Changed, "removed", result.Removed)
+	return result, nil
+}
+
+// planEvents returns the caffeine events the current rules produce for a
+// transaction history, oldest first, with refunded purchases marked as reversed
+func planEvents(m *matcher.Matcher, events []balance.TransactionEvent) []models.CaffeineEvent {
+	planned := make([]models.CaffeineEvent, 0)
+	reversed := make(map[eventKey]bool)
+	for _, event := range events {
+		if event.Type == balance.EventTypeDeleted {
+			continue
+		}
+
+		caffeineEvents, result := m.Match(event)
+		if result != matcher.Matched {
+			continue
+		}
+
+		if event.Transaction.Attributes.Amount.ValueInBaseUnits <= 0 {
+			planned = append(planned, caffeineEvents...)
+			continue
+		}
+
+		// Refunds reverse the most recent matching purchases once, as they do
+		// when processed live
+		for _, refund := range caffeineEvents {
+			if reversed[keyOf(refund)] {
+				continue
+			}
+			for i := len(planned) - 1; i >= 0; i-- {
+				p := planned[i]
+				if p.ReversedBy == "" && p.Description == refund.Description && p.Cost == refund.Cost && !p.Timestamp.After(refund.Timestamp) {
+					planned[i].ReversedBy, planned[i].ReversedByItem = refund.SourceTransactionID, refund.SourceItem
+					reversed[keyOf(refund)] = true
+					break
+				}
+			}
+		}
+	}
+	return planned
+}
+
+// keepReversals carries over purchases reversed by refunds outside the archived
+// transactions, which planEvents cannot see
+func keepReversals(existing, planned []models.CaffeineEvent, ids []string) {
+	archived := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		archived[id] = true
+	}
+	reversals := make(map[eventKey]models.CaffeineEvent)
+	for _, e := range existing {
+		if e.ReversedBy != "" && !archived[e.ReversedBy] {
+			reversals[keyOf(e)] = e
+		}
+	}
+	for i, p := range planned {
+		if e, ok := reversals[keyOf(p)]; ok && p.ReversedBy == "" {
+			planned[i].ReversedBy, planned[i].ReversedByItem = e.ReversedBy, e.ReversedByItem
+		}
+	}
+}
+
+// eventKey identifies an event by its source transaction and drink
+type eventKey struct {
+	transactionID string
+	item          int
+}
+
+func keyOf(e models.CaffeineEvent) eventKey {
+	return eventKey{transactionID: e.SourceTransactionID, item: e.SourceItem}
+}
+
+// diffEvents compares recorded events with planned ones by source transaction and drink.
+// Events edited by hand are kept as they are.
+func diffEvents(existing, planned []models.CaffeineEvent) ([]models.EventChange, int) {
+	recorded := make(map[eventKey]models.CaffeineEvent, len(existing))
+	for _, e := range existing {
+		recorded[keyOf(e)] = e
+	}
+
+	changes := make([]models.EventChange, 0)
+	unchanged := 0
+	for _, p := range planned {
+		after := p
+		key := keyOf(p)
+		before, ok := recorded[key]
+		if !ok {
+			changes = append(changes, models.EventChange{Action: models.ChangeAdd, SourceTransactionID: p.SourceTransactionID, SourceItem: p.SourceItem, After: &after})
+			continue
+		}
+		delete(recorded, key)
+		after.ForSomeoneElse = before.ForSomeoneElse
+
+		if before.Edited || sameEvent(before, p) {
+			unchanged++
+			continue
+		}
+		changes = append(changes, models.EventChange{Action: models.ChangeUpdate, SourceTransactionID: p.SourceTransactionID, SourceItem: p.SourceItem, Before: &before, After: &after})
+	}
+
+	for _, e := range existing {
+		if _, ok := recorded[keyOf(e)]; !ok {
+			continue
+		}
+		if e.Edited {
+			unchanged++
+			continue
+		}
+		before := e
+		changes = append(changes, models.EventChange{Action: models.ChangeRemove, SourceTransactionID: e.SourceTransactionID, SourceItem: e.SourceItem, Before: &before})
+	}
+
+	slices.SortStableFunc(changes, func(a, b models.EventChange) int {
+		return a.Time().Compare(b.Time())
+	})
+	return changes, unchanged
+}
+
+// sameEvent reports whether two events record the same thing, at the
+// second precision the database stores. Whether a drink was for someone else
+// is set by hand, so it is kept rather than compared.
+func sameEvent(a, b models.CaffeineEvent) bool {
+	return a.Timestamp.Unix() == b.Timestamp.Unix() &&
+		a.Description == b.Description &&
+		a.Amount == b.Amount &&
+		a.Cost == b.Cost &&
+		a.Confidence == b.Confidence &&
+		a.Flagged == b.Flagged &&
+		a.ReversedBy == b.ReversedBy &&
+		a.ReversedByItem == b.ReversedByItem
+}
+
+// PostReprocess reprocesses archived transactions. It is a dry run unless apply=true.
+func (s *Server) PostReprocess(w http.ResponseWriter, r *http.Request) {
+	if s.history == nil {
+		commonHttp.HandleError(w, errors.Wrap(errors.ErrUnavailable, "transaction history is not configured"))
+		return
+	}
+
+	var since, until time.Time
+	for name, t := range map[string]*time.Time{"since": &since, "until": &until} {
+		if v := r.URL.Query().Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				commonHttp.HandleError(w, errors.Wrap(errors.ErrInvalidInput, "invalid %s time", name))
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	apply := false
+	if v := r.URL.Query().Get("apply"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			commonHttp.HandleError(w, errors.Wrap(errors.ErrInvalidInput, "invalid apply"))
+			return
+		}
+		apply = b
+	}
+
+	result, err := Reprocess(r.Context(), s.db, s.history, since, until, !apply)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, result)
+}
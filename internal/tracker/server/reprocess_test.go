@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/baely/txn/internal/balance"
+	"github.com/baely/txn/internal/balance/uptest"
+	"github.com/baely/txn/internal/tracker/database/memory"
+	"github.com/baely/txn/internal/tracker/matcher"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+// history serves a fixed set of archived transactions
+type history []balance.TransactionEvent
+
+func (h history) ArchivedEvents(ctx context.Context, since, until time.Time) ([]balance.TransactionEvent, error) {
+	return h, nil
+}
+
+// TestReprocessKeepsReviewedDrinks checks that a drink recorded by reviewing a
+// candidate, without a rule to match it again, survives a reprocess
+func TestReprocessKeepsReviewedDrinks(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	timestamp := time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	if err := db.AddCandidate(ctx, models.Candidate{SourceTransactionID: "tx-1", Merchant: "New Cafe", Category: "restaurants-and-cafes", Cost: 620, Timestamp: timestamp}); err != nil {
+		t.Fatalf("failed to add candidate: %v", err)
+	}
+	pending, err := db.ListCandidates(ctx, models.CandidatePending)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("got %d candidates, %v, want 1", len(pending), err)
+	}
+	event := models.CaffeineEvent{Timestamp: timestamp, Description: "Long black", Amount: 160, Cost: 620, SourceTransactionID: "tx-1", Confidence: 1}
+	if _, err := db.ResolveCandidate(ctx, pending[0].ID, models.CandidateDrink, &event, nil); err != nil {
+		t.Fatalf("failed to resolve candidate: %v", err)
+	}
+
+	archived := history{{
+		Type: balance.EventTypeCreated,
+		Transaction: uptest.NewTransaction(uptest.Transaction{
+			ID:          "tx-1",
+			AccountID:   "acc-1",
+			Description: "New Cafe",
+			Amount:      -620,
+			Category:    "restaurants-and-cafes",
+			CreatedAt:   timestamp,
+		}),
+	}}
+	result, err := Reprocess(ctx, db, archived, time.Time{}, time.Time{}, false)
+	if err != nil {
+		t.Fatalf("failed to reprocess: %v", err)
+	}
+	if result.Removed != 0 || result.Unchanged != 1 {
+		t.Fatalf("got %d removed and %d unchanged, want the reviewed drink kept", result.Removed, result.Unchanged)
+	}
+	events, err := db.GetEventsBySource(ctx, []string{"tx-1"})
+	if err != nil || len(events) != 1 || events[0].Description != "Long black" {
+		t.Fatalf("got %+v, %v, want the reviewed drink", events, err)
+	}
+}
+
+var base = time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+// drink builds a caffeine event for a transaction, minutes after base
+func drink(transactionID string, item, minutes, amount int) models.CaffeineEvent {
+	return models.CaffeineEvent{
+		Timestamp:           base.Add(time.Duration(minutes) * time.Minute),
+		Description:         "Charlie Bit Me Cafe",
+		Amount:              amount,
+		Cost:                680,
+		SourceTransactionID: transactionID,
+		SourceItem:          item,
+		Confidence:          1,
+	}
+}
+
+// change describes an expected EventChange
+type change struct {
+	action        models.ChangeAction
+	transactionID string
+	item          int
+}
+
+func TestDiffEvents(t *testing.T) {
+	edited := func(e models.CaffeineEvent) models.CaffeineEvent {
+		e.Edited = true
+		return e
+	}
+	reversed := func(e models.CaffeineEvent, by string) models.CaffeineEvent {
+		e.ReversedBy = by
+		return e
+	}
+	forSomeoneElse := drink("tx-1", 0, 0, 160)
+	forSomeoneElse.ForSomeoneElse = true
+	subSecond := drink("tx-1", 0, 0, 160)
+	subSecond.Timestamp = subSecond.Timestamp.Add(400 * time.Millisecond)
+
+	tests := []struct {
+		name      string
+		existing  []models.CaffeineEvent
+		planned   []models.CaffeineEvent
+		want      []change
+		unchanged int
+	}{
+		{"nothing", nil, nil, nil, 0},
+		{"add", nil, []models.CaffeineEvent{drink("tx-1", 0, 0, 160)}, []change{{models.ChangeAdd, "tx-1", 0}}, 0},
+		{"same", []models.CaffeineEvent{drink("tx-1", 0, 0, 160)}, []models.CaffeineEvent{drink("tx-1", 0, 0, 160)}, nil, 1},
+		{"same to the second", []models.CaffeineEvent{subSecond}, []models.CaffeineEvent{drink("tx-1", 0, 0, 160)}, nil, 1},
+		{"update", []models.CaffeineEvent{drink("tx-1", 0, 0, 160)}, []models.CaffeineEvent{drink("tx-1", 0, 0, 80)}, []change{{models.ChangeUpdate, "tx-1", 0}}, 0},
+		{"remove", []models.CaffeineEvent{drink("tx-1", 0, 0, 160)}, nil, []change{{models.ChangeRemove, "tx-1", 0}}, 0},
+		{"edited is not updated", []models.CaffeineEvent{edited(drink("tx-1", 0, 0, 240))}, []models.CaffeineEvent{drink("tx-1", 0, 0, 160)}, nil, 1},
+		{"edited is not removed", []models.CaffeineEvent{edited(drink("tx-1", 0, 0, 160))}, nil, nil, 1},
+		{"for someone else is kept", []models.CaffeineEvent{forSomeoneElse}, []models.CaffeineEvent{drink("tx-1", 0, 0, 160)}, nil, 1},
+		{"newly reversed", []models.CaffeineEvent{drink("tx-1", 0, 0, 160)}, []models.CaffeineEvent{reversed(drink("tx-1", 0, 0, 160), "tx-2")}, []change{{models.ChangeUpdate, "tx-1", 0}}, 0},
+		{"still reversed", []models.CaffeineEvent{reversed(drink("tx-1", 0, 0, 160), "tx-2")}, []models.CaffeineEvent{reversed(drink("tx-1", 0, 0, 160), "tx-2")}, nil, 1},
+		{"items are separate", []models.CaffeineEvent{drink("tx-1", 0, 0, 160)}, []models.CaffeineEvent{drink("tx-1", 0, 0, 160), drink("tx-1", 1, 0, 80)}, []change{{models.ChangeAdd, "tx-1", 1}}, 1},
+		{"ordered by time", []models.CaffeineEvent{drink("tx-3", 0, 30, 160), drink("tx-2", 0, 20, 160)}, []models.CaffeineEvent{drink("tx-2", 0, 20, 80), drink("tx-1", 0, 10, 160)}, []change{
+			{models.ChangeAdd, "tx-1", 0},
+			{models.ChangeUpdate, "tx-2", 0},
+			{models.ChangeRemove, "tx-3", 0},
+		}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, unchanged := diffEvents(tt.existing, tt.planned)
+			var got []change
+			for _, c := range changes {
+				got = append(got, change{c.Action, c.SourceTransactionID, c.SourceItem})
+			}
+			if !slices.Equal(got, tt.want) || unchanged != tt.unchanged {
+				t.Fatalf("got %v with %d unchanged, want %v with %d unchanged", got, unchanged, tt.want, tt.unchanged)
+			}
+		})
+	}
+}
+
+// TestDiffEventsKeepsRecipient checks that an update keeps whether the drink
+// was for someone else, which only a person can set
+func TestDiffEventsKeepsRecipient(t *testing.T) {
+	before := drink("tx-1", 0, 0, 160)
+	before.ForSomeoneElse = true
+	changes, _ := diffEvents([]models.CaffeineEvent{before}, []models.CaffeineEvent{drink("tx-1", 0, 0, 80)})
+	if len(changes) != 1 || changes[0].After == nil || !changes[0].After.ForSomeoneElse || changes[0].After.Amount != 80 {
+		t.Fatalf("got %+v, want an update for someone else", changes)
+	}
+}
+
+// transaction builds an archived café transaction, minutes after base.
+// Positive amounts are refunds, which Up leaves uncategorised.
+func transaction(eventType balance.EventType, id string, minutes, amount int) balance.TransactionEvent {
+	category := "restaurants-and-cafes"
+	if amount > 0 {
+		category = ""
+	}
+	return balance.TransactionEvent{
+		Type: eventType,
+		Transaction: uptest.NewTransaction(uptest.Transaction{
+			ID:          id,
+			AccountID:   "acc-1",
+			Description: "Charlie Bit Me Cafe",
+			Amount:      amount,
+			Category:    category,
+			CreatedAt:   base.Add(time.Duration(minutes) * time.Minute),
+		}),
+	}
+}
+
+func TestPlanEvents(t *testing.T) {
+	m, err := matcher.New([]models.Rule{{
+		Priority: 100,
+		Merchant: "Charlie Bit Me Cafe",
+		Category: "restaurants-and-cafes",
+		Price:    ptr(680),
+		Caffeine: 160,
+	}})
+	if err != nil {
+		t.Fatalf("failed to compile rules: %v", err)
+	}
+	created, deleted := balance.EventTypeCreated, balance.EventTypeDeleted
+
+	// planned is a planned event by transaction and what reversed it
+	type planned struct {
+		transactionID string
+		reversedBy    string
+	}
+	tests := []struct {
+		name   string
+		events []balance.TransactionEvent
+		want   []planned
+	}{
+		{"purchases", []balance.TransactionEvent{transaction(created, "tx-1", 0, -680), transaction(created, "tx-2", 10, -680)}, []planned{{"tx-1", ""}, {"tx-2", ""}}},
+		{"unmatched", []balance.TransactionEvent{transaction(created, "tx-1", 0, -690)}, nil},
+		{"deleted", []balance.TransactionEvent{transaction(deleted, "tx-1", 0, -680)}, nil},
+		{"refund reverses the latest purchase", []balance.TransactionEvent{
+			transaction(created, "tx-1", 0, -680),
+			transaction(created, "tx-2", 10, -680),
+			transaction(created, "tx-3", 20, 680),
+		}, []planned{{"tx-1", ""}, {"tx-2", "tx-3"}}},
+		{"two refunds reverse two purchases", []balance.TransactionEvent{
+			transaction(created, "tx-1", 0, -680),
+			transaction(created, "tx-2", 10, -680),
+			transaction(created, "tx-3", 20, 680),
+			transaction(created, "tx-4", 30, 680),
+		}, []planned{{"tx-1", "tx-4"}, {"tx-2", "tx-3"}}},
+		{"a refund is only applied once", []balance.TransactionEvent{
+			transaction(created, "tx-1", 0, -680),
+			transaction(created, "tx-2", 10, -680),
+			transaction(created, "tx-3", 20, 680),
+			transaction(balance.EventTypeSettled, "tx-3", 20, 680),
+		}, []planned{{"tx-1", ""}, {"tx-2", "tx-3"}}},
+		{"a refund does not reverse a later purchase", []balance.TransactionEvent{
+			transaction(created, "tx-1", 0, 680),
+			transaction(created, "tx-2", 10, -680),
+		}, []planned{{"tx-2", ""}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []planned
+			for _, e := range planEvents(m, tt.events) {
+				got = append(got, planned{e.SourceTransactionID, e.ReversedBy})
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeepReversals(t *testing.T) {
+	reversed := func(e models.CaffeineEvent, by string, item int) models.CaffeineEvent {
+		e.ReversedBy, e.ReversedByItem = by, item
+		return e
+	}
+
+	tests := []struct {
+		name     string
+		existing []models.CaffeineEvent
+		planned  models.CaffeineEvent
+		ids      []string
+		want     string
+		wantItem int
+	}{
+		{"refund outside the archive is kept", []models.CaffeineEvent{reversed(drink("tx-1", 0, 0, 160), "tx-9", 1)}, drink("tx-1", 0, 0, 160), []string{"tx-1"}, "tx-9", 1},
+		{"refund in the archive is replanned", []models.CaffeineEvent{reversed(drink("tx-1", 0, 0, 160), "tx-2", 0)}, drink("tx-1", 0, 0, 160), []string{"tx-1", "tx-2"}, "", 0},
+		{"planned reversal wins", []models.CaffeineEvent{reversed(drink("tx-1", 0, 0, 160), "tx-9", 0)}, reversed(drink("tx-1", 0, 0, 160), "tx-2", 0), []string{"tx-1", "tx-2"}, "tx-2", 0},
+		{"other items are left alone", []models.CaffeineEvent{reversed(drink("tx-1", 1, 0, 160), "tx-9", 0)}, drink("tx-1", 0, 0, 160), []string{"tx-1"}, "", 0},
+		{"not reversed", []models.CaffeineEvent{drink("tx-1", 0, 0, 160)}, drink("tx-1", 0, 0, 160), []string{"tx-1"}, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planned := []models.CaffeineEvent{tt.planned}
+			keepReversals(tt.existing, planned, tt.ids)
+			if got := planned[0]; got.ReversedBy != tt.want || got.ReversedByItem != tt.wantItem {
+				t.Fatalf("got reversed by %q item %d, want %q item %d", got.ReversedBy, got.ReversedByItem, tt.want, tt.wantItem)
+			}
+		})
+	}
+}
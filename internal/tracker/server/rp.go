@@ -1,107 +1,96 @@
 package server
 
 import (
-	"fmt"
-	"strings"
+	"context"
+	"log/slog"
 
 	"github.com/baely/txn/internal/balance"
 	"github.com/baely/txn/internal/tracker/database"
+	"github.com/baely/txn/internal/tracker/matcher"
 	"github.com/baely/txn/internal/tracker/models"
 )
 
-func ProcessEvent(db *database.Client, event balance.TransactionEvent) error {
-	if event.Transaction.Relationships.Category.Data == nil {
+// reviewCategory is the category whose unmatched purchases are queued for review
+const reviewCategory = "restaurants-and-cafes"
+
+func ProcessEvent(ctx context.Context, db database.Store, event balance.TransactionEvent) error {
+	switch event.Type {
+	case balance.EventTypeDeleted:
+		removed, err := db.DeleteEventsBySource(ctx, event.Transaction.Id)
+		if err != nil {
+			return err
+		}
+		if removed > 0 {
+			slog.Info("Removed caffeine events for deleted transaction", "transaction_id", event.Transaction.Id, "count", removed)
+		}
+		return db.DeletePendingCandidate(ctx, event.Transaction.Id)
+	case balance.EventTypeCreated, balance.EventTypeBackfill:
+	default:
+		// Settlement updates refer to a transaction that has already been recorded
 		return nil
 	}
 
-	category := event.Transaction.Relationships.Category.Data.Id
-
-	switch category {
-	case "restaurants-and-cafes":
-		return transformRestaurantEvent(db, event)
-	case "groceries":
-		return transformGroceryEvent(db, event)
-	}
-	
-	return nil
-}
-
-func transformRestaurantEvent(db *database.Client, event balance.TransactionEvent) error {
-	desc := event.Transaction.Attributes.Description
-	amt := event.Transaction.Attributes.Amount.ValueInBaseUnits
-	if amt < 0 {
-		amt = -amt
+	m, err := loadMatcher(ctx, db)
+	if err != nil {
+		return err
 	}
-	createdAt := event.Transaction.Attributes.CreatedAt
-
-	type lookupKey struct {
-		Description string
-		Cost        int
-	}
-	lookup := map[lookupKey]int{
-		{"Charlie Bit Me Cafe", 680}:  160,
-		{"Charlie Bit Me Cafe", 700}:  160,
-		{"Charlie Bit Me Cafe", 580}:  80,
-		{"Georgie Boy Espresso", 550}: 160,
-		{"Georgie Boy Espresso", 600}: 160,
-		{"Chia Chia", 550}:            160,
-		{"Chia Chia", 540}:            160,
-		{"Chia Chia", 500}:            80,
-		{"Chia Chia", 590}:            240,
-		{"In a Rush", 560}:            160,
-		{"Mr Summit", 550}:            160,
-		{"The Other Brother", 600}:    160,
+	caffeineEvents, result := m.Match(event)
+	switch result {
+	case matcher.Ignored:
+		return nil
+	case matcher.Unmatched:
+		return queueCandidate(ctx, db, event)
 	}
 
-	key := lookupKey{Description: desc, Cost: amt}
-	amount, ok := lookup[key]
-	if !ok {
+	// Refunds carry a positive amount and reverse the purchases they match
+	if event.Transaction.Attributes.Amount.ValueInBaseUnits > 0 {
+		for _, caffeineEvent := range caffeineEvents {
+			reversed, err := db.ReverseRefundedEvent(ctx, caffeineEvent)
+			if err != nil {
+				return err
+			}
+			slog.Info("Reversed caffeine event for refund", "transaction_id", event.Transaction.Id, "description", caffeineEvent.Description, "count", reversed)
+		}
 		return nil
 	}
 
-	caffeineEvent := models.CaffeineEvent{
-		Timestamp:   createdAt,
-		Description: desc,
-		Amount:      amount,
-		Cost:        amt,
+	for _, caffeineEvent := range caffeineEvents {
+		if caffeineEvent.Flagged {
+			slog.Warn("Recorded low confidence caffeine event", "transaction_id", event.Transaction.Id, "item", caffeineEvent.SourceItem,
+				"description", caffeineEvent.Description, "cost", caffeineEvent.Cost, "confidence", caffeineEvent.Confidence)
+		}
+		if err := db.AddEvent(ctx, caffeineEvent); err != nil {
+			return err
+		}
 	}
-
-	return db.AddEvent(caffeineEvent)
+	return db.DeletePendingCandidate(ctx, event.Transaction.Id)
 }
 
-func transformGroceryEvent(db *database.Client, event balance.TransactionEvent) error {
-	raw := event.Transaction.Attributes.RawText
-	amt := event.Transaction.Attributes.Amount.ValueInBaseUnits
-	if amt < 0 {
-		amt = -amt
-	}
-	createdAt := event.Transaction.Attributes.CreatedAt
-
-	fmt.Println("Handling grocery event", raw, amt)
-
-	if raw == nil {
-		fmt.Println("Raw text is nil")
+// queueCandidate keeps café purchases that no rule matched for review
+func queueCandidate(ctx context.Context, db database.Store, event balance.TransactionEvent) error {
+	relationships := event.Transaction.Relationships
+	if relationships.Category.Data == nil || relationships.Category.Data.Id != reviewCategory {
 		return nil
 	}
-
-	rawText := strings.ToUpper(*raw)
-
-	if !strings.Contains(rawText, "WOOLWORTHS") || !strings.Contains(rawText, "DOCK") {
-		fmt.Println("Raw text does not contain Woolworths Dock")
+	attributes := event.Transaction.Attributes
+	if attributes.Amount.ValueInBaseUnits >= 0 {
 		return nil
 	}
 
-	if amt < 200 || amt > 700 {
-		fmt.Println("Amount is not between 200 and 700")
-		return nil
+	candidate := models.Candidate{
+		SourceTransactionID: event.Transaction.Id,
+		Merchant:            attributes.Description,
+		Category:            reviewCategory,
+		Cost:                -attributes.Amount.ValueInBaseUnits,
+		Timestamp:           attributes.CreatedAt,
 	}
-
-	caffeineEvent := models.CaffeineEvent{
-		Timestamp:   createdAt,
-		Description: "Dare NAS Intense Espresso",
-		Amount:      260,
-		Cost:        amt,
+	if attributes.RawText != nil {
+		candidate.RawText = *attributes.RawText
 	}
-
-	return db.AddEvent(caffeineEvent)
+	if err := db.AddCandidate(ctx, candidate); err != nil {
+		return err
+	}
+	slog.Info("Queued unmatched purchase for review", "transaction_id", candidate.SourceTransactionID,
+		"merchant", candidate.Merchant, "cost", candidate.Cost)
+	return nil
 }
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/baely/txn/internal/common/errors"
+	commonHttp "github.com/baely/txn/internal/common/http"
+	"github.com/baely/txn/internal/tracker/database"
+	"github.com/baely/txn/internal/tracker/matcher"
+	"github.com/baely/txn/internal/tracker/models"
+)
+
+// loadMatcher compiles the stored rules. Rules are read for every call so
+// edits take effect without a restart.
+func loadMatcher(ctx context.Context, db database.Store) (*matcher.Matcher, error) {
+	rules, err := db.ListRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return matcher.New(rules)
+}
+
+// ListRules returns every matching rule in evaluation order
+func (s *Server) ListRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.db.ListRules(r.Context())
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, rules)
+}
+
+// GetRule returns a single rule
+func (s *Server) GetRule(w http.ResponseWriter, r *http.Request) {
+	id, err := ruleID(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	rule, err := s.db.GetRule(r.Context(), id)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, rule)
+}
+
+// CreateRule adds a rule
+func (s *Server) CreateRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := decodeRule(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	rule, err = s.db.CreateRule(r.Context(), rule)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	slog.Info("Created caffeine rule", "id", rule.ID, "merchant", rule.Merchant, "caffeine", rule.Caffeine)
+	commonHttp.JSON(w, http.StatusCreated, commonHttp.Response{Success: true, Data: rule})
+}
+
+// UpdateRule replaces a rule
+func (s *Server) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	id, err := ruleID(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	rule, err := decodeRule(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	rule.ID = id
+	rule, err = s.db.UpdateRule(r.Context(), rule)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	slog.Info("Updated caffeine rule", "id", rule.ID)
+	commonHttp.Success(w, rule)
+}
+
+// DeleteRule removes a rule
+func (s *Server) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	id, err := ruleID(r)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	if err := s.db.DeleteRule(r.Context(), id); err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	slog.Info("Deleted caffeine rule", "id", id)
+	commonHttp.Success(w, map[string]string{"status": "deleted"})
+}
+
+// ListFlaggedEvents returns caffeine events matched with low confidence.
+// Fix them by adjusting the rules and reprocessing.
+func (s *Server) ListFlaggedEvents(w http.ResponseWriter, r *http.Request) {
+	events, err := s.db.GetFlaggedEvents(r.Context())
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	commonHttp.Success(w, events)
+}
+
+// ruleID reads the rule id from the URL
+func ruleID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(errors.ErrInvalidInput, "invalid rule id")
+	}
+	return id, nil
+}
+
+// decodeRule reads and validates a rule from the request body
+func decodeRule(r *http.Request) (models.Rule, error) {
+	var rule models.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		return rule, errors.Wrap(errors.ErrInvalidInput, "invalid request body")
+	}
+	if err := matcher.Validate(rule); err != nil {
+		return rule, err
+	}
+	return rule, nil
+}
@@ -1,17 +1,19 @@
 package server
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
-	"math"
+	"log/slog"
 	"net/http"
 	"slices"
-	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	commonHttp "github.com/baely/txn/internal/common/http"
 	"github.com/baely/txn/internal/tracker/database"
+	"github.com/baely/txn/internal/tracker/kinetics"
 	"github.com/baely/txn/internal/tracker/models"
 )
 
@@ -31,15 +33,97 @@ func (t TimeWrapper) MarshalJSON() ([]byte, error) {
 	return json.Marshal(t.Unix())
 }
 
+// DefaultRequestTimeout bounds how long a request may spend in the data layer
+const DefaultRequestTimeout = 10 * time.Second
+
 type Server struct {
-	db *database.Client
+	db      database.Store
+	history History
+	timeout time.Duration
+	params  kinetics.Params
+	model   string
+}
+
+// Config contains configuration for the tracker API
+type Config struct {
+	AdminSecretCode string        // Bearer token for admin routes
+	QuickLogToken   string        // Bearer token for quick-logging presets
+	History         History       // Archived transactions for reprocessing, optional
+	RequestTimeout  time.Duration // Zero uses DefaultRequestTimeout
+
+	// Caffeine level model, by name, and its parameters. The zero values
+	// use kinetics.DefaultModel and kinetics.DefaultParams. The half-life is
+	// only used when the profile does not set one.
+	Model    string
+	Kinetics kinetics.Params
 }
 
-func NewServer(db *database.Client) chi.Router {
+func NewServer(db database.Store, cfg Config) chi.Router {
 	s := &Server{
-		db: db,
+		db:      db,
+		history: cfg.History,
+		timeout: cfg.RequestTimeout,
+	}
+	if s.timeout <= 0 {
+		s.timeout = DefaultRequestTimeout
+	}
+	s.params = cfg.Kinetics
+	if s.params == (kinetics.Params{}) {
+		s.params = kinetics.DefaultParams()
 	}
-	return s.registerApiEndpoints()
+	s.model = cfg.Model
+	if _, err := kinetics.New(s.model, s.params); err != nil {
+		slog.Error("Invalid caffeine level model, using the default", "model", cfg.Model, "error", err)
+		s.params = kinetics.DefaultParams()
+		s.model = kinetics.DefaultModel
+	}
+	r := s.registerApiEndpoints()
+
+	// Admin routes and event writes require the admin secret as a bearer token
+	r.Group(func(r chi.Router) {
+		r.Use(commonHttp.RequireBearerToken(cfg.AdminSecretCode))
+
+		// Reprocessing walks the whole archive, so it is not bound by the request timeout
+		r.Post("/admin/reprocess", s.PostReprocess)
+
+		r.Group(func(r chi.Router) {
+			r.Use(commonHttp.Timeout(s.timeout))
+
+			r.Get("/admin/rules", s.ListRules)
+			r.Post("/admin/rules", s.CreateRule)
+			r.Get("/admin/rules/{id}", s.GetRule)
+			r.Put("/admin/rules/{id}", s.UpdateRule)
+			r.Delete("/admin/rules/{id}", s.DeleteRule)
+
+			r.Get("/admin/events/flagged", s.ListFlaggedEvents)
+			r.Patch("/admin/events/{transactionID}/{item}", s.PatchEventRecipient)
+
+			r.Post("/api/events", s.CreateEvent)
+			r.Patch("/api/events/{id}", s.PatchEvent)
+			r.Delete("/api/events/{id}", s.DeleteEvent)
+
+			r.Get("/admin/candidates", s.ListCandidates)
+			r.Get("/admin/candidates/{id}", s.GetCandidate)
+			r.Post("/admin/candidates/{id}/classify", s.ClassifyCandidate)
+
+			r.Get("/admin/presets", s.ListPresets)
+			r.Post("/admin/presets", s.CreatePreset)
+			r.Get("/admin/presets/{slug}", s.GetPreset)
+			r.Put("/admin/presets/{slug}", s.UpdatePreset)
+			r.Delete("/admin/presets/{slug}", s.DeletePreset)
+
+			r.Get("/admin/profile", s.GetProfile)
+			r.Put("/admin/profile", s.UpdateProfile)
+		})
+	})
+
+	// Quick logging has its own token so shortcuts never hold the admin secret
+	r.With(
+		commonHttp.RequireBearerToken(cfg.QuickLogToken),
+		commonHttp.Timeout(s.timeout),
+	).Post("/api/quick-log/{slug}", s.QuickLog)
+
+	return r
 }
 
 var (
@@ -53,11 +137,14 @@ var (
 func (s *Server) registerApiEndpoints() chi.Router {
 	r := chi.NewRouter()
 
-	r.HandleFunc("/api/levels", s.GetLevels)
-	r.HandleFunc("/api/events", s.GetEvents)
-	r.HandleFunc("/api/events/summary", s.GetEventsSummary)
-
-	r.HandleFunc("/api/predefined-event", s.GetPredefinedEvent)
+	r.Group(func(r chi.Router) {
+		r.Use(commonHttp.Timeout(s.timeout))
+		r.HandleFunc("/api/levels", s.GetLevels)
+		r.Get("/api/events", s.GetEvents)
+		r.Get("/api/events/summary", s.GetEventsSummary)
+		r.Get("/api/events/{id}", s.GetEvent)
+		r.Get("/api/forecast", s.GetForecast)
+	})
 
 	r.HandleFunc("/static/app.js", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Content-Type", "application/javascript")
@@ -85,7 +172,22 @@ func (s *Server) GetLevels(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	caffeineLevels := s.calculateCaffeineLevels(start, end)
+	profile, err := s.db.GetProfile(r.Context())
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	model, err := s.levelModel(profile, r.URL.Query().Get("model"))
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+
+	caffeineLevels, err := s.calculateCaffeineLevels(r.Context(), model, start, end)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
 	json.NewEncoder(w).Encode(caffeineLevels)
 }
 
@@ -103,7 +205,11 @@ func (s *Server) GetEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	events := s.db.GetEvents(start, end)
+	events, err := s.db.GetEvents(r.Context(), start, end)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
 	json.NewEncoder(w).Encode(events)
 }
 
@@ -131,8 +237,16 @@ func (s *Server) GetEventsSummary(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	intake := s.db.GetTotalIntake(start, end)
-	cost := s.db.GetTotalCost(start, end)
+	intake, err := s.db.GetTotalIntake(r.Context(), start, end)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
+	cost, err := s.db.GetTotalCost(r.Context(), start, end)
+	if err != nil {
+		commonHttp.HandleError(w, err)
+		return
+	}
 
 	resp := struct {
 		Intake int `json:"intake"`
@@ -144,58 +258,40 @@ func (s *Server) GetEventsSummary(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func (s *Server) GetPredefinedEvent(w http.ResponseWriter, r *http.Request) {
-	typeString := r.URL.Query().Get("type")
-	var coffeeType int
-	var err error
-	if typeString != "" {
-		coffeeType, err = strconv.Atoi(typeString)
-		if err != nil {
-			http.Error(w, "invalid type", http.StatusBadRequest)
-			return
-		}
-	}
-
-	types := map[int]models.CaffeineEvent{
-		1: {
-			Timestamp:   time.Now(),
-			Description: "Homemade Double Oat Latte",
-			Amount:      160,
-			Cost:        250,
-		},
-		2: {
-			Timestamp:   time.Now(),
-			Description: "The Jolly Miller",
-			Amount:      80,
-			Cost:        600,
-		},
-	}
-
-	event, ok := types[coffeeType]
-	if ok {
-		s.db.AddEvent(event)
-	}
-
-	w.Write([]byte("ok"))
-}
-
 type LevelEvent struct {
 	Timestamp TimeWrapper `json:"timestamp"`
 	Level     float64     `json:"level"`
 }
 
-func (s *Server) calculateCaffeineLevels(start, end time.Time) []LevelEvent {
-	const halfLife = 4
+// peakLevel returns the caffeine level when a drink taken at t peaks, and when
+// that is. Every drink up to t counts.
+func (s *Server) peakLevel(ctx context.Context, t time.Time) (float64, time.Time, error) {
+	model, err := s.profileModel(ctx)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	events, err := s.db.GetEvents(ctx, t.Add(-72*time.Hour), t.Add(time.Second))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	peak := t.Add(model.Peak())
+	return calculateSumCaffeineLevel(model, peak, events), peak, nil
+}
+
+func (s *Server) calculateCaffeineLevels(ctx context.Context, model kinetics.Model, start, end time.Time) ([]LevelEvent, error) {
 	caffeineLevels := make([]LevelEvent, 0)
 
 	eventStart := start.Add(-72 * time.Hour) // 3 days before start
-	caffeineEvents := s.db.GetEvents(eventStart, end)
+	caffeineEvents, err := s.db.GetEvents(ctx, eventStart, end)
+	if err != nil {
+		return nil, err
+	}
 
 	// add a level event for each snap time in the range.
 	for t := range rangeTimes(start, end) {
 		caffeineLevels = append(caffeineLevels, LevelEvent{
 			Timestamp: TimeWrapper{t},
-			Level:     calculateSumCaffeineLevel(halfLife, t, caffeineEvents),
+			Level:     calculateSumCaffeineLevel(model, t, caffeineEvents),
 		})
 	}
 
@@ -211,19 +307,19 @@ func (s *Server) calculateCaffeineLevels(start, end time.Time) []LevelEvent {
 		//fmt.Println(
 		//	"t: ", t,
 		//	"e.Timestamp: ", e.Timestamp,
-		//	"sum: ", calculateSumCaffeineLevel(halfLife, t, caffeineEvents),
-		//	"sum-1: ", calculateSumCaffeineLevel(halfLife, t.Add(-1*time.Minute), caffeineEvents),
+		//	"sum: ", calculateSumCaffeineLevel(model, t, caffeineEvents),
+		//	"sum-1: ", calculateSumCaffeineLevel(model, t.Add(-1*time.Minute), caffeineEvents),
 		//)
 
 		caffeineLevels = append(caffeineLevels, LevelEvent{
 			Timestamp: TimeWrapper{t},
-			Level:     calculateSumCaffeineLevel(halfLife, t, caffeineEvents),
+			Level:     calculateSumCaffeineLevel(model, t, caffeineEvents),
 		})
 
 		t = e.Timestamp.Add(-1 * time.Minute)
 		caffeineLevels = append(caffeineLevels, LevelEvent{
 			Timestamp: TimeWrapper{t},
-			Level:     calculateSumCaffeineLevel(halfLife, t, caffeineEvents),
+			Level:     calculateSumCaffeineLevel(model, t, caffeineEvents),
 		})
 	}
 
@@ -232,22 +328,16 @@ func (s *Server) calculateCaffeineLevels(start, end time.Time) []LevelEvent {
 	})
 
 	//fmt.Println(caffeineLevels)
-	return caffeineLevels
+	return caffeineLevels, nil
 }
 
-func calculateSumCaffeineLevel(halfLife float64, t time.Time, events []models.CaffeineEvent) float64 {
+func calculateSumCaffeineLevel(model kinetics.Model, t time.Time, events []models.CaffeineEvent) float64 {
 	totalCaffeine := 0.0
 	for _, e := range events {
-		elapsed := t.Sub(e.Timestamp)
-		totalCaffeine += calculateCaffeineLevel(e.Amount, halfLife, elapsed)
+		if e.ForSomeoneElse {
+			continue
+		}
+		totalCaffeine += model.Amount(float64(e.Amount), t.Sub(e.Timestamp))
 	}
 	return totalCaffeine
 }
-
-func calculateCaffeineLevel(amount int, halfLife float64, elapsed time.Duration) float64 {
-	hours := elapsed.Hours()
-	if hours < 0 {
-		return 0
-	}
-	return float64(amount) * math.Pow(0.5, float64(hours)/halfLife)
-}
@@ -2,6 +2,7 @@
 package tracker
 
 import (
+	"context"
 	"log/slog"
 	"os"
 
@@ -10,35 +11,69 @@ import (
 	"github.com/baely/txn/internal/balance"
 	"github.com/baely/txn/internal/common/errors"
 	"github.com/baely/txn/internal/tracker/database"
+	"github.com/baely/txn/internal/tracker/database/memory"
+	"github.com/baely/txn/internal/tracker/database/sqlite"
+	"github.com/baely/txn/internal/tracker/kinetics"
 	"github.com/baely/txn/internal/tracker/server"
 )
 
 // TrackerService tracks caffeine consumption events
 type TrackerService struct {
-	db        *database.Client
-	router    chi.Router
-	logger    *slog.Logger
+	db     database.Store
+	router chi.Router
+	logger *slog.Logger
 }
 
+// Storage backends
+const (
+	StoragePostgres = "postgres"
+	StorageSQLite   = "sqlite"
+	StorageMemory   = "memory"
+)
+
 // Config contains configuration for the TrackerService
 type Config struct {
-	DBUser     string
-	DBPassword string
-	DBHost     string
-	DBPort     string
-	DBName     string
-	Logger     *slog.Logger
+	Storage         string // StoragePostgres, StorageSQLite or StorageMemory
+	SQLitePath      string
+	DBUser          string
+	DBPassword      string
+	DBHost          string
+	DBPort          string
+	DBName          string
+	AdminSecretCode string
+	QuickLogToken   string
+	LevelModel      string          // kinetics.ModelAbsorption or kinetics.ModelExponential
+	Kinetics        kinetics.Params // Absorption rate, half-life and bioavailability
+	Logger          *slog.Logger
+
+	// History provides archived transactions for reprocessing
+	History server.History
 }
 
 // DefaultConfig returns the default service configuration
 func DefaultConfig() *Config {
+	storage := os.Getenv("TRACKER_STORAGE")
+	if storage == "" {
+		storage = StoragePostgres
+	}
+	sqlitePath := os.Getenv("TRACKER_SQLITE_PATH")
+	if sqlitePath == "" {
+		sqlitePath = "tracker.db"
+	}
+
 	return &Config{
-		DBUser:     os.Getenv("DB_USER"),
-		DBPassword: os.Getenv("DB_PASSWORD"),
-		DBHost:     os.Getenv("DB_HOST"),
-		DBPort:     os.Getenv("DB_PORT"),
-		DBName:     os.Getenv("DB_NAME"),
-		Logger:     slog.Default(),
+		Storage:         storage,
+		SQLitePath:      sqlitePath,
+		DBUser:          os.Getenv("DB_USER"),
+		DBPassword:      os.Getenv("DB_PASSWORD"),
+		DBHost:          os.Getenv("DB_HOST"),
+		DBPort:          os.Getenv("DB_PORT"),
+		DBName:          os.Getenv("DB_NAME"),
+		AdminSecretCode: os.Getenv("ADMIN_SECRET_CODE"),
+		QuickLogToken:   os.Getenv("QUICK_LOG_TOKEN"),
+		LevelModel:      os.Getenv("TRACKER_LEVEL_MODEL"),
+		Kinetics:        kinetics.DefaultParams(),
+		Logger:          slog.Default(),
 	}
 }
 
@@ -49,13 +84,7 @@ func New() *TrackerService {
 
 // NewWithConfig creates a new TrackerService with custom configuration
 func NewWithConfig(cfg *Config) *TrackerService {
-	db, err := database.NewClient(
-		cfg.DBUser,
-		cfg.DBPassword,
-		cfg.DBHost,
-		cfg.DBPort,
-		cfg.DBName,
-	)
+	db, err := openStore(cfg)
 	if err != nil {
 		errors.Must(err) // This will panic with database connection errors
 	}
@@ -66,22 +95,61 @@ func NewWithConfig(cfg *Config) *TrackerService {
 	}
 
 	// Initialize router
-	t.router = server.NewServer(db)
+	t.router = server.NewServer(db, server.Config{
+		AdminSecretCode: cfg.AdminSecretCode,
+		QuickLogToken:   cfg.QuickLogToken,
+		History:         cfg.History,
+		Model:           cfg.LevelModel,
+		Kinetics:        cfg.Kinetics,
+	})
 
 	return t
 }
 
+// openStore opens the configured storage backend
+func openStore(cfg *Config) (database.Store, error) {
+	switch cfg.Storage {
+	case StoragePostgres, "":
+		return database.NewClient(
+			cfg.DBUser,
+			cfg.DBPassword,
+			cfg.DBHost,
+			cfg.DBPort,
+			cfg.DBName,
+		)
+	case StorageSQLite:
+		return sqlite.Open(cfg.SQLitePath)
+	case StorageMemory:
+		return memory.New(), nil
+	default:
+		return nil, errors.Wrap(errors.ErrInvalidInput, "unknown tracker storage %q", cfg.Storage)
+	}
+}
+
 // Chi returns the router for this service
 func (t *TrackerService) Chi() chi.Router {
 	return t.router
 }
 
+// Filter returns the events the tracker subscribes to: new purchases in the
+// categories it tracks, plus uncategorised refunds, and deletions
+func (t *TrackerService) Filter() balance.EventFilter {
+	return balance.EventFilter{
+		EventTypes: []balance.EventType{
+			balance.EventTypeCreated,
+			balance.EventTypeBackfill,
+			balance.EventTypeDeleted,
+		},
+		Categories: []string{"restaurants-and-cafes", "groceries", balance.Uncategorised},
+	}
+}
+
 // HandleEvent processes transaction events from the webhook service
-// It implements the balance.TransactionEventHandler interface
-func (t *TrackerService) HandleEvent(event balance.TransactionEvent) error {
+// It implements the balance.TransactionEventHandlerV2 interface
+func (t *TrackerService) HandleEvent(ctx context.Context, event balance.TransactionEvent) error {
 	t.logger.Info("Processing transaction event",
 		"description", event.Transaction.Attributes.Description,
 		"amount", event.Transaction.Attributes.Amount.Value)
-		
-	return server.ProcessEvent(t.db, event)
+
+	return server.ProcessEvent(ctx, t.db, event)
 }
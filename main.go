@@ -2,10 +2,16 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/baely/txn/internal/balance"
+	"github.com/baely/txn/internal/cli"
 	"github.com/baely/txn/internal/common/errors"
 	"github.com/baely/txn/internal/common/logger"
 	"github.com/baely/txn/internal/ibbitot"
@@ -13,7 +19,19 @@ import (
 	"github.com/baely/txn/internal/tracker"
 )
 
+// shutdownTimeout bounds how long in-flight requests and events may take to finish
+const shutdownTimeout = 20 * time.Second
+
 func main() {
+	// Run a CLI subcommand instead of the server when one is given
+	if len(os.Args) > 1 {
+		if err := cli.Run(context.Background(), os.Args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "txn: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialize logger
 	log := logger.New(
 		logger.WithLevel(logger.LevelInfo),
@@ -26,11 +44,12 @@ func main() {
 	// Initialize services
 	webhookService := balance.New()
 	presenceService := ibbitot.New()
-	trackerService := tracker.New()
+	trackerConfig := tracker.DefaultConfig()
+	trackerConfig.History = webhookService.History()
+	trackerService := tracker.NewWithConfig(trackerConfig)
 
-	// Register event handlers
-	webhookService.RegisterHandler(presenceService)
-	webhookService.RegisterHandler(trackerService)
+	// Register event handlers. Presence is set by hand, so it takes no events.
+	webhookService.RegisterHandlerV2(trackerService, balance.WithFilter(trackerService.Filter()))
 
 	// Register domain handlers
 	s.RegisterDomain("events.baileys.dev", webhookService.Chi())
@@ -39,6 +58,25 @@ func main() {
 	s.RegisterDomain("caffeine-api.baileys.dev", trackerService.Chi())
 	s.RegisterDomain("caffeine.baileys.app", trackerService.Chi())
 
+	// Shut down gracefully on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			log.Error("Server shutdown failed", "error", err)
+		}
+		if err := webhookService.Shutdown(shutdownCtx); err != nil {
+			log.Error("Webhook service shutdown failed", "error", err)
+		}
+	}()
+
 	// Start server
 	log.Info("Starting server")
 	if err := s.ListenAndServe(); err != nil {
@@ -46,4 +84,8 @@ func main() {
 		errors.Must(err) // This will panic
 		os.Exit(1)
 	}
+
+	// Wait for in-flight events to finish before exiting
+	<-shutdownDone
+	log.Info("Shutdown complete")
 }